@@ -0,0 +1,238 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/admin"
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	mtlsAgent "github.com/polarismesh/polaris-sidecar/security/mtls/agent"
+	"github.com/polarismesh/polaris-sidecar/version"
+)
+
+// registerAdminHandlers registers the versioned admin api on the debugger mux, the api is only
+// served to the local clients, as the lookups run real resolutions and the config, the resolvers
+// and the certificate expose the details of the sidecar
+func (p *Agent) registerAdminHandlers(mux *http.ServeMux) {
+	handle := func(path string, handler http.HandlerFunc, methods ...string) {
+		mux.HandleFunc(path, localOnly(allowMethods(handler, methods...)))
+	}
+	handle(admin.PathStatus, p.handleStatus, http.MethodGet)
+	handle(admin.PathConfig, p.handleConfig, http.MethodGet)
+	handle(admin.PathResolvers, p.handleResolvers, http.MethodGet)
+	handle(admin.PathLookup, p.handleLookup, http.MethodGet)
+	handle(admin.PathCacheFlush, p.handleCacheFlush, http.MethodPost)
+	handle(admin.PathLogLevel, p.handleLogLevel, http.MethodGet, http.MethodPut)
+	handle(admin.PathMTLSCert, p.handleMTLSCert, http.MethodGet)
+}
+
+func allowMethods(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		for _, method := range methods {
+			if req.Method == method {
+				handler(resp, req)
+				return
+			}
+		}
+		writeError(resp, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", req.Method))
+	}
+}
+
+func localOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		if !isLocal(req) {
+			writeError(resp, http.StatusForbidden, errors.New("only allowed from localhost"))
+			return
+		}
+		handler(resp, req)
+	}
+}
+
+// isLocal reports whether the request comes from the host of the sidecar, by a loopback address
+// or by the address the request is accepted on, as the debugger may be bound to a specific address
+func isLocal(req *http.Request) bool {
+	remote := hostIP(req.RemoteAddr)
+	if remote == nil {
+		return false
+	}
+	if remote.IsLoopback() {
+		return true
+	}
+	local, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && remote.Equal(hostIP(local.String()))
+}
+
+func hostIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+func writeJSON(resp http.ResponseWriter, status int, body interface{}) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	encoder := json.NewEncoder(resp)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(body); err != nil {
+		log.Warnf("[agent] fail to write admin response, err: %v", err)
+	}
+}
+
+func writeError(resp http.ResponseWriter, status int, err error) {
+	writeJSON(resp, status, &admin.ErrorResponse{Error: err.Error()})
+}
+
+func (p *Agent) handleStatus(resp http.ResponseWriter, _ *http.Request) {
+	status := &admin.Status{
+		Version:   version.GetRevision(),
+		StartTime: p.startTime,
+		Uptime:    time.Since(p.startTime).Truncate(time.Second).String(),
+		Listeners: []string{},
+		Resolvers: []string{},
+		Features: map[string]bool{
+			"dns":         p.dnsSvrs != nil,
+			"mtls":        p.mtlsAgent != nil,
+			"metrics":     p.metricServer != nil,
+			"ratelimit":   p.rlsSvr != nil,
+			"redirect":    p.redirect != nil,
+			"resolv_conf": p.resolvConf != nil,
+		},
+	}
+	if p.dnsSvrs != nil {
+		for _, listener := range p.config.DNSListeners() {
+			status.Listeners = append(status.Listeners, listener.Address())
+		}
+		for _, r := range p.dnsSvrs.Resolvers() {
+			status.Resolvers = append(status.Resolvers, r.Name)
+		}
+	}
+	writeJSON(resp, http.StatusOK, status)
+}
+
+func (p *Agent) handleConfig(resp http.ResponseWriter, _ *http.Request) {
+	conf, err := p.activeConfig().Redacted()
+	if err != nil {
+		writeError(resp, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(resp, http.StatusOK, conf)
+}
+
+func (p *Agent) handleResolvers(resp http.ResponseWriter, _ *http.Request) {
+	if p.dnsSvrs == nil {
+		writeError(resp, http.StatusNotFound, errors.New("dns server not enabled"))
+		return
+	}
+	writeJSON(resp, http.StatusOK, p.dnsSvrs.Resolvers())
+}
+
+func (p *Agent) handleLookup(resp http.ResponseWriter, req *http.Request) {
+	if p.dnsSvrs == nil {
+		writeError(resp, http.StatusNotFound, errors.New("dns server not enabled"))
+		return
+	}
+	query := req.URL.Query()
+	trace, err := p.dnsSvrs.Lookup(req.Context(), query.Get("listener"), query.Get("name"), query.Get("type"))
+	if err != nil {
+		writeError(resp, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(resp, http.StatusOK, trace)
+}
+
+func (p *Agent) handleCacheFlush(resp http.ResponseWriter, _ *http.Request) {
+	if p.dnsSvrs == nil {
+		writeError(resp, http.StatusNotFound, errors.New("dns server not enabled"))
+		return
+	}
+	flushed := p.dnsSvrs.FlushCache()
+	log.Infof("[agent] caches flushed by admin api, %v", flushed)
+	writeJSON(resp, http.StatusOK, &admin.CacheFlushResponse{Flushed: flushed})
+}
+
+func (p *Agent) handleLogLevel(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		writeJSON(resp, http.StatusOK, logLevels(req.URL.Query().Get("scope")))
+		return
+	}
+	level := &admin.LogLevel{}
+	if err := json.NewDecoder(req.Body).Decode(level); err != nil {
+		writeError(resp, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+		return
+	}
+	value, err := log.ParseLevel(level.Level)
+	if err != nil {
+		writeError(resp, http.StatusBadRequest, err)
+		return
+	}
+	scopes := log.Scopes()
+	if len(level.Scope) > 0 {
+		scope, ok := scopes[level.Scope]
+		if !ok {
+			writeError(resp, http.StatusNotFound, fmt.Errorf("log scope %s not found", level.Scope))
+			return
+		}
+		scopes = map[string]*log.Scope{level.Scope: scope}
+	}
+	for name, scope := range scopes {
+		scope.SetOutputLevel(value)
+		log.Infof("[agent] log level of scope %s is set to %s by admin api", name, value)
+	}
+	writeJSON(resp, http.StatusOK, logLevels(level.Scope))
+}
+
+// logLevels returns the output levels of the scopes, or of the named scope
+func logLevels(name string) []*admin.LogLevel {
+	levels := make([]*admin.LogLevel, 0)
+	for scopeName, scope := range log.Scopes() {
+		if len(name) > 0 && scopeName != name {
+			continue
+		}
+		levels = append(levels, &admin.LogLevel{Scope: scopeName, Level: scope.GetOutputLevel().String()})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Scope < levels[j].Scope
+	})
+	return levels
+}
+
+func (p *Agent) handleMTLSCert(resp http.ResponseWriter, _ *http.Request) {
+	if p.mtlsAgent == nil {
+		writeError(resp, http.StatusNotFound, errors.New("mtls not enabled"))
+		return
+	}
+	cert, err := p.mtlsAgent.Certificate()
+	if errors.Is(err, mtlsAgent.ErrNoCertificate) {
+		writeError(resp, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		writeError(resp, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(resp, http.StatusOK, cert)
+}
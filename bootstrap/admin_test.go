@@ -0,0 +1,48 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package bootstrap
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/admin"
+)
+
+func TestRegisterAdminHandlers_localOnly(t *testing.T) {
+	mux := http.NewServeMux()
+	(&Agent{}).registerAdminHandlers(mux)
+	serve := func(remote string, local string) int {
+		req := httptest.NewRequest(http.MethodGet, admin.PathLookup+"?name=foo.", nil)
+		req.RemoteAddr = remote
+		addr, _ := net.ResolveTCPAddr("tcp", local)
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, addr))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusForbidden, serve("10.0.0.2:40000", "10.0.0.1:30000"))
+	// the dns server is not enabled in the agent, the local clients pass the check
+	assert.Equal(t, http.StatusNotFound, serve("127.0.0.1:40000", "127.0.0.1:30000"))
+	assert.Equal(t, http.StatusNotFound, serve("10.0.0.1:40000", "10.0.0.1:30000"))
+}
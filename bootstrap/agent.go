@@ -26,6 +26,10 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/polarismesh/polaris-go/pkg/model"
 
 	"github.com/polarismesh/polaris-sidecar/bootstrap/config"
 	"github.com/polarismesh/polaris-sidecar/envoy/metrics"
@@ -33,7 +37,10 @@ import (
 	"github.com/polarismesh/polaris-sidecar/pkg/client"
 	debughttp "github.com/polarismesh/polaris-sidecar/pkg/http"
 	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/redirect"
+	"github.com/polarismesh/polaris-sidecar/resolvconf"
 	"github.com/polarismesh/polaris-sidecar/resolver"
+	"github.com/polarismesh/polaris-sidecar/resolver/plugin"
 	mtlsAgent "github.com/polarismesh/polaris-sidecar/security/mtls/agent"
 )
 
@@ -44,8 +51,19 @@ type Agent struct {
 	mtlsAgent    *mtlsAgent.Agent
 	metricServer *metrics.Server
 	rlsSvr       *rls.RateLimitServer
+	redirect     *redirect.Manager
+	resolvConf   *resolvconf.Manager
+
+	debugSvr  *http.Server
+	startTime time.Time
 
-	debugSvr *http.Server
+	configFile string
+	bootConfig *config.BootConfig
+	// remoteFile the config file of the config center
+	remoteFile model.ConfigFile
+	configLock sync.RWMutex
+	// liveConfig the config with the changes of the config center applied at runtime
+	liveConfig *config.SidecarConfig
 }
 
 // Start the main agent routines
@@ -65,6 +83,7 @@ func Start(configFile string, bootConfig *config.BootConfig) {
 		}
 	}()
 	runMainLoop(cancel, errCh)
+	agent.stop()
 }
 
 // RunMainLoop sidecar server main loop
@@ -86,7 +105,7 @@ func runMainLoop(cancel context.CancelFunc, errCh chan error) {
 
 func newAgent(configFile string, bootConfig *config.BootConfig) (*Agent, error) {
 	var err error
-	polarisAgent := &Agent{}
+	polarisAgent := &Agent{startTime: time.Now(), configFile: configFile, bootConfig: bootConfig}
 	polarisAgent.config, err = config.ParseYamlConfig(configFile, bootConfig)
 	if nil != err {
 		log.Errorf("[agent] fail to parse sidecar config, err: %v", err)
@@ -99,17 +118,24 @@ func newAgent(configFile string, bootConfig *config.BootConfig) (*Agent, error)
 	log.Infof("[agent] success to init log config")
 	log.Infof("[agent] finished to parse sidecar config, current active config is \n%s", *polarisAgent.config)
 
+	sdkMetrics := &client.Metrics{
+		Port:     polarisAgent.config.Metrics.Port,
+		Type:     polarisAgent.config.Metrics.Type,
+		IP:       polarisAgent.config.Bind,
+		Interval: polarisAgent.config.Metrics.Interval,
+		Address:  polarisAgent.config.Metrics.Address,
+	}
+	if polarisAgent.config.Metrics.Enable && polarisAgent.config.Metrics.Type != metrics.TypePush {
+		// the metric server serves the metrics port, merging the sdk metrics served on loopback
+		sdkMetrics.IP = metrics.SDKMetricsIP
+		sdkMetrics.Port = 0
+	}
 	client.InitSDKContext(&client.Config{
-		Addresses: polarisAgent.config.PolarisConfig.Adddresses,
-		Metrics: &client.Metrics{
-			Port:     polarisAgent.config.Metrics.Port,
-			Type:     polarisAgent.config.Metrics.Type,
-			IP:       polarisAgent.config.Bind,
-			Interval: polarisAgent.config.Metrics.Interval,
-			Address:  polarisAgent.config.Metrics.Address,
-		},
+		Addresses:          polarisAgent.config.PolarisConfig.Addresses,
+		Metrics:            sdkMetrics,
 		LocationConfigImpl: polarisAgent.config.PolarisConfig.Location,
 	})
+	polarisAgent.loadRemoteConfig()
 
 	mux := http.NewServeMux()
 	polarisAgent.debugSvr = &http.Server{
@@ -128,9 +154,39 @@ func newAgent(configFile string, bootConfig *config.BootConfig) (*Agent, error)
 	if err := polarisAgent.buildEnvoyRls(configFile); err != nil {
 		return nil, err
 	}
+	if err := polarisAgent.buildRedirect(configFile); err != nil {
+		return nil, err
+	}
 	return polarisAgent, nil
 }
 
+func (p *Agent) buildRedirect(configFile string) error {
+	if !p.config.Redirect.Enable {
+		return nil
+	}
+	log.Infof("create redirect manager")
+	manager, err := redirect.NewManager(p.config.RedirectConfig(), nil)
+	if err != nil {
+		return err
+	}
+	p.redirect = manager
+	return nil
+}
+
+// stop cleans up the resources left on the host when the agent exits
+func (p *Agent) stop() {
+	if p.redirect != nil && p.redirect.CleanupOnExit() {
+		if err := p.redirect.Uninstall(); err != nil {
+			log.Errorf("[agent] fail to remove redirect rules, err: %v", err)
+		}
+	}
+	if p.resolvConf != nil && p.resolvConf.RestoreOnExit() {
+		if err := p.resolvConf.Restore(); err != nil {
+			log.Errorf("[agent] fail to restore resolv.conf, err: %v", err)
+		}
+	}
+}
+
 func (p *Agent) buildSecurity(configFile string) error {
 	if p.config.MTLS != nil && p.config.MTLS.Enable {
 		log.Info("create mtls agent")
@@ -148,7 +204,12 @@ func (p *Agent) buildSecurity(configFile string) error {
 func (p *Agent) buildEnvoyMetrics(configFile string) error {
 	if p.config.Metrics.Enable {
 		log.Infof("create metric server")
-		p.metricServer = metrics.NewServer(p.config.Namespace, p.config.Metrics.Port)
+		p.metricServer = metrics.NewServer(p.config.Namespace, p.config.Bind, p.config.Metrics.Port)
+		if p.dnsSvrs != nil {
+			if err := p.metricServer.Register(p.dnsSvrs.Collectors()...); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -159,8 +220,14 @@ func (p *Agent) buildEnvoyRls(configFile string) error {
 	}
 	log.Infof("create ratelimit server")
 	conf := &rls.Config{
-		Network: strings.ToLower(p.config.RateLimit.Network),
-		TLSInfo: p.config.RateLimit.TLSInfo,
+		Network:               strings.ToLower(p.config.RateLimit.Network),
+		TLSInfo:               p.config.RateLimit.TLSInfo,
+		Mapping:               p.config.RateLimit.Mapping,
+		FailurePolicy:         p.config.RateLimit.FailurePolicy,
+		Shadow:                p.config.RateLimit.Shadow,
+		Domains:               p.config.RateLimit.Domains,
+		Local:                 p.config.RateLimit.Local,
+		DecisionLogSampleRate: p.config.RateLimit.DecisionLogSampleRate,
 	}
 	if conf.Network == "tcp" {
 		conf.Address = fmt.Sprintf("%s:%d", p.config.Bind, p.config.RateLimit.BindPort)
@@ -170,16 +237,45 @@ func (p *Agent) buildEnvoyRls(configFile string) error {
 		return err
 	}
 	p.rlsSvr = rlsSvr
+	if p.metricServer != nil {
+		if err := p.metricServer.Register(rlsSvr.Collectors()...); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (p *Agent) buildDns(configFile string) error {
+	resolvConfPath := resolvconf.DefaultPath
+	if p.config.ResolvConf.Manage {
+		log.Infof("create resolv.conf manager")
+		manager, err := resolvconf.NewManager(p.config.ResolvConfConfig())
+		if err != nil {
+			return err
+		}
+		// the upstreams are read from the backup once the resolv.conf points at the sidecar
+		if err := manager.Backup(); err != nil {
+			return err
+		}
+		p.resolvConf = manager
+		resolvConfPath = p.config.ResolvConf.Backup()
+	}
+	for _, pluginConfig := range p.config.Plugins {
+		if err := plugin.Register(pluginConfig); err != nil {
+			return err
+		}
+	}
 	svr, err := resolver.NewServers(&resolver.ResolverConfig{
-		BindLocalhost: p.config.BindLocalhost(),
-		BindIP:        p.config.Bind,
-		BindPort:      uint32(p.config.Port),
-		Recurse:       p.config.Recurse,
-		Resolvers:     p.config.Resolvers,
+		BindLocalhost:  p.config.BindLocalhost(),
+		BindIP:         p.config.Bind,
+		BindPort:       uint32(p.config.Port),
+		Listeners:      p.config.DNSListeners(),
+		ResolvConfPath: resolvConfPath,
+		Recurse:        p.config.Recurse,
+		Protection:     p.config.Protection,
+		Listen:         p.config.Listen,
+		Resolve:        p.config.Resolve,
+		Resolvers:      p.config.Resolvers,
 	})
 	if err != nil {
 		return err
@@ -225,6 +321,7 @@ func (p *Agent) Start(ctx context.Context) error {
 			mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
 			mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 			mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+			p.registerAdminHandlers(mux)
 
 			if err := p.debugSvr.Serve(ln); err != nil {
 				errChan <- err
@@ -245,6 +342,22 @@ func (p *Agent) Start(ctx context.Context) error {
 			}
 		}()
 	}
+	if p.config.ConfigCenter.Enable {
+		go p.watchConfigCenter(ctx)
+	}
+	if p.resolvConf != nil {
+		log.Info("apply resolv.conf")
+		if err := p.resolvConf.Apply(); err != nil {
+			return err
+		}
+		go p.resolvConf.Watch(ctx)
+	}
+	if p.redirect != nil {
+		log.Info("install redirect rules")
+		if err := p.redirect.Install(); err != nil {
+			return err
+		}
+	}
 	if p.mtlsAgent != nil {
 		go func() {
 			log.Info("start mtls agent")
@@ -24,6 +24,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -34,11 +35,16 @@ import (
 	"github.com/polarismesh/polaris-sidecar/envoy/metrics"
 	"github.com/polarismesh/polaris-sidecar/envoy/rls"
 	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/redirect"
+	"github.com/polarismesh/polaris-sidecar/resolvconf"
 	"github.com/polarismesh/polaris-sidecar/resolver"
+	"github.com/polarismesh/polaris-sidecar/resolver/plugin"
 )
 
 const defaultSvcSuffix = "."
 
+var defaultPolarisAddresses = []string{"127.0.0.1:8091"}
+
 // BootConfig simple config for bootstrap
 type BootConfig struct {
 	Bind                        string
@@ -52,22 +58,59 @@ type BootConfig struct {
 
 // SidecarConfig global sidecar config struct
 type SidecarConfig struct {
-	PolarisConfig *PolarisConfig          `yaml:"polaris"`
-	Bind          string                  `yaml:"bind"`
-	Port          int                     `yaml:"port"`
-	Namespace     string                  `yaml:"namespace"`
-	MTLS          *MTLSConfiguration      `yaml:"mtls"`
-	Logger        *log.Options            `yaml:"logger"`
-	Recurse       *resolver.RecurseConfig `yaml:"recurse"`
-	Resolvers     []*resolver.ConfigEntry `yaml:"resolvers"`
-	Metrics       *metrics.MetricConfig   `yaml:"metrics"`
-	RateLimit     *rls.Config             `yaml:"ratelimit"`
-	Debugger      *DebugConfig            `yaml:"debugger"`
+	PolarisConfig *PolarisConfig             `yaml:"polaris"`
+	Bind          string                     `yaml:"bind"`
+	Port          int                        `yaml:"port"`
+	Listeners     []*resolver.ListenerConfig `yaml:"listeners"`
+	Namespace     string                     `yaml:"namespace"`
+	MTLS          *MTLSConfiguration         `yaml:"mtls"`
+	Logger        *log.Options               `yaml:"logger"`
+	Recurse       *resolver.RecurseConfig    `yaml:"recurse"`
+	Protection    *resolver.ProtectionConfig `yaml:"protection"`
+	Listen        *resolver.ListenConfig     `yaml:"listen"`
+	Resolve       *resolver.ResolveConfig    `yaml:"resolve"`
+	Redirect      *redirect.Config           `yaml:"redirect"`
+	ResolvConf    *resolvconf.Config         `yaml:"resolv_conf"`
+	Resolvers     []*resolver.ConfigEntry    `yaml:"resolvers"`
+	Plugins       []*plugin.Config           `yaml:"plugins"`
+	Metrics       *metrics.MetricConfig      `yaml:"metrics"`
+	RateLimit     *rls.Config                `yaml:"ratelimit"`
+	Debugger      *DebugConfig               `yaml:"debugger"`
+	ConfigCenter  *ConfigCenterConfig        `yaml:"config_center"`
 }
 
 type PolarisConfig struct {
-	Adddresses []string                    `yaml:"adddresses"`
-	Location   *sdkconf.LocationConfigImpl `yaml:"location"`
+	Addresses []string `yaml:"addresses"`
+	// DeprecatedAddresses is the misspelled adddresses key, still accepted for compatibility
+	DeprecatedAddresses []string                    `yaml:"adddresses,omitempty"`
+	Location            *sdkconf.LocationConfigImpl `yaml:"location"`
+}
+
+// normalize prefers the addresses key, falls back to the deprecated adddresses key and
+// drops the empty addresses left by unset environment variables
+func (p *PolarisConfig) normalize() {
+	addresses := nonEmpty(p.Addresses)
+	if deprecated := nonEmpty(p.DeprecatedAddresses); len(deprecated) > 0 {
+		log.Warnf("[agent] polaris.adddresses is deprecated, use polaris.addresses instead")
+		if len(addresses) == 0 || reflect.DeepEqual(addresses, defaultPolarisAddresses) {
+			addresses = deprecated
+		}
+	}
+	if len(addresses) == 0 {
+		addresses = append([]string{}, defaultPolarisAddresses...)
+	}
+	p.Addresses = addresses
+	p.DeprecatedAddresses = nil
+}
+
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			result = append(result, value)
+		}
+	}
+	return result
 }
 
 type Location struct {
@@ -102,9 +145,7 @@ func (s SidecarConfig) String() string {
 func defaultSidecarConfig() *SidecarConfig {
 	return &SidecarConfig{
 		PolarisConfig: &PolarisConfig{
-			Adddresses: []string{
-				"127.0.0.1:8091",
-			},
+			Addresses: append([]string{}, defaultPolarisAddresses...),
 		},
 		Bind: "0.0.0.0",
 		Port: 53,
@@ -112,6 +153,11 @@ func defaultSidecarConfig() *SidecarConfig {
 			Enable:     false,
 			TimeoutSec: 1,
 		},
+		Protection: resolver.DefaultProtectionConfig(),
+		Listen:     resolver.DefaultListenConfig(),
+		Resolve:    resolver.DefaultResolveConfig(),
+		Redirect:   redirect.DefaultConfig(),
+		ResolvConf: resolvconf.DefaultConfig(),
 		MTLS: &MTLSConfiguration{
 			Enable: false,
 		},
@@ -130,6 +176,12 @@ func defaultSidecarConfig() *SidecarConfig {
 			OutputLevel:           "info",
 		},
 		Resolvers: []*resolver.ConfigEntry{
+			{
+				Name:   resolver.PluginNameKubernetes,
+				DnsTtl: 5,
+				Enable: false,
+				Suffix: defaultSvcSuffix,
+			},
 			{
 				Name:   resolver.PluginNameDnsAgent,
 				DnsTtl: 10,
@@ -148,9 +200,11 @@ func defaultSidecarConfig() *SidecarConfig {
 			},
 		},
 		RateLimit: &rls.Config{
-			Enable:  false,
-			Network: "unix",
-			Address: rls.DefaultRLSAddress,
+			Enable:        false,
+			Network:       "unix",
+			Address:       rls.DefaultRLSAddress,
+			Mapping:       rls.DefaultMappingConfig(),
+			FailurePolicy: rls.FailOpen,
 		},
 		Metrics: &metrics.MetricConfig{
 			Enable: false,
@@ -160,12 +214,62 @@ func defaultSidecarConfig() *SidecarConfig {
 			Enable: true,
 			Port:   50000,
 		},
+		ConfigCenter: &ConfigCenterConfig{
+			Enable:    false,
+			Namespace: "default",
+			Group:     "polaris-sidecar",
+			File:      "polaris-sidecar.yaml",
+		},
+	}
+}
+
+// DNSListeners returns the dns listeners, the listener of Bind and Port is used when none is configured
+func (s *SidecarConfig) DNSListeners() []*resolver.ListenerConfig {
+	if len(s.Listeners) > 0 {
+		return s.Listeners
+	}
+	return []*resolver.ListenerConfig{{Name: "default", Bind: s.Bind, Port: s.Port}}
+}
+
+// RedirectConfig returns the redirect config, the queries are redirected to the port
+// of the first dns listener when the port is not configured
+func (s *SidecarConfig) RedirectConfig() *redirect.Config {
+	conf := *s.Redirect
+	if conf.Port == 0 {
+		conf.Port = s.DNSListeners()[0].Port
 	}
+	return &conf
 }
 
+// ResolvConfConfig returns the resolv.conf config, the nameservers default to the dns listeners
+// on port 53, as the resolv.conf could not specify the port
+func (s *SidecarConfig) ResolvConfConfig() *resolvconf.Config {
+	conf := *s.ResolvConf
+	if len(conf.Nameservers) > 0 {
+		return &conf
+	}
+	for _, listener := range s.DNSListeners() {
+		if listener.Port != 53 {
+			continue
+		}
+		bindIP := net.ParseIP(listener.Bind)
+		if bindIP.IsUnspecified() {
+			conf.Nameservers = append(conf.Nameservers, "127.0.0.1")
+		} else {
+			conf.Nameservers = append(conf.Nameservers, listener.Bind)
+		}
+	}
+	return &conf
+}
+
+// BindLocalhost checks whether any of the dns listeners is reachable by the loopback address
 func (s *SidecarConfig) BindLocalhost() bool {
-	bindIP := net.ParseIP(s.Bind)
-	return bindIP.IsLoopback() || bindIP.IsUnspecified()
+	for _, listener := range s.DNSListeners() {
+		if listener.BindLocalhost() {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *SidecarConfig) verify() error {
@@ -198,6 +302,27 @@ func (s *SidecarConfig) verify() error {
 	if !hasOneEnable {
 		errs.Errors = append(errs.Errors, errors.New("you should at least enable one resolver"))
 	}
+	if err := resolver.VerifyListeners(s.Listeners, s.Resolvers); err != nil {
+		errs.Errors = append(errs.Errors, err)
+	}
+	if s.ResolvConf.Manage {
+		if err := s.ResolvConfConfig().Verify(); err != nil {
+			errs.Errors = append(errs.Errors, err)
+		}
+	}
+	if s.Redirect.Enable {
+		if err := s.RedirectConfig().Verify(); err != nil {
+			errs.Errors = append(errs.Errors, err)
+		}
+	}
+	for _, pluginConfig := range s.Plugins {
+		if err := pluginConfig.Verify(); err != nil {
+			errs.Errors = append(errs.Errors, err)
+		}
+	}
+	if err := s.ConfigCenter.Verify(); err != nil {
+		errs.Errors = append(errs.Errors, err)
+	}
 	return errs.ErrorOrNil()
 }
 
@@ -224,11 +349,19 @@ func parseLabels(labels string) map[string]string {
 	return values
 }
 
+// setOption sets the option of the resolver, the option map is created when absent
+func setOption(entry *resolver.ConfigEntry, key string, value interface{}) {
+	if entry.Option == nil {
+		entry.Option = make(map[string]interface{})
+	}
+	entry.Option[key] = value
+}
+
 func (s *SidecarConfig) mergeEnv() {
 	s.Bind = getEnvStringValue(EnvSidecarBind, s.Bind)
 	s.Port = getEnvIntValue(EnvSidecarPort, s.Port)
 	s.Namespace = getEnvStringValue(EnvSidecarNamespace, s.Namespace)
-	s.PolarisConfig.Adddresses = getEnvStringsValue(EnvPolarisAddress, s.PolarisConfig.Adddresses)
+	s.PolarisConfig.Addresses = getEnvStringsValue(EnvPolarisAddress, s.PolarisConfig.Addresses)
 	s.MTLS.Enable = getEnvBoolValue(EnvSidecarMtlsEnable, s.MTLS.Enable)
 	s.MTLS.CAServer = getEnvStringValue(EnvSidecarMtlsCAServer, s.MTLS.CAServer)
 	s.RateLimit.Enable = getEnvBoolValue(EnvSidecarRLSEnable, s.RateLimit.Enable)
@@ -249,19 +382,18 @@ func (s *SidecarConfig) mergeEnv() {
 				resolverConf.Suffix = getEnvStringValue(EnvSidecarDnsSuffix, resolverConf.Suffix)
 				routeLabels := getEnvStringValue(EnvSidecarDnsRouteLabels, "")
 				if len(routeLabels) > 0 {
-					resolverConf.Option = make(map[string]interface{})
-					resolverConf.Option["route_labels"] = routeLabels
+					setOption(resolverConf, "route_labels", routeLabels)
 				}
 			} else if resolverConf.Name == resolver.PluginNameMeshProxy {
 				resolverConf.DnsTtl = getEnvIntValue(EnvSidecarMeshTtl, resolverConf.DnsTtl)
 				resolverConf.Enable = getEnvBoolValue(EnvSidecarMeshEnable, resolverConf.Enable)
 				reloadIntervalSec := getEnvIntValue(EnvSidecarMeshReloadInterval, 0)
 				if reloadIntervalSec > 0 {
-					resolverConf.Option["reload_interval_sec"] = reloadIntervalSec
+					setOption(resolverConf, "reload_interval_sec", reloadIntervalSec)
 				}
 				dnsAnswerIP := getEnvStringValue(EnvSidecarMeshAnswerIp, "")
 				if len(dnsAnswerIP) > 0 {
-					resolverConf.Option["dns_answer_ip"] = dnsAnswerIP
+					setOption(resolverConf, "dns_answer_ip", dnsAnswerIP)
 				}
 			}
 		}
@@ -289,7 +421,6 @@ func (s *SidecarConfig) mergeBootConfig(config *BootConfig) error {
 				fmt.Errorf("fail to parse recurse-enabled value to boolean, err: %v", err))
 		}
 	}
-	s.Logger.OutputLevel = config.LogLevel
 	if len(config.ResolverDnsAgentEnabled) > 0 || len(config.ResolverDnsAgentRouteLabels) > 0 {
 		for _, resolverConfig := range s.Resolvers {
 			if resolverConfig.Name == resolver.PluginNameDnsAgent {
@@ -301,12 +432,9 @@ func (s *SidecarConfig) mergeBootConfig(config *BootConfig) error {
 					}
 				}
 				if len(config.ResolverDnsAgentRouteLabels) > 0 {
-					labels := parseLabels(config.ResolverDnsAgentRouteLabels)
-					if len(labels) > 0 {
-						if len(resolverConfig.Option) == 0 {
-							resolverConfig.Option = make(map[string]interface{})
-						}
-						resolverConfig.Option["route_labels"] = labels
+					// the dnsagent option route_labels is the same k:v list as the flag
+					if labels := parseLabels(config.ResolverDnsAgentRouteLabels); len(labels) > 0 {
+						setOption(resolverConfig, "route_labels", config.ResolverDnsAgentRouteLabels)
 					}
 				}
 				continue
@@ -335,7 +463,28 @@ func IsFile(path string) bool {
 
 // ParseYamlConfig parse config file to object
 func ParseYamlConfig(configFile string, bootConfig *BootConfig) (*SidecarConfig, error) {
+	return ParseRemoteYamlConfig(configFile, bootConfig, nil)
+}
+
+// ParseRemoteYamlConfig parse config file to object, the remote content of the config center
+// is merged over the config file, the env and the flags still take precedence over it
+func ParseRemoteYamlConfig(configFile string, bootConfig *BootConfig, remote []byte) (*SidecarConfig, error) {
+	sidecarConfig, err := loadConfig(configFile, bootConfig, remote, nil)
+	if nil != err {
+		return nil, err
+	}
+	return sidecarConfig, sidecarConfig.verify()
+}
+
+// loadConfig loads the config file and merges the remote content, the env and the boot config into it,
+// stage is called with the config after each step, which are default, file, env and flag
+func loadConfig(configFile string, bootConfig *BootConfig, remote []byte,
+	stage func(name string, conf *SidecarConfig)) (*SidecarConfig, error) {
+	if stage == nil {
+		stage = func(string, *SidecarConfig) {}
+	}
 	sidecarConfig := defaultSidecarConfig()
+	stage(sourceDefault, sidecarConfig)
 	if len(configFile) > 0 && IsFile(configFile) {
 		buf, err := ioutil.ReadFile(configFile)
 		if nil != err {
@@ -348,11 +497,22 @@ func ParseYamlConfig(configFile string, bootConfig *BootConfig) (*SidecarConfig,
 	} else {
 		log.Warnf("[agent] config file %s not exists, use default sidecar config", configFile)
 	}
+	sidecarConfig.PolarisConfig.normalize()
+	stage(sourceFile, sidecarConfig)
+	if len(remote) > 0 {
+		if err := parseYamlContent(remote, sidecarConfig); nil != err {
+			return nil, err
+		}
+		sidecarConfig.PolarisConfig.normalize()
+	}
+	stage(sourceConfigCenter, sidecarConfig)
 	sidecarConfig.mergeEnv()
+	stage(sourceEnv, sidecarConfig)
 	if err := sidecarConfig.mergeBootConfig(bootConfig); nil != err {
 		return nil, err
 	}
-	return sidecarConfig, sidecarConfig.verify()
+	stage(sourceFlag, sidecarConfig)
+	return sidecarConfig, nil
 }
 
 func parseYamlContent(content []byte, sidecarConfig *SidecarConfig) error {
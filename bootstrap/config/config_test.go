@@ -77,3 +77,20 @@ func TestReplaceEnv(t *testing.T) {
 	fmt.Println("nextValue is " + nextValue)
 
 }
+
+func TestSidecarConfig_mergeBootConfig_logLevel(t *testing.T) {
+	cfg := defaultSidecarConfig()
+	cfg.Logger.OutputLevel = "debug"
+	if err := cfg.mergeBootConfig(&BootConfig{}); nil != err {
+		t.Fatal(err)
+	}
+	if cfg.Logger.OutputLevel != "debug" {
+		t.Fatalf("log level should be kept without the flag, but is %q", cfg.Logger.OutputLevel)
+	}
+	if err := cfg.mergeBootConfig(&BootConfig{LogLevel: "warn"}); nil != err {
+		t.Fatal(err)
+	}
+	if cfg.Logger.OutputLevel != "warn" {
+		t.Fatalf("log level should be the flag, but is %q", cfg.Logger.OutputLevel)
+	}
+}
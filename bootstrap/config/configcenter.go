@@ -0,0 +1,70 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+)
+
+// ConfigCenterConfig subscribes the config file of the polaris config center, the remote yaml is merged
+// over the local config file and the changes are applied at runtime. The lists of the remote yaml,
+// such as the resolvers, replace the local ones as a whole
+type ConfigCenterConfig struct {
+	Enable    bool   `yaml:"enable"`
+	Namespace string `yaml:"namespace"`
+	Group     string `yaml:"group"`
+	File      string `yaml:"file"`
+}
+
+// Verify checks the config file of the config center is specified
+func (c *ConfigCenterConfig) Verify() error {
+	if !c.Enable {
+		return nil
+	}
+	if len(c.Namespace) == 0 || len(c.Group) == 0 || len(c.File) == 0 {
+		return errors.New("config_center namespace, group and file should not be empty")
+	}
+	return nil
+}
+
+// liveKeys the keys applied at runtime, the options of the resolvers are checked by the resolvers
+var liveKeys = regexp.MustCompile(`^(logger\.output_level|recurse\.name_servers.*|recurse\.search_names.*|` +
+	`resolvers\[\d+\]\.option.*)$`)
+
+// RestartRequired returns the changed keys of the next config which could not be applied at runtime
+func (s *SidecarConfig) RestartRequired(next *SidecarConfig) []string {
+	current, values := flattenConfig(s), flattenConfig(next)
+	var keys []string
+	for key, value := range values {
+		if liveKeys.MatchString(key) {
+			continue
+		}
+		if currentValue, ok := current[key]; !ok || currentValue != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range current {
+		if _, ok := values[key]; !ok && !liveKeys.MatchString(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
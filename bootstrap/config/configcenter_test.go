@@ -0,0 +1,82 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const localCfg = `
+port: 5353
+logger:
+  output_level: info
+recurse:
+  timeoutSec: 1
+  name_servers:
+    - 10.0.0.1
+`
+
+const remoteCfg = `
+port: 5454
+logger:
+  output_level: debug
+recurse:
+  timeoutSec: 1
+  name_servers:
+    - 10.0.0.2
+resolvers:
+  - name: dnsagent
+    enable: true
+    option:
+      route_labels: env:gray
+`
+
+func TestParseRemoteYamlConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "polaris-sidecar.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(localCfg), 0644))
+
+	local, err := ParseRemoteYamlConfig(configFile, &BootConfig{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "info", local.Logger.OutputLevel)
+
+	// the remote content is merged over the file, the flags take precedence over it
+	next, err := ParseRemoteYamlConfig(configFile, &BootConfig{Port: 53}, []byte(remoteCfg))
+	assert.NoError(t, err)
+	assert.Equal(t, 53, next.Port)
+	assert.Equal(t, "debug", next.Logger.OutputLevel)
+	assert.Equal(t, []string{"10.0.0.2"}, next.Recurse.NameServers)
+	assert.Len(t, next.Resolvers, 1)
+
+	_, err = ParseRemoteYamlConfig(configFile, &BootConfig{}, []byte("port: ["))
+	assert.Error(t, err)
+
+	// only the keys could not be applied at runtime are reported
+	next, err = ParseRemoteYamlConfig(configFile, &BootConfig{}, []byte(remoteCfg))
+	assert.NoError(t, err)
+	keys := local.RestartRequired(next)
+	assert.Contains(t, keys, "port")
+	assert.Contains(t, keys, "resolvers[0].name")
+	assert.NotContains(t, keys, "logger.output_level")
+	assert.NotContains(t, keys, "recurse.name_servers[0]")
+	assert.NotContains(t, keys, "resolvers[0].option.route_labels")
+	assert.Empty(t, next.RestartRequired(next))
+}
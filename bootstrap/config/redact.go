@@ -0,0 +1,77 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const redactedValue = "******"
+
+// sensitiveKeys the config keys holding the secrets, matched by substring
+var sensitiveKeys = []string{"token", "password", "passwd", "secret", "credential", "private_key", "access_key"}
+
+// Redacted returns the config as a json encodable tree, the values of the sensitive keys are masked
+func (s SidecarConfig) Redacted() (interface{}, error) {
+	content, err := yaml.Marshal(&s)
+	if nil != err {
+		return nil, err
+	}
+	var tree interface{}
+	if err := yaml.Unmarshal(content, &tree); nil != err {
+		return nil, err
+	}
+	return redact(tree), nil
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact converts the yaml maps to string keyed maps and masks the sensitive values
+func redact(node interface{}) interface{} {
+	switch value := node.(type) {
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			key := fmt.Sprint(k)
+			if isSensitive(key) && v != nil && v != "" {
+				ret[key] = redactedValue
+				continue
+			}
+			ret[key] = redact(v)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, 0, len(value))
+		for _, v := range value {
+			ret = append(ret, redact(v))
+		}
+		return ret
+	}
+	return node
+}
@@ -0,0 +1,40 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+func TestSidecarConfig_Redacted(t *testing.T) {
+	conf := defaultSidecarConfig()
+	conf.Resolvers = []*resolver.ConfigEntry{{Name: "kubernetes", Option: map[string]interface{}{
+		"kubeconfig": "/root/.kube/config",
+		"api_token":  "abc",
+	}}}
+	tree, err := conf.Redacted()
+	assert.NoError(t, err)
+	entry := tree.(map[string]interface{})["resolvers"].([]interface{})[0].(map[string]interface{})
+	option := entry["option"].(map[string]interface{})
+	assert.Equal(t, redactedValue, option["api_token"])
+	assert.Equal(t, "/root/.kube/config", option["kubeconfig"])
+}
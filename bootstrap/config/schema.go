@@ -0,0 +1,185 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// JSONSchema returns the json schema of the sidecar config for the editor completion, the options
+// of the resolvers are described by the typed options the registered resolvers declare
+func JSONSchema() map[string]interface{} {
+	defaults := reflect.ValueOf(defaultSidecarConfig())
+	schema := schemaOf(defaults.Type(), "yaml", defaults)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "polaris-sidecar config"
+
+	resolvers := schema["properties"].(map[string]interface{})["resolvers"].(map[string]interface{})
+	entry := resolvers["items"].(map[string]interface{})
+	names := resolver.ResolverNames()
+	if len(names) > 0 {
+		// the names of the plugins are declared in the plugins
+		entry["properties"].(map[string]interface{})["name"] = map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"enum": names},
+				map[string]interface{}{"type": "string"},
+			},
+		}
+	}
+	var conditions []interface{}
+	for _, name := range names {
+		declarer, ok := resolver.NameResolver(name).(resolver.OptionsDeclarer)
+		if !ok {
+			continue
+		}
+		options := reflect.ValueOf(declarer.NewOptions())
+		conditions = append(conditions, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"name": map[string]interface{}{"const": name}},
+			},
+			"then": map[string]interface{}{
+				"properties": map[string]interface{}{"option": schemaOf(options.Type(), "json", options)},
+			},
+		})
+	}
+	if len(conditions) > 0 {
+		entry["allOf"] = conditions
+	}
+	return schema
+}
+
+// schemaOf returns the schema of the type, the fields are named by the tag,
+// the scalar defaults are taken from the value if it is valid
+func schemaOf(t reflect.Type, tag string, value reflect.Value) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if value.IsValid() {
+			if value.IsNil() {
+				value = reflect.Value{}
+			} else {
+				value = value.Elem()
+			}
+		}
+	}
+	schema := make(map[string]interface{})
+	if t == durationType {
+		schema["type"] = []string{"string", "integer"}
+		return schema
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		schema["type"] = "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema["type"] = "integer"
+		schema["minimum"] = 0
+	case reflect.Float32, reflect.Float64:
+		schema["type"] = "number"
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Slice, reflect.Array:
+		schema["type"] = "array"
+		schema["items"] = schemaOf(t.Elem(), tag, reflect.Value{})
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = schemaOf(t.Elem(), tag, reflect.Value{})
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		structProperties(t, tag, value, properties)
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+	case reflect.Interface:
+		return schema
+	}
+	if value.IsValid() && !value.IsZero() && isScalar(t) {
+		schema["default"] = value.Interface()
+	}
+	return schema
+}
+
+func structProperties(t reflect.Type, tag string, value reflect.Value, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, inline := fieldName(field, tag)
+		if name == "-" {
+			continue
+		}
+		var fieldValue reflect.Value
+		if value.IsValid() {
+			fieldValue = value.Field(i)
+		}
+		if inline {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+				if fieldValue.IsValid() && !fieldValue.IsNil() {
+					fieldValue = fieldValue.Elem()
+				} else {
+					fieldValue = reflect.Value{}
+				}
+			}
+			structProperties(fieldType, tag, fieldValue, properties)
+			continue
+		}
+		properties[name] = schemaOf(field.Type, tag, fieldValue)
+	}
+}
+
+// fieldName returns the name of the field in the tag, the yaml names default to the lower case
+func fieldName(field reflect.StructField, tag string) (string, bool) {
+	parts := strings.Split(field.Tag.Get(tag), ",")
+	var inline bool
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			inline = true
+		}
+	}
+	if len(parts[0]) > 0 {
+		return parts[0], inline
+	}
+	if field.Anonymous && tag == "json" {
+		return "", true
+	}
+	if tag == "yaml" {
+		return strings.ToLower(field.Name), inline
+	}
+	return field.Name, inline
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return isScalar(t.Elem()) && t.Elem().Kind() != reflect.Slice
+	}
+	return false
+}
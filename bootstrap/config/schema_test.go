@@ -0,0 +1,74 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+	_ "github.com/polarismesh/polaris-sidecar/resolver/dnsagent"
+)
+
+func TestJSONSchema(t *testing.T) {
+	schema := JSONSchema()
+	properties := schema["properties"].(map[string]interface{})
+	recurse := properties["recurse"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "integer", "default": 1}, recurse["timeoutSec"])
+	assert.Equal(t, false, properties["recurse"].(map[string]interface{})["additionalProperties"])
+
+	entry := properties["resolvers"].(map[string]interface{})["items"].(map[string]interface{})
+	conditions := entry["allOf"].([]interface{})
+	assert.NotEmpty(t, conditions)
+	var found bool
+	for _, condition := range conditions {
+		then := condition.(map[string]interface{})["then"].(map[string]interface{})
+		option := then["properties"].(map[string]interface{})["option"].(map[string]interface{})
+		optionProperties := option["properties"].(map[string]interface{})
+		if _, ok := optionProperties["serve_stale"]; ok {
+			found = true
+			assert.NotContains(t, optionProperties, "RouteLabelsMap")
+			assert.Equal(t, false, option["additionalProperties"])
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestParseOptions_unknownKey(t *testing.T) {
+	handler := resolver.NameResolver(resolver.PluginNameDnsAgent)
+	_, err := resolver.ParseOptions(handler, map[string]interface{}{"serve_stael": true})
+	assert.Error(t, err)
+	options, err := resolver.ParseOptions(handler, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, options)
+}
+
+func TestSidecarConfig_mergeEnv_nilOption(t *testing.T) {
+	t.Setenv(EnvSidecarMeshAnswerIp, "10.4.4.5")
+	conf := defaultSidecarConfig()
+	for _, entry := range conf.Resolvers {
+		entry.Option = nil
+	}
+	conf.mergeEnv()
+	for _, entry := range conf.Resolvers {
+		if entry.Name == resolver.PluginNameMeshProxy {
+			assert.Equal(t, "10.4.4.5", entry.Option["dns_answer_ip"])
+		}
+	}
+}
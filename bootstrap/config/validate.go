@@ -0,0 +1,267 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v2"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+// the sources of the config values
+const (
+	sourceDefault      = "default"
+	sourceFile         = "file"
+	sourceFileEnv      = "file+env"
+	sourceConfigCenter = "config_center"
+	sourceEnv          = "env"
+	sourceFlag         = "flag"
+)
+
+// ConfigValue the effective value of the config key and where it comes from
+type ConfigValue struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// ValidationResult the result of the strict validation of the config
+type ValidationResult struct {
+	Config *SidecarConfig
+	Values []*ConfigValue
+	Errors []error
+}
+
+// Validate loads the config like ParseYamlConfig and checks it strictly, such as the unknown keys,
+// the options of the resolvers and the files referenced. The error is returned only when the
+// config could not be loaded, the problems of the config are kept in the result
+func Validate(configFile string, bootConfig *BootConfig) (*ValidationResult, error) {
+	return ValidateRemote(configFile, bootConfig, nil)
+}
+
+// ValidateRemote validates the config like Validate, with the remote content of the config center
+// merged over the config file like ParseRemoteYamlConfig
+func ValidateRemote(configFile string, bootConfig *BootConfig, remote []byte) (*ValidationResult, error) {
+	stages := make(map[string]map[string]string)
+	conf, err := loadConfig(configFile, bootConfig, remote, func(name string, conf *SidecarConfig) {
+		stages[name] = flattenConfig(conf)
+	})
+	if nil != err {
+		return nil, err
+	}
+	result := &ValidationResult{Config: conf}
+	var expanded, raw map[string]string
+	if IsFile(configFile) {
+		content, err := ioutil.ReadFile(configFile)
+		if nil != err {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict([]byte(os.ExpandEnv(string(content))), defaultSidecarConfig()); nil != err {
+			result.Errors = append(result.Errors, fmt.Errorf("unknown or invalid keys: %v", err))
+		}
+		expanded = flattenYaml([]byte(os.ExpandEnv(string(content))))
+		raw = flattenYaml(content)
+	} else {
+		result.Errors = append(result.Errors, fmt.Errorf("config file %s not exists, the default config is used",
+			configFile))
+	}
+	var remoteKeys map[string]string
+	if len(remote) > 0 {
+		if err := yaml.UnmarshalStrict([]byte(os.ExpandEnv(string(remote))), defaultSidecarConfig()); nil != err {
+			result.Errors = append(result.Errors, fmt.Errorf("unknown or invalid keys of config center: %v", err))
+		}
+		remoteKeys = flattenYaml([]byte(os.ExpandEnv(string(remote))))
+	}
+	result.Errors = append(result.Errors, conf.lint()...)
+
+	for key, value := range stages[sourceFlag] {
+		source := sourceDefault
+		switch {
+		case changed(stages[sourceEnv], stages[sourceFlag], key):
+			source = sourceFlag
+		case changed(stages[sourceConfigCenter], stages[sourceEnv], key):
+			source = sourceEnv
+		case hasKey(remoteKeys, key) || changed(stages[sourceFile], stages[sourceConfigCenter], key):
+			source = sourceConfigCenter
+		case hasKey(expanded, key) && raw[key] != expanded[key]:
+			source = sourceFileEnv
+		case hasKey(expanded, key) || changed(stages[sourceDefault], stages[sourceFile], key):
+			source = sourceFile
+		}
+		result.Values = append(result.Values, &ConfigValue{Key: key, Value: value, Source: source})
+	}
+	sort.Slice(result.Values, func(i, j int) bool {
+		return result.Values[i].Key < result.Values[j].Key
+	})
+	return result, nil
+}
+
+// lint returns all the problems of the config, beyond the checks at startup
+func (s *SidecarConfig) lint() []error {
+	var errs []error
+	if err := s.verify(); nil != err {
+		var merr *multierror.Error
+		if errors.As(err, &merr) {
+			errs = append(errs, merr.Errors...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := log.ParseLevel(s.Logger.OutputLevel); len(s.Logger.OutputLevel) > 0 && nil != err {
+		errs = append(errs, fmt.Errorf("logger: %v", err))
+	}
+	for _, address := range s.PolarisConfig.Addresses {
+		if _, _, err := net.SplitHostPort(address); nil != err {
+			errs = append(errs, fmt.Errorf("polaris address %s should be host:port", address))
+		}
+	}
+	if err := s.Listen.Verify(); nil != err {
+		errs = append(errs, fmt.Errorf("listen: %v", err))
+	}
+	if err := s.Resolve.Verify(); nil != err {
+		errs = append(errs, fmt.Errorf("resolve: %v", err))
+	}
+	if err := s.Protection.Verify(); nil != err {
+		errs = append(errs, fmt.Errorf("protection: %v", err))
+	}
+	if s.Recurse.DNSSEC != nil && s.Recurse.DNSSEC.Enable {
+		if err := s.Recurse.DNSSEC.Verify(); nil != err {
+			errs = append(errs, fmt.Errorf("recurse.dnssec: %v", err))
+		}
+	}
+	if s.RateLimit != nil && s.RateLimit.Enable && s.RateLimit.TLSInfo != nil {
+		for _, file := range []string{s.RateLimit.TLSInfo.CertFile, s.RateLimit.TLSInfo.KeyFile} {
+			if len(file) == 0 {
+				continue
+			}
+			if err := resolver.VerifyReadableFile(file); nil != err {
+				errs = append(errs, fmt.Errorf("ratelimit.tls_info: %v", err))
+			}
+		}
+	}
+	if s.RateLimit != nil {
+		if err := s.RateLimit.Verify(); nil != err {
+			errs = append(errs, err)
+		}
+	}
+	plugins := make(map[string]bool)
+	for _, pluginConfig := range s.Plugins {
+		plugins[pluginConfig.Name] = true
+		if len(pluginConfig.Path) == 0 {
+			continue
+		}
+		if err := resolver.VerifyReadableFile(pluginConfig.Path); nil != err {
+			errs = append(errs, fmt.Errorf("plugin %s: %v", pluginConfig.Name, err))
+		}
+	}
+	for _, entry := range s.Resolvers {
+		// the options of the plugins are checked by the plugin binaries
+		if plugins[entry.Name] {
+			continue
+		}
+		handler := resolver.NameResolver(entry.Name)
+		if handler == nil {
+			errs = append(errs, fmt.Errorf("resolver %s is not registered", entry.Name))
+			continue
+		}
+		// the disabled resolvers are checked only when the options are set
+		if !entry.Enable && len(entry.Option) == 0 {
+			continue
+		}
+		options, err := resolver.ParseOptions(handler, entry.Option)
+		if nil != err {
+			errs = append(errs, fmt.Errorf("resolver %s: %v", entry.Name, err))
+			continue
+		}
+		if validator, ok := handler.(resolver.OptionValidator); ok {
+			if err := validator.ValidateOptions(options); nil != err {
+				errs = append(errs, fmt.Errorf("resolver %s: %v", entry.Name, err))
+			}
+		}
+	}
+	return errs
+}
+
+func hasKey(values map[string]string, key string) bool {
+	_, ok := values[key]
+	return ok
+}
+
+func changed(before map[string]string, after map[string]string, key string) bool {
+	value, ok := before[key]
+	return !ok || value != after[key]
+}
+
+// flattenConfig returns the leaf values of the config by the dotted keys
+func flattenConfig(conf *SidecarConfig) map[string]string {
+	content, err := yaml.Marshal(conf)
+	if nil != err {
+		return nil
+	}
+	return flattenYaml(content)
+}
+
+func flattenYaml(content []byte) map[string]string {
+	var tree interface{}
+	if err := yaml.Unmarshal(content, &tree); nil != err {
+		return nil
+	}
+	values := make(map[string]string)
+	flatten("", tree, values)
+	return values
+}
+
+func flatten(prefix string, node interface{}, values map[string]string) {
+	switch value := node.(type) {
+	case map[interface{}]interface{}:
+		if len(value) == 0 {
+			values[prefix] = "{}"
+		}
+		for k, v := range value {
+			key := fmt.Sprint(k)
+			if isSensitive(key) && v != nil && v != "" {
+				v = redactedValue
+			}
+			if len(prefix) > 0 {
+				key = prefix + "." + key
+			}
+			flatten(key, v, values)
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			values[prefix] = "[]"
+		}
+		for i, v := range value {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), v, values)
+		}
+	case nil:
+		values[prefix] = ""
+	default:
+		values[prefix] = strings.TrimSpace(fmt.Sprint(value))
+	}
+}
@@ -0,0 +1,119 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/polarismesh/polaris-sidecar/resolver/dnsagent"
+	_ "github.com/polarismesh/polaris-sidecar/resolver/kubernetes"
+	_ "github.com/polarismesh/polaris-sidecar/resolver/meshproxy"
+)
+
+const validateCfg = `
+bind: ${VALIDATE_BIND}
+port: 53
+unknown_key: 1
+protection:
+  allow_cidrs:
+    - 10.0.0.0/33
+resolvers:
+  - name: dnsagent
+    enable: true
+    option:
+      serve_stael: true
+  - name: nope
+    enable: false
+`
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sidecar.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(validateCfg), 0644))
+	t.Setenv("VALIDATE_BIND", "127.0.0.1")
+	t.Setenv(EnvSidecarRecurseTimeout, "3")
+
+	result, err := Validate(path, &BootConfig{Port: 5353})
+	assert.NoError(t, err)
+	sources := make(map[string]string)
+	for _, value := range result.Values {
+		sources[value.Key] = value.Source + ":" + value.Value
+	}
+	assert.Equal(t, "file+env:127.0.0.1", sources["bind"])
+	assert.Equal(t, "flag:5353", sources["port"])
+	assert.Equal(t, "env:3", sources["recurse.timeoutSec"])
+	assert.Equal(t, "file:dnsagent", sources["resolvers[0].name"])
+	assert.Equal(t, "default:false", sources["recurse.enable"])
+
+	var problems []string
+	for _, problem := range result.Errors {
+		problems = append(problems, problem.Error())
+	}
+	assert.Len(t, problems, 4)
+	assert.Contains(t, problems[0], "field unknown_key not found")
+	assert.Contains(t, problems[1], "invalid protection allow cidr 10.0.0.0/33")
+	assert.Contains(t, problems[2], `unknown field "serve_stael"`)
+	assert.Equal(t, "resolver nope is not registered", problems[3])
+}
+
+func TestValidate_shippedConfig(t *testing.T) {
+	t.Setenv(EnvPolarisAddress, "")
+	result, err := Validate(filepath.Join("..", "..", "polaris-sidecar.yaml"), &BootConfig{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Errors)
+}
+
+func TestValidate_deprecatedAddresses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sidecar.yaml")
+	content := "polaris:\n  adddresses:\n    - 10.0.0.1:8091\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	t.Setenv(EnvPolarisAddress, "")
+
+	result, err := Validate(path, &BootConfig{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	sources := make(map[string]string)
+	for _, value := range result.Values {
+		sources[value.Key] = value.Value
+	}
+	assert.Equal(t, "10.0.0.1:8091", sources["polaris.addresses[0]"])
+	_, ok := sources["polaris.adddresses[0]"]
+	assert.False(t, ok)
+}
+
+func TestValidateRemote(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sidecar.yaml")
+	content := "bind: 127.0.0.1\nrecurse:\n  timeoutSec: 3\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	t.Setenv(EnvSidecarRecurseTimeout, "")
+	remote := []byte("bind: 127.0.0.2\nrecurse:\n  enable: true\n")
+
+	result, err := ValidateRemote(path, &BootConfig{}, remote)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	sources := make(map[string]string)
+	for _, value := range result.Values {
+		sources[value.Key] = value.Source + ":" + value.Value
+	}
+	assert.Equal(t, "config_center:127.0.0.2", sources["bind"])
+	assert.Equal(t, "config_center:true", sources["recurse.enable"])
+	assert.Equal(t, "file:3", sources["recurse.timeoutSec"])
+}
@@ -0,0 +1,155 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package bootstrap
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/polarismesh/polaris-go/pkg/model"
+
+	"github.com/polarismesh/polaris-sidecar/bootstrap/config"
+	"github.com/polarismesh/polaris-sidecar/pkg/client"
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+)
+
+const configCenterRetryInterval = 10 * time.Second
+
+// activeConfig returns the config with the changes of the config center applied
+func (p *Agent) activeConfig() *config.SidecarConfig {
+	p.configLock.RLock()
+	defer p.configLock.RUnlock()
+	if p.liveConfig != nil {
+		return p.liveConfig
+	}
+	return p.config
+}
+
+// fetchRemoteConfig gets the config file of the config center
+func (p *Agent) fetchRemoteConfig() (model.ConfigFile, error) {
+	conf := p.config.ConfigCenter
+	configAPI, err := client.GetConfigAPI()
+	if nil != err {
+		return nil, err
+	}
+	return configAPI.GetConfigFile(conf.Namespace, conf.Group, conf.File)
+}
+
+// loadRemoteConfig merges the config file of the config center over the local config on startup,
+// the local config is used if the config center is unavailable
+func (p *Agent) loadRemoteConfig() {
+	conf := p.config.ConfigCenter
+	if !conf.Enable {
+		return
+	}
+	file, err := p.fetchRemoteConfig()
+	if nil != err {
+		log.Errorf("[agent] fail to get config file %s/%s/%s from config center, use local config, err: %v",
+			conf.Namespace, conf.Group, conf.File, err)
+		return
+	}
+	p.remoteFile = file
+	if !file.HasContent() {
+		log.Infof("[agent] config file %s/%s/%s of config center is empty", conf.Namespace, conf.Group, conf.File)
+		return
+	}
+	next, err := config.ParseRemoteYamlConfig(p.configFile, p.bootConfig, []byte(file.GetContent()))
+	if nil != err {
+		log.Errorf("[agent] fail to parse config of config center, use local config, err: %v", err)
+		return
+	}
+	p.applyLogLevel(p.config, next)
+	p.config = next
+	log.Infof("[agent] merged config of config center, current active config is \n%s", *p.config)
+}
+
+// watchConfigCenter applies the changes of the config file of the config center at runtime
+func (p *Agent) watchConfigCenter(ctx context.Context) {
+	conf := p.config.ConfigCenter
+	for p.remoteFile == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(configCenterRetryInterval):
+		}
+		file, err := p.fetchRemoteConfig()
+		if nil != err {
+			log.Warnf("[agent] fail to get config file %s/%s/%s from config center, err: %v",
+				conf.Namespace, conf.Group, conf.File, err)
+			continue
+		}
+		p.remoteFile = file
+		p.reloadRemoteConfig(file.GetContent())
+	}
+	events := p.remoteFile.AddChangeListenerWithChannel()
+	log.Infof("[agent] watching config file %s/%s/%s of config center", conf.Namespace, conf.Group, conf.File)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			log.Infof("[agent] config file %s/%s/%s of config center changed", conf.Namespace, conf.Group,
+				conf.File)
+			p.reloadRemoteConfig(event.NewValue)
+		}
+	}
+}
+
+// reloadRemoteConfig merges the remote content over the local config and applies the changes could be
+// applied at runtime, which are the log level, the recursion upstreams and the resolver options
+func (p *Agent) reloadRemoteConfig(content string) {
+	next, err := config.ParseRemoteYamlConfig(p.configFile, p.bootConfig, []byte(content))
+	if nil != err {
+		log.Errorf("[agent] fail to parse config of config center, keep current config, err: %v", err)
+		return
+	}
+	current := p.activeConfig()
+	if keys := current.RestartRequired(next); len(keys) > 0 {
+		log.Warnf("[agent] the changed config %v of config center is applied on restart", keys)
+	}
+	p.applyLogLevel(current, next)
+	if p.dnsSvrs != nil {
+		if !reflect.DeepEqual(current.Recurse.NameServers, next.Recurse.NameServers) ||
+			!reflect.DeepEqual(current.Recurse.SearchNames, next.Recurse.SearchNames) {
+			p.dnsSvrs.UpdateUpstreams(next.Recurse.NameServers, next.Recurse.SearchNames)
+		}
+		if err := p.dnsSvrs.UpdateOptions(next.Resolvers); nil != err {
+			log.Errorf("[agent] fail to update resolver options from config center, err: %v", err)
+		}
+	}
+	p.configLock.Lock()
+	p.liveConfig = next
+	p.configLock.Unlock()
+}
+
+// applyLogLevel sets the level of all the log scopes when the output level is changed
+func (p *Agent) applyLogLevel(current *config.SidecarConfig, next *config.SidecarConfig) {
+	if current.Logger.OutputLevel == next.Logger.OutputLevel || len(next.Logger.OutputLevel) == 0 {
+		return
+	}
+	level, err := log.ParseLevel(next.Logger.OutputLevel)
+	if nil != err {
+		log.Errorf("[agent] invalid log level %s of config center, err: %v", next.Logger.OutputLevel, err)
+		return
+	}
+	for name, scope := range log.Scopes() {
+		scope.SetOutputLevel(level)
+		log.Infof("[agent] log level of scope %s is set to %s by config center", name, level)
+	}
+}
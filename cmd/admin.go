@@ -0,0 +1,319 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/polarismesh/polaris-sidecar/bootstrap/config"
+	"github.com/polarismesh/polaris-sidecar/pkg/admin"
+	"github.com/polarismesh/polaris-sidecar/security/mtls/certificate"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var (
+	adminAddress   string
+	adminTimeout   time.Duration
+	outputFormat   string
+	lookupListener string
+
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "show the status of the running sidecar",
+		Long:  "show the version, the listeners, the resolvers and the enabled features of the running sidecar",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			status, err := newAdminClient().Status()
+			if err != nil {
+				return err
+			}
+			return render(status, func(w io.Writer) {
+				fmt.Fprintf(w, "VERSION\t%s\n", status.Version)
+				fmt.Fprintf(w, "STARTED\t%s (%s ago)\n", status.StartTime.Format(time.RFC3339), status.Uptime)
+				fmt.Fprintf(w, "LISTENERS\t%s\n", strings.Join(status.Listeners, ", "))
+				fmt.Fprintf(w, "RESOLVERS\t%s\n", strings.Join(status.Resolvers, ", "))
+				features := make([]string, 0, len(status.Features))
+				for feature, enabled := range status.Features {
+					if enabled {
+						features = append(features, feature)
+					}
+				}
+				sort.Strings(features)
+				fmt.Fprintf(w, "FEATURES\t%s\n", strings.Join(features, ", "))
+			})
+		},
+	}
+
+	resolveCmd = &cobra.Command{
+		Use:   "resolve <name> [type]",
+		Short: "resolve the name by the sidecar resolvers",
+		Long: "resolve the name by the resolvers of the running sidecar and show which resolver answers it and why, " +
+			"the name is never sent to the recursors",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			qtype := ""
+			if len(args) > 1 {
+				qtype = args[1]
+			}
+			trace, err := newAdminClient().Lookup(lookupListener, args[0], qtype)
+			if err != nil {
+				return err
+			}
+			return render(trace, func(w io.Writer) {
+				fmt.Fprintf(w, "NAME\t%s %s (listener %s, preprocessed %s)\n",
+					trace.Name, trace.Type, trace.Listener, trace.Preprocessed)
+				fmt.Fprintln(w, "\nRESOLVER\tZONE\tRESULT\tREASON")
+				for _, step := range trace.Steps {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.Resolver, step.Zone, step.Result, step.Reason)
+				}
+				fmt.Fprintln(w)
+				fmt.Fprintf(w, "RESULT\t%s\n", trace.Result)
+				if len(trace.AnsweredBy) > 0 {
+					fmt.Fprintf(w, "ANSWERED BY\t%s\n", trace.AnsweredBy)
+				}
+				if len(trace.Reason) > 0 {
+					fmt.Fprintf(w, "REASON\t%s\n", trace.Reason)
+				}
+				if len(trace.Rcode) > 0 {
+					fmt.Fprintf(w, "RCODE\t%s\n", trace.Rcode)
+				}
+				if len(trace.Recursors) > 0 {
+					fmt.Fprintf(w, "RECURSORS\t%s\n", strings.Join(trace.Recursors, ", "))
+				}
+				for _, answer := range trace.Answer {
+					fmt.Fprintf(w, "ANSWER\t%s\n", strings.ReplaceAll(answer, "\t", " "))
+				}
+			})
+		},
+	}
+
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "inspect the config of the running sidecar",
+		Long:  "inspect the config of the running sidecar",
+	}
+
+	configDumpCmd = &cobra.Command{
+		Use:   "dump",
+		Short: "dump the effective config, the secrets are redacted",
+		Long:  "dump the effective config merged from the file, the env and the flags, the secrets are redacted",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			conf, err := newAdminClient().Config()
+			if err != nil {
+				return err
+			}
+			if outputFormat == outputJSON {
+				return printJSON(conf)
+			}
+			content, err := yaml.Marshal(conf)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(content)
+			return err
+		},
+	}
+
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "manage the caches of the running sidecar",
+		Long:  "manage the caches of the running sidecar",
+	}
+
+	cacheFlushCmd = &cobra.Command{
+		Use:   "flush",
+		Short: "flush the cached answers and the dnssec keys",
+		Long:  "flush the cached answers and the dnssec keys",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			resp, err := newAdminClient().FlushCache()
+			if err != nil {
+				return err
+			}
+			return render(resp, func(w io.Writer) {
+				fmt.Fprintln(w, "CACHE\tFLUSHED")
+				names := make([]string, 0, len(resp.Flushed))
+				for name := range resp.Flushed {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Fprintf(w, "%s\t%d\n", name, resp.Flushed[name])
+				}
+			})
+		},
+	}
+
+	logLevelCmd = &cobra.Command{
+		Use:   "log-level [scope] [level]",
+		Short: "show or set the log level of the scopes",
+		Long: "show the log level of all the scopes or the given scope, or set the log level of the scope, " +
+			"the scope all sets every scope",
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			client := newAdminClient()
+			scope := ""
+			if len(args) > 0 && args[0] != "all" {
+				scope = args[0]
+			}
+			var levels []*admin.LogLevel
+			var err error
+			if len(args) == 2 {
+				levels, err = client.SetLogLevel(scope, args[1])
+			} else {
+				levels, err = client.LogLevels(scope)
+			}
+			if err != nil {
+				return err
+			}
+			return render(levels, func(w io.Writer) {
+				fmt.Fprintln(w, "SCOPE\tLEVEL")
+				for _, level := range levels {
+					fmt.Fprintf(w, "%s\t%s\n", level.Scope, level.Level)
+				}
+			})
+		},
+	}
+
+	certCmd = &cobra.Command{
+		Use:   "cert",
+		Short: "inspect the mtls certificate of the running sidecar",
+		Long:  "inspect the mtls certificate of the running sidecar",
+	}
+
+	certShowCmd = &cobra.Command{
+		Use:   "show",
+		Short: "show the workload certificate and the root ca",
+		Long:  "show the workload certificate and the root ca, the private key is never shown",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			info, err := newAdminClient().Certificate()
+			if err != nil {
+				return err
+			}
+			return render(info, func(w io.Writer) {
+				fmt.Fprintln(w, "ROLE\tSUBJECT\tURIS\tNOT AFTER\tSERIAL")
+				printCert := func(role string, cert *certificate.Info) {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", role, cert.Subject, strings.Join(cert.URIs, ","),
+						cert.NotAfter.Format(time.RFC3339), cert.SerialNo)
+				}
+				if info.Leaf != nil {
+					printCert("leaf", info.Leaf)
+				}
+				for _, cert := range info.Chain {
+					printCert("intermediate", cert)
+				}
+				for _, cert := range info.RootCA {
+					printCert("root", cert)
+				}
+			})
+		},
+	}
+)
+
+func newAdminClient() *admin.Client {
+	return admin.NewClient(adminAddress, adminTimeout)
+}
+
+// render prints the value as json, or as the table written by table
+func render(value interface{}, table func(w io.Writer)) error {
+	switch outputFormat {
+	case outputJSON:
+		return printJSON(value)
+	case outputTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown output format %s, should be table or json", outputFormat)
+}
+
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// debuggerAddress returns the address of the debugger in the sidecar config, which serves the admin api
+// to the local clients only
+func debuggerAddress(configFile string) (string, error) {
+	quietLogs()
+	sidecarConfig, err := config.ParseYamlConfig(configFile, &config.BootConfig{})
+	if err != nil {
+		return "", fmt.Errorf("fail to load config %s: %v", configFile, err)
+	}
+	if !sidecarConfig.Debugger.Enable {
+		return "", fmt.Errorf("debugger is disabled in config %s, the admin api is served on the debugger port "+
+			"when debugger.enable is true", configFile)
+	}
+	host := sidecarConfig.Bind
+	if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(sidecarConfig.Debugger.Port))), nil
+}
+
+// addAdminFlags adds the flags of the commands calling the admin api, the admin address defaults to
+// the debugger address of the config file
+func addAdminFlags(c *cobra.Command) {
+	c.PersistentFlags().StringVarP(&adminAddress, "admin", "a", "",
+		"admin api address of the running sidecar, default to the debugger address of the config file, "+
+			"the debugger should be enabled")
+	c.PersistentFlags().StringVarP(
+		&configFilePath, "config-file", "c", "polaris-sidecar.yaml", "config file path")
+	c.PersistentPreRunE = func(*cobra.Command, []string) error {
+		if len(adminAddress) > 0 {
+			return nil
+		}
+		address, err := debuggerAddress(configFilePath)
+		if err != nil {
+			return err
+		}
+		adminAddress = address
+		return nil
+	}
+	c.PersistentFlags().DurationVar(&adminTimeout, "timeout", 10*time.Second, "timeout of the admin api request")
+	c.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "output format, table or json")
+}
+
+func init() {
+	resolveCmd.Flags().StringVar(&lookupListener, "listener", "", "name of the dns listener, default to the first")
+	configCmd.AddCommand(configDumpCmd)
+	cacheCmd.AddCommand(cacheFlushCmd)
+	certCmd.AddCommand(certShowCmd)
+	for _, c := range []*cobra.Command{statusCmd, resolveCmd, configCmd, cacheCmd, logLevelCmd, certCmd} {
+		addAdminFlags(c)
+	}
+}
@@ -0,0 +1,120 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/polarismesh/polaris-sidecar/bootstrap/config"
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/redirect"
+)
+
+var (
+	redirectDryRun  bool
+	redirectBackend string
+	redirectPort    int
+	redirectAppUIDs []int
+	redirectNetns   string
+
+	redirectCmd = &cobra.Command{
+		Use:   "redirect",
+		Short: "manage the dns redirect rules",
+		Long:  "install or remove the iptables/nftables rules redirecting the dns queries to the sidecar",
+	}
+
+	redirectInstallCmd = &cobra.Command{
+		Use:   "install",
+		Short: "install the redirect rules",
+		Long:  "install the redirect rules",
+		RunE: func(c *cobra.Command, args []string) error {
+			manager, err := newRedirectManager(c)
+			if err != nil {
+				return err
+			}
+			return manager.Install()
+		},
+	}
+
+	redirectUninstallCmd = &cobra.Command{
+		Use:   "uninstall",
+		Short: "remove the redirect rules",
+		Long:  "remove the redirect rules",
+		RunE: func(c *cobra.Command, args []string) error {
+			manager, err := newRedirectManager(c)
+			if err != nil {
+				return err
+			}
+			return manager.Uninstall()
+		},
+	}
+)
+
+// quietLogs keeps the output of the commands clean, only the warnings and errors are logged
+func quietLogs() {
+	for _, scope := range log.Scopes() {
+		scope.SetOutputLevel(log.WarnLevel)
+	}
+}
+
+func newRedirectManager(c *cobra.Command) (*redirect.Manager, error) {
+	quietLogs()
+	sidecarConfig, err := config.ParseYamlConfig(configFilePath, &config.BootConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("fail to load config %s: %v", configFilePath, err)
+	}
+	conf := sidecarConfig.RedirectConfig()
+	if c.Flags().Changed("backend") {
+		conf.Backend = redirectBackend
+	}
+	if c.Flags().Changed("port") {
+		conf.Port = redirectPort
+	}
+	if c.Flags().Changed("uid") {
+		conf.AppUIDs = redirectAppUIDs
+	}
+	if c.Flags().Changed("netns") {
+		conf.Netns = redirectNetns
+	}
+	var runner redirect.Runner
+	if redirectDryRun {
+		runner = redirect.DryRunner{Out: os.Stdout}
+	}
+	return redirect.NewManager(conf, runner)
+}
+
+func init() {
+	redirectCmd.PersistentFlags().StringVarP(
+		&configFilePath, "config-file", "c", "polaris-sidecar.yaml", "config file path")
+	redirectCmd.PersistentFlags().BoolVar(
+		&redirectDryRun, "dry-run", false, "print the rule commands instead of running them")
+	redirectCmd.PersistentFlags().StringVar(
+		&redirectBackend, "backend", redirect.BackendAuto, "iptables, nftables or auto")
+	redirectCmd.PersistentFlags().IntVarP(
+		&redirectPort, "port", "p", 0, "sidecar dns port the queries are redirected to")
+	redirectCmd.PersistentFlags().IntSliceVar(
+		&redirectAppUIDs, "uid", nil, "redirect only the queries of the app uids")
+	redirectCmd.PersistentFlags().StringVar(
+		&redirectNetns, "netns", "", "network namespace path to install the rules in")
+
+	redirectCmd.AddCommand(redirectInstallCmd)
+	redirectCmd.AddCommand(redirectUninstallCmd)
+}
@@ -36,6 +36,15 @@ var (
 func init() {
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(redirectCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(resolveCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(logLevelCmd)
+	rootCmd.AddCommand(certCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(schemaCmd)
 }
 
 /**
@@ -0,0 +1,37 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/polarismesh/polaris-sidecar/bootstrap/config"
+)
+
+var (
+	schemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "print the json schema of the config",
+		Long: "print the json schema of the config, which is used by the editors for the completion " +
+			"and the validation of polaris-sidecar.yaml",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			return printJSON(config.JSONSchema())
+		},
+	}
+)
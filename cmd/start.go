@@ -44,27 +44,32 @@ var (
  * @brief 解析命令参数
  */
 func init() {
-	startCmd.PersistentFlags().StringVarP(
+	addBootFlags(startCmd)
+}
+
+// addBootFlags adds the config file and the flags overriding the config
+func addBootFlags(c *cobra.Command) {
+	c.PersistentFlags().StringVarP(
 		&configFilePath, "config-file", "c", "polaris-sidecar.yaml", "config file path")
 
-	startCmd.PersistentFlags().StringVarP(
+	c.PersistentFlags().StringVarP(
 		&bootConfig.Bind, "bind", "b", "", "polaris sidecar bind host")
 
-	startCmd.PersistentFlags().IntVarP(
+	c.PersistentFlags().IntVarP(
 		&bootConfig.Port, "port", "p", 0, "polaris sidecar listen port")
 
-	startCmd.PersistentFlags().StringVarP(
+	c.PersistentFlags().StringVarP(
 		&bootConfig.LogLevel, "log-level", "l", "", "polaris sidecar logger level")
 
-	startCmd.PersistentFlags().StringVarP(&bootConfig.RecurseEnabled,
+	c.PersistentFlags().StringVarP(&bootConfig.RecurseEnabled,
 		"recurse-enabled", "r", "", "polaris sidecar recurse enabled")
 
-	startCmd.PersistentFlags().StringVarP(&bootConfig.ResolverDnsAgentEnabled,
+	c.PersistentFlags().StringVarP(&bootConfig.ResolverDnsAgentEnabled,
 		"dnsagent-enabled", "d", "", "polaris sidecar resolver dnsagent enabled")
 
-	startCmd.PersistentFlags().StringVarP(&bootConfig.ResolverDnsAgentRouteLabels,
+	c.PersistentFlags().StringVarP(&bootConfig.ResolverDnsAgentRouteLabels,
 		"dnsagent-route-labels", "o", "", "polaris sidecar resolver dnsagent route lables")
 
-	startCmd.PersistentFlags().StringVarP(&bootConfig.ResolverMeshProxyEnabled,
+	c.PersistentFlags().StringVarP(&bootConfig.ResolverMeshProxyEnabled,
 		"meshproxy-enabled", "m", "", "polaris sidecar resolver mesh proxy enabled")
 }
@@ -0,0 +1,87 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/polarismesh/polaris-sidecar/bootstrap/config"
+)
+
+var (
+	configCenterFile string
+
+	validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "validate the config",
+		Long: "load the config like start does, check it strictly and print the effective config " +
+			"with the source of each value",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			quietLogs()
+			var remote []byte
+			if len(configCenterFile) > 0 {
+				content, err := os.ReadFile(configCenterFile)
+				if err != nil {
+					return err
+				}
+				remote = content
+			}
+			result, err := config.ValidateRemote(configFilePath, &bootConfig, remote)
+			if err != nil {
+				return err
+			}
+			problems := make([]string, 0, len(result.Errors))
+			for _, problem := range result.Errors {
+				problems = append(problems, problem.Error())
+			}
+			output := struct {
+				Valid    bool                  `json:"valid"`
+				Problems []string              `json:"problems"`
+				Values   []*config.ConfigValue `json:"values"`
+			}{Valid: len(problems) == 0, Problems: problems, Values: result.Values}
+			if err := render(output, func(w io.Writer) {
+				fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+				for _, value := range result.Values {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", value.Key, value.Value, value.Source)
+				}
+				fmt.Fprintln(w)
+				for _, problem := range problems {
+					fmt.Fprintf(w, "PROBLEM\t%s\n", problem)
+				}
+			}); err != nil {
+				return err
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("config %s has %d problems", configFilePath, len(problems))
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	addBootFlags(validateCmd)
+	validateCmd.Flags().StringVar(&outputFormat, "output", outputTable, "output format, table or json")
+	validateCmd.Flags().StringVar(&configCenterFile, "config-center-file", "",
+		"content of the config center file merged over the config file")
+}
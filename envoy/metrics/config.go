@@ -22,7 +22,7 @@ import "time"
 type MetricConfig struct {
 	// to enable the metrics server
 	Enable bool `yaml:"enable"`
-	// port listen for metric message
+	// port listen for metric message, the metrics of the sidecar and the polaris sdk are served at /metrics
 	Port int `yaml:"port"`
 	// Type metrics data report type pull/push
 	Type string `yaml:"type"`
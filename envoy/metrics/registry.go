@@ -0,0 +1,127 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/polarismesh/polaris-go/pkg/plugin/common"
+	sdkprometheus "github.com/polarismesh/polaris-go/plugin/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/client"
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+)
+
+const (
+	// MetricsPath the path of the metrics served on the metrics port
+	MetricsPath = "/metrics"
+	// SDKMetricsIP the address the polaris sdk serves its metrics on when the metric server is enabled,
+	// the metric server merges them into the metrics served on the metrics port
+	SDKMetricsIP = "127.0.0.1"
+	// TypePush the metrics are pushed to the pushgateway by the polaris sdk
+	TypePush = "push"
+)
+
+var sdkMetricsClient = &http.Client{Timeout: 5 * time.Second}
+
+// Register registers the collectors of the sidecar with the registry served on the metrics port
+func (s *Server) Register(collectors ...prometheus.Collector) error {
+	for _, collector := range collectors {
+		if err := s.registry.Register(collector); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// serve serves the metrics of the sidecar and of the polaris sdk until the context is done
+func (s *Server) serve(ctx context.Context) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.bind, s.port))
+	if nil != err {
+		return err
+	}
+	svr := &http.Server{Handler: s.handler()}
+	go func() {
+		<-ctx.Done()
+		_ = svr.Close()
+	}()
+	log.Infof("[Metric] serve metrics on %s%s", ln.Addr(), MetricsPath)
+	if err := svr.Serve(ln); nil != err && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// handler serves the metrics of the registry merged with the metrics of the polaris sdk, the metrics
+// of the registry are still served when the sdk metrics fail to be read
+func (s *Server) handler() http.Handler {
+	gatherer := prometheus.Gatherers{s.registry, prometheus.GathererFunc(s.gatherSDK)}
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+	return mux
+}
+
+// gatherSDK reads the metrics the polaris sdk serves on the loopback address
+func (s *Server) gatherSDK() ([]*dto.MetricFamily, error) {
+	port := s.sdkPort()
+	if port == 0 {
+		return nil, nil
+	}
+	resp, err := s.httpClient.Get(fmt.Sprintf("http://%s:%d%s", SDKMetricsIP, port, MetricsPath))
+	if nil != err {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if nil != err {
+		return nil, err
+	}
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		result = append(result, family)
+	}
+	return result, nil
+}
+
+// sdkMetricsPort returns the port the polaris sdk serves its metrics on, 0 if not served
+func sdkMetricsPort() uint32 {
+	if client.SDKContext == nil {
+		return 0
+	}
+	reporter, err := client.SDKContext.GetPlugins().GetPlugin(common.TypeStatReporter, sdkprometheus.PluginName)
+	if nil != err {
+		return 0
+	}
+	info, ok := reporter.(interface{ Info() model.StatInfo })
+	if !ok {
+		return 0
+	}
+	return info.Info().Port
+}
@@ -0,0 +1,63 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package metrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_handler(t *testing.T) {
+	sdk := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "# TYPE sdk_upstream_requests gauge\nsdk_upstream_requests 3\n")
+	}))
+	defer sdk.Close()
+	_, port, err := net.SplitHostPort(sdk.Listener.Addr().String())
+	assert.NoError(t, err)
+
+	s := NewServer("default", "127.0.0.1", 0)
+	s.sdkPort = func() uint32 {
+		value, _ := net.LookupPort("tcp", port)
+		return uint32(value)
+	}
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "sidecar_requests_total", Help: "requests"})
+	counter.Inc()
+	assert.NoError(t, s.Register(counter))
+	assert.Error(t, s.Register(counter))
+
+	body := func() string {
+		rec := httptest.NewRecorder()
+		s.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, MetricsPath, nil))
+		return rec.Body.String()
+	}
+	content := body()
+	assert.Contains(t, content, "sidecar_requests_total 1")
+	assert.Contains(t, content, "sdk_upstream_requests 3")
+
+	// the sidecar metrics are served when the sdk metrics are unreachable
+	sdk.Close()
+	content = body()
+	assert.Contains(t, content, "sidecar_requests_total 1")
+	assert.NotContains(t, content, "sdk_upstream_requests")
+}
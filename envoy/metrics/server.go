@@ -34,21 +34,31 @@ import (
 	"github.com/polarismesh/polaris-go/pkg/model"
 	"github.com/polarismesh/polaris-go/pkg/model/pb"
 	"github.com/polarismesh/specification/source/go/api/v1/service_manage"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/polarismesh/polaris-sidecar/pkg/client"
 	"github.com/polarismesh/polaris-sidecar/pkg/log"
 )
 
 type Server struct {
+	bind      string
 	port      int
 	consumer  polaris.ConsumerAPI
 	namespace string
+	// registry the metrics of the sidecar, served on the port with the metrics of the polaris sdk
+	registry   *prometheus.Registry
+	sdkPort    func() uint32
+	httpClient *http.Client
 }
 
-func NewServer(namespace string, port int) *Server {
+func NewServer(namespace string, bind string, port int) *Server {
 	srv := &Server{
-		namespace: namespace,
-		port:      port,
+		namespace:  namespace,
+		bind:       bind,
+		port:       port,
+		registry:   prometheus.NewRegistry(),
+		sdkPort:    sdkMetricsPort,
+		httpClient: sdkMetricsClient,
 	}
 	return srv
 }
@@ -61,6 +71,10 @@ func (s *Server) Start(ctx context.Context) error {
 	if nil != err {
 		return err
 	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.serve(ctx)
+	}()
 	ticker := time.NewTicker(ticketDuration)
 	defer ticker.Stop()
 	values := make(map[InstanceMetricKey]*InstanceMetricValue)
@@ -68,6 +82,9 @@ func (s *Server) Start(ctx context.Context) error {
 		select {
 		case <-ticker.C:
 			s.reportMetricByCluster(values)
+		case err := <-errCh:
+			s.consumer.Destroy()
+			return err
 		case <-ctx.Done():
 			log.Errorf("Server metric service stopped")
 			s.consumer.Destroy()
@@ -17,18 +17,67 @@
 
 package rls
 
+import "fmt"
+
 type Config struct {
 	Enable   bool     `yaml:"enable"`
 	Network  string   `yaml:"network"`
 	Address  string   `yaml:"address"`
 	BindPort uint32   `yaml:"port"`
 	TLSInfo  *TLSInfo `yaml:"tls_info"`
+	// Mapping maps the rate limit requests of envoy to the polaris quota requests
+	Mapping *MappingConfig `yaml:"mapping"`
+	// FailurePolicy answers the descriptors OK with fail_open, or OVER_LIMIT with fail_closed,
+	// when the quota could not be acquired from polaris
+	FailurePolicy string `yaml:"failure_policy"`
+	// Shadow acquires the quotas and logs the requests over limit, but always answers OK
+	Shadow bool `yaml:"shadow"`
+	// Domains the domains rate limited, the requests of the other domains are answered OK
+	// without acquiring the quotas. All the domains are rate limited when empty
+	Domains []string `yaml:"domains"`
+	// Local the limits enforced in the sidecar, as the fallback of polaris or instead of it
+	Local []*LocalLimitConfig `yaml:"local"`
+	// DecisionLogSampleRate the ratio of the decisions logged, from 0 to 1, 0 logs none
+	DecisionLogSampleRate float64 `yaml:"decision_log_sample_rate"`
 }
 
+const (
+	// FailOpen answers OK when the quota could not be acquired
+	FailOpen = "fail_open"
+	// FailClosed answers OVER_LIMIT when the quota could not be acquired
+	FailClosed = "fail_closed"
+)
+
 func (c *Config) init() {
 	if c.Network == "unix" && c.Address == "" {
 		c.Address = DefaultRLSAddress
 	}
+	if len(c.FailurePolicy) == 0 {
+		c.FailurePolicy = FailOpen
+	}
+}
+
+// Verify checks the rate limit config
+func (c *Config) Verify() error {
+	switch c.FailurePolicy {
+	case "", FailOpen, FailClosed:
+	default:
+		return fmt.Errorf("ratelimit.failure_policy %s should be %s or %s", c.FailurePolicy, FailOpen, FailClosed)
+	}
+	for idx, domain := range c.Domains {
+		if len(domain) == 0 {
+			return fmt.Errorf("ratelimit.domains %d is empty", idx)
+		}
+	}
+	if c.DecisionLogSampleRate < 0 || c.DecisionLogSampleRate > 1 {
+		return fmt.Errorf("ratelimit.decision_log_sample_rate should between 0 and 1")
+	}
+	for _, limit := range c.Local {
+		if err := limit.Verify(); err != nil {
+			return err
+		}
+	}
+	return c.Mapping.Verify()
 }
 
 const DefaultRLSAddress = "/tmp/polaris-sidecar/ratelimit/rls.sock"
@@ -38,7 +87,7 @@ type TLSInfo struct {
 	// CertFile 服务端证书文件
 	CertFile string `yaml:"cert_file"`
 	// KeyFile CertFile 的密钥 key 文件
-	KeyFile string `yaml"json:"key_file"`
+	KeyFile string `yaml:"key_file"`
 }
 
 // IsEmpty 检查 tls 配置信息是否为空 当证书和密钥同时存在时才不为空
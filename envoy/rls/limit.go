@@ -0,0 +1,271 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package rls
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/polarismesh/polaris-go"
+	"github.com/polarismesh/polaris-go/api"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	apimodel "github.com/polarismesh/specification/source/go/api/v1/model"
+	apitraffic "github.com/polarismesh/specification/source/go/api/v1/traffic_manage"
+)
+
+const matchAll = "*"
+
+// ruleGetter returns the rate limit rules of the service
+type ruleGetter func(namespace string, service string) (*apitraffic.RateLimit, error)
+
+// sdkRules returns the rate limit rules from the cache of the polaris sdk
+func sdkRules(sdkCtx api.SDKContext) ruleGetter {
+	return func(namespace string, service string) (*apitraffic.RateLimit, error) {
+		resp, err := sdkCtx.GetEngine().SyncGetServiceRule(model.EventRateLimiting,
+			&model.GetServiceRuleRequest{Namespace: namespace, Service: service})
+		if err != nil {
+			return nil, err
+		}
+		rules, _ := resp.Value.(*apitraffic.RateLimit)
+		return rules, nil
+	}
+}
+
+// amountLimit the tightest amount of the rules matching the descriptor
+type amountLimit struct {
+	max      uint32
+	duration time.Duration
+	// global the amount belongs to a global rule, whose usage is counted by the polaris server
+	// across all the sidecars
+	global bool
+}
+
+// rateLimit returns the limit reported to envoy, the duration not equal to a unit is scaled to
+// the smallest unit longer than it
+func (l *amountLimit) rateLimit() *pb.RateLimitResponse_RateLimit {
+	units := []struct {
+		unit     pb.RateLimitResponse_RateLimit_Unit
+		duration time.Duration
+	}{
+		{pb.RateLimitResponse_RateLimit_SECOND, time.Second},
+		{pb.RateLimitResponse_RateLimit_MINUTE, time.Minute},
+		{pb.RateLimitResponse_RateLimit_HOUR, time.Hour},
+		{pb.RateLimitResponse_RateLimit_DAY, 24 * time.Hour},
+	}
+	for _, unit := range units {
+		if l.duration <= unit.duration {
+			return &pb.RateLimitResponse_RateLimit{
+				RequestsPerUnit: uint32(uint64(l.max) * uint64(unit.duration) / uint64(l.duration)),
+				Unit:            unit.unit,
+			}
+		}
+	}
+	return &pb.RateLimitResponse_RateLimit{RequestsPerUnit: l.max, Unit: pb.RateLimitResponse_RateLimit_UNKNOWN}
+}
+
+// limitLookup finds the limit of the descriptor in the rules, as the quota result of
+// the polaris sdk carries no limit
+type limitLookup struct {
+	rules   ruleGetter
+	regexes sync.Map
+}
+
+// lookup returns the tightest amount of the enabled rules matching the target, nil if none matches
+func (l *limitLookup) lookup(target *quotaTarget) *amountLimit {
+	if l.rules == nil {
+		return nil
+	}
+	rateLimit, err := l.rules(target.namespace, target.service)
+	if err != nil || rateLimit == nil {
+		return nil
+	}
+	arguments := make(map[int]map[string]string)
+	for _, argument := range target.arguments {
+		values, ok := arguments[argument.ArgumentType()]
+		if !ok {
+			values = make(map[string]string)
+			arguments[argument.ArgumentType()] = values
+		}
+		values[argument.Key()] = argument.Value()
+	}
+	var tightest *amountLimit
+	for _, rule := range rateLimit.GetRules() {
+		if rule.GetDisable().GetValue() || len(rule.GetAmounts()) == 0 {
+			continue
+		}
+		if rule.GetMethod() != nil && !l.match(rule.GetMethod(), target.method) {
+			continue
+		}
+		if !l.matchArguments(rule.GetArguments(), arguments) {
+			continue
+		}
+		for _, amount := range rule.GetAmounts() {
+			duration := amount.GetValidDuration().AsDuration()
+			if duration <= 0 {
+				continue
+			}
+			limit := &amountLimit{max: amount.GetMaxAmount().GetValue(), duration: duration,
+				global: rule.GetType() == apitraffic.Rule_GLOBAL}
+			if tightest == nil || float64(limit.max)/float64(limit.duration) <
+				float64(tightest.max)/float64(tightest.duration) {
+				tightest = limit
+			}
+		}
+	}
+	return tightest
+}
+
+func (l *limitLookup) matchArguments(matchers []*apitraffic.MatchArgument, arguments map[int]map[string]string) bool {
+	for _, matcher := range matchers {
+		values := arguments[int(matcher.GetType())]
+		var value string
+		var ok bool
+		switch matcher.GetType() {
+		case apitraffic.MatchArgument_METHOD, apitraffic.MatchArgument_CALLER_IP:
+			for _, v := range values {
+				value, ok = v, true
+			}
+		default:
+			value, ok = values[matcher.GetKey()]
+		}
+		if !ok || !l.match(matcher.GetValue(), value) {
+			return false
+		}
+	}
+	return true
+}
+
+// match checks the value like the polaris sdk does
+func (l *limitLookup) match(matcher *apimodel.MatchString, value string) bool {
+	expected := matcher.GetValue().GetValue()
+	if len(expected) == 0 || expected == matchAll {
+		return true
+	}
+	switch matcher.GetType() {
+	case apimodel.MatchString_EXACT:
+		return value == expected
+	case apimodel.MatchString_REGEX:
+		regex, ok := l.regexes.Load(expected)
+		if !ok {
+			compiled, err := regexp.Compile(expected)
+			if err != nil {
+				return false
+			}
+			regex, _ = l.regexes.LoadOrStore(expected, compiled)
+		}
+		return regex.(*regexp.Regexp).MatchString(value)
+	case apimodel.MatchString_NOT_EQUALS:
+		return value != expected
+	case apimodel.MatchString_IN:
+		return containsToken(expected, value)
+	case apimodel.MatchString_NOT_IN:
+		return !containsToken(expected, value)
+	}
+	return false
+}
+
+func containsToken(tokens string, value string) bool {
+	for _, token := range strings.Split(tokens, ",") {
+		if token == value {
+			return true
+		}
+	}
+	return false
+}
+
+// usageWindows counts the hits allowed by this sidecar in the windows aligned to the limit
+// duration, which gives the remaining and the reset time of the limit reported to envoy
+type usageWindows struct {
+	lock    sync.Mutex
+	windows map[string]*usageWindow
+}
+
+type usageWindow struct {
+	end  time.Time
+	used uint32
+}
+
+func newUsageWindows() *usageWindows {
+	return &usageWindows{windows: make(map[string]*usageWindow)}
+}
+
+// hit records the hits of the target in the current window, returns the remaining of the limit
+// and the duration until the window resets
+func (u *usageWindows) hit(target *quotaTarget, limit *amountLimit, hits uint32, now time.Time) (uint32,
+	time.Duration) {
+	key := fmt.Sprintf("%s|%s", target.key(), limit.duration)
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	window, ok := u.windows[key]
+	if !ok || !now.Before(window.end) {
+		window = &usageWindow{end: now.Truncate(limit.duration).Add(limit.duration)}
+		u.windows[key] = window
+	}
+	window.used += hits
+	var remaining uint32
+	if window.used < limit.max {
+		remaining = limit.max - window.used
+	}
+	return remaining, window.end.Sub(now)
+}
+
+// expire removes the windows ended
+func (u *usageWindows) expire(now time.Time) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for key, window := range u.windows {
+		if !now.Before(window.end) {
+			delete(u.windows, key)
+		}
+	}
+}
+
+// quotaTarget the polaris service and the arguments the descriptor is limited by
+type quotaTarget struct {
+	namespace string
+	service   string
+	method    string
+	arguments []model.Argument
+}
+
+// quotaRequest builds the polaris quota request acquiring the hits
+func (t *quotaTarget) quotaRequest(acquireQuota uint32) polaris.QuotaRequest {
+	req := polaris.NewQuotaRequest()
+	req.SetNamespace(t.namespace)
+	req.SetService(t.service)
+	req.SetMethod(t.method)
+	for _, argument := range t.arguments {
+		req.AddArgument(argument)
+	}
+	req.SetToken(acquireQuota)
+	return req
+}
+
+func (t *quotaTarget) key() string {
+	values := make([]string, 0, len(t.arguments))
+	for _, argument := range t.arguments {
+		values = append(values, argument.String())
+	}
+	sort.Strings(values)
+	return fmt.Sprintf("%s/%s/%s/%s", t.namespace, t.service, t.method, strings.Join(values, ","))
+}
@@ -0,0 +1,222 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package rls
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// LocalFallback the local limit applies when the quota could not be acquired from polaris
+	LocalFallback = "fallback"
+	// LocalPrimary the local limit applies instead of polaris
+	LocalPrimary = "primary"
+
+	// bucketIdleTimeout the buckets idle longer than it are released
+	bucketIdleTimeout = 10 * time.Minute
+)
+
+type localUnit struct {
+	unit     pb.RateLimitResponse_RateLimit_Unit
+	duration time.Duration
+}
+
+var localUnits = map[string]localUnit{
+	"second": {pb.RateLimitResponse_RateLimit_SECOND, time.Second},
+	"minute": {pb.RateLimitResponse_RateLimit_MINUTE, time.Minute},
+	"hour":   {pb.RateLimitResponse_RateLimit_HOUR, time.Hour},
+	"day":    {pb.RateLimitResponse_RateLimit_DAY, 24 * time.Hour},
+}
+
+// LocalLimitConfig a limit enforced in the sidecar, the buckets are in the process so that the
+// counts are shared by all the envoy workers of the pod
+type LocalLimitConfig struct {
+	Domain string `yaml:"domain"`
+	// Entries the entries of the descriptor limited, the descriptor should have exactly the keys.
+	// The entry without value matches any value, and each value has a bucket of its own
+	Entries []*LocalEntry `yaml:"entries"`
+	// RequestsPerUnit the requests allowed in the unit
+	RequestsPerUnit uint32 `yaml:"requests_per_unit"`
+	// Unit second, minute, hour or day
+	Unit string `yaml:"unit"`
+	// Burst the size of the bucket, default to RequestsPerUnit
+	Burst int `yaml:"burst"`
+	// Mode fallback or primary, fallback by default
+	Mode string `yaml:"mode"`
+}
+
+// LocalEntry a descriptor entry of the local limit
+type LocalEntry struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+}
+
+// Verify checks the local limit
+func (c *LocalLimitConfig) Verify() error {
+	if len(c.Domain) == 0 {
+		return fmt.Errorf("ratelimit.local domain is empty")
+	}
+	if len(c.Entries) == 0 {
+		return fmt.Errorf("ratelimit.local %s entries is empty", c.Domain)
+	}
+	for idx, entry := range c.Entries {
+		if len(entry.Key) == 0 {
+			return fmt.Errorf("ratelimit.local %s entry %d key is empty", c.Domain, idx)
+		}
+	}
+	if c.RequestsPerUnit == 0 {
+		return fmt.Errorf("ratelimit.local %s requests_per_unit should greater than 0", c.Domain)
+	}
+	if _, ok := localUnits[c.Unit]; !ok {
+		return fmt.Errorf("ratelimit.local %s unit %s should be second, minute, hour or day", c.Domain, c.Unit)
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("ratelimit.local %s burst should greater or equals to 0", c.Domain)
+	}
+	switch c.Mode {
+	case "", LocalFallback, LocalPrimary:
+	default:
+		return fmt.Errorf("ratelimit.local %s mode %s should be %s or %s", c.Domain, c.Mode, LocalFallback,
+			LocalPrimary)
+	}
+	return nil
+}
+
+func (c *LocalLimitConfig) primary() bool {
+	return c.Mode == LocalPrimary
+}
+
+// match checks the descriptor has exactly the keys of the entries, with the values if set
+func (c *LocalLimitConfig) match(domain string, descriptor *v3.RateLimitDescriptor) bool {
+	if c.Domain != domain || len(c.Entries) != len(descriptor.GetEntries()) {
+		return false
+	}
+	values := make(map[string]string, len(descriptor.GetEntries()))
+	for _, entry := range descriptor.GetEntries() {
+		values[entry.GetKey()] = entry.GetValue()
+	}
+	for _, entry := range c.Entries {
+		value, ok := values[entry.Key]
+		if !ok || (len(entry.Value) > 0 && entry.Value != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *LocalLimitConfig) rateLimit() *pb.RateLimitResponse_RateLimit {
+	return &pb.RateLimitResponse_RateLimit{
+		RequestsPerUnit: c.RequestsPerUnit,
+		Unit:            localUnits[c.Unit].unit,
+	}
+}
+
+type localBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// localLimiter enforces the local limits with a token bucket for each descriptor
+type localLimiter struct {
+	limits []*LocalLimitConfig
+
+	lock      sync.Mutex
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+}
+
+func newLocalLimiter(limits []*LocalLimitConfig) *localLimiter {
+	return &localLimiter{
+		limits:    limits,
+		buckets:   make(map[string]*localBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// find returns the index and the local limit matching the descriptor, nil if none matches
+func (l *localLimiter) find(domain string, descriptor *v3.RateLimitDescriptor) (int, *LocalLimitConfig) {
+	for idx, limit := range l.limits {
+		if limit.match(domain, descriptor) {
+			return idx, limit
+		}
+	}
+	return -1, nil
+}
+
+// acquire takes the hits from the bucket of the descriptor
+func (l *localLimiter) acquire(idx int, limit *LocalLimitConfig, descriptor *v3.RateLimitDescriptor,
+	hits uint32) *pb.RateLimitResponse_DescriptorStatus {
+	now := time.Now()
+	limiter := l.bucket(bucketKey(idx, descriptor), limit, now)
+	status := &pb.RateLimitResponse_DescriptorStatus{
+		Code:         pb.RateLimitResponse_OK,
+		CurrentLimit: limit.rateLimit(),
+	}
+	if !limiter.AllowN(now, int(hits)) {
+		status.Code = pb.RateLimitResponse_OVER_LIMIT
+	}
+	tokens := math.Max(limiter.TokensAt(now), 0)
+	status.LimitRemaining = uint32(tokens)
+	refill := (float64(limiter.Burst()) - tokens) / float64(limiter.Limit())
+	status.DurationUntilReset = durationpb.New(time.Duration(refill * float64(time.Second)))
+	return status
+}
+
+func (l *localLimiter) bucket(key string, limit *LocalLimitConfig, now time.Time) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if now.Sub(l.lastSweep) > bucketIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > bucketIdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		burst := limit.Burst
+		if burst == 0 {
+			burst = int(limit.RequestsPerUnit)
+		}
+		every := localUnits[limit.Unit].duration / time.Duration(limit.RequestsPerUnit)
+		b = &localBucket{limiter: rate.NewLimiter(rate.Every(every), burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
+
+func bucketKey(idx int, descriptor *v3.RateLimitDescriptor) string {
+	values := make([]string, 0, len(descriptor.GetEntries()))
+	for _, entry := range descriptor.GetEntries() {
+		values = append(values, entry.GetKey()+"="+entry.GetValue())
+	}
+	sort.Strings(values)
+	return fmt.Sprintf("%d|%s", idx, strings.Join(values, ","))
+}
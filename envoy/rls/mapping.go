@@ -0,0 +1,251 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package rls
+
+import (
+	"fmt"
+	"strings"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	"github.com/polarismesh/polaris-go/pkg/model"
+)
+
+// the polaris argument types the descriptor entries are mapped to
+const (
+	// ArgumentLabel parses the key like the polaris labels, e.g. $header.user, $query.id, $caller_ip
+	ArgumentLabel         = "label"
+	ArgumentMethod        = "method"
+	ArgumentHeader        = "header"
+	ArgumentQuery         = "query"
+	ArgumentCallerIP      = "caller_ip"
+	ArgumentCallerService = "caller_service"
+	ArgumentCustom        = "custom"
+)
+
+var argumentTypes = []string{ArgumentLabel, ArgumentMethod, ArgumentHeader, ArgumentQuery, ArgumentCallerIP,
+	ArgumentCallerService, ArgumentCustom}
+
+// MappingConfig how the rate limit requests of envoy are mapped to the polaris quota requests
+type MappingConfig struct {
+	// Domains maps the domains to the polaris services, the domain not listed is the service
+	// name with the suffix .<namespace> trimmed
+	Domains []*DomainMapping `yaml:"domains"`
+	// Descriptors maps the descriptor keys to the polaris arguments
+	Descriptors []*DescriptorMapping `yaml:"descriptors"`
+	// DefaultType the argument type of the keys not listed, label by default
+	DefaultType string `yaml:"default_type"`
+}
+
+// DomainMapping maps a domain to the polaris service
+type DomainMapping struct {
+	Domain string `yaml:"domain"`
+	// Namespace the namespace of the service, the namespace of the sidecar by default
+	Namespace string `yaml:"namespace"`
+	// Service the service name, the domain by default
+	Service string `yaml:"service"`
+	// Descriptors overrides the descriptor mapping of the keys for the domain
+	Descriptors []*DescriptorMapping `yaml:"descriptors"`
+}
+
+// DescriptorMapping maps a descriptor key to a polaris argument
+type DescriptorMapping struct {
+	Key  string `yaml:"key"`
+	Type string `yaml:"type"`
+	// Name the key of the argument, the descriptor key by default. For caller_service
+	// it is the namespace of the caller, the namespace of the sidecar by default
+	Name string `yaml:"name"`
+}
+
+// DefaultMappingConfig returns the mapping of the releases before, the :path key is the method
+// and the other keys are parsed as the polaris labels
+func DefaultMappingConfig() *MappingConfig {
+	return &MappingConfig{
+		Descriptors: []*DescriptorMapping{{Key: ":path", Type: ArgumentMethod}},
+		DefaultType: ArgumentLabel,
+	}
+}
+
+// Verify checks the mapping config
+func (c *MappingConfig) Verify() error {
+	if c == nil {
+		return nil
+	}
+	if len(c.DefaultType) > 0 && !validArgumentType(c.DefaultType) {
+		return fmt.Errorf("ratelimit.mapping.default_type %s should be one of %s", c.DefaultType,
+			strings.Join(argumentTypes, ", "))
+	}
+	if err := verifyDescriptors("ratelimit.mapping.descriptors", c.Descriptors); err != nil {
+		return err
+	}
+	domains := make(map[string]bool)
+	for idx, domain := range c.Domains {
+		if len(domain.Domain) == 0 {
+			return fmt.Errorf("ratelimit.mapping.domains %d domain is empty", idx)
+		}
+		if domains[domain.Domain] {
+			return fmt.Errorf("ratelimit.mapping.domains %s is duplicated", domain.Domain)
+		}
+		domains[domain.Domain] = true
+		if err := verifyDescriptors(fmt.Sprintf("ratelimit.mapping.domains %s descriptors", domain.Domain),
+			domain.Descriptors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyDescriptors(prefix string, descriptors []*DescriptorMapping) error {
+	keys := make(map[string]bool)
+	for idx, descriptor := range descriptors {
+		if len(descriptor.Key) == 0 {
+			return fmt.Errorf("%s %d key is empty", prefix, idx)
+		}
+		if keys[descriptor.Key] {
+			return fmt.Errorf("%s %s is duplicated", prefix, descriptor.Key)
+		}
+		keys[descriptor.Key] = true
+		if !validArgumentType(descriptor.Type) {
+			return fmt.Errorf("%s %s type %s should be one of %s", prefix, descriptor.Key, descriptor.Type,
+				strings.Join(argumentTypes, ", "))
+		}
+	}
+	return nil
+}
+
+func validArgumentType(argumentType string) bool {
+	for _, t := range argumentTypes {
+		if t == argumentType {
+			return true
+		}
+	}
+	return false
+}
+
+// mapper maps the domain and the descriptor to the quota target, built from the mapping config
+type mapper struct {
+	namespace   string
+	defaultType string
+	descriptors map[string]*DescriptorMapping
+	domains     map[string]*domainMapper
+}
+
+type domainMapper struct {
+	namespace   string
+	service     string
+	descriptors map[string]*DescriptorMapping
+}
+
+func newMapper(namespace string, conf *MappingConfig) (*mapper, error) {
+	if conf == nil {
+		conf = DefaultMappingConfig()
+	}
+	if err := conf.Verify(); err != nil {
+		return nil, err
+	}
+	m := &mapper{
+		namespace:   namespace,
+		defaultType: conf.DefaultType,
+		descriptors: descriptorMap(conf.Descriptors),
+		domains:     make(map[string]*domainMapper, len(conf.Domains)),
+	}
+	for _, domain := range conf.Domains {
+		d := &domainMapper{
+			namespace:   domain.Namespace,
+			service:     domain.Service,
+			descriptors: descriptorMap(domain.Descriptors),
+		}
+		if len(d.namespace) == 0 {
+			d.namespace = namespace
+		}
+		if len(d.service) == 0 {
+			d.service = domain.Domain
+		}
+		m.domains[domain.Domain] = d
+	}
+	if len(m.defaultType) == 0 {
+		m.defaultType = ArgumentLabel
+	}
+	return m, nil
+}
+
+func descriptorMap(descriptors []*DescriptorMapping) map[string]*DescriptorMapping {
+	values := make(map[string]*DescriptorMapping, len(descriptors))
+	for _, descriptor := range descriptors {
+		values[descriptor.Key] = descriptor
+	}
+	return values
+}
+
+// target maps the domain to the polaris service and the entries of the descriptor to the method
+// and the arguments
+func (m *mapper) target(domain string, descriptor *v3.RateLimitDescriptor) *quotaTarget {
+	target := &quotaTarget{namespace: m.namespace}
+	d, ok := m.domains[domain]
+	if ok {
+		target.namespace = d.namespace
+		target.service = d.service
+	} else {
+		target.service = strings.TrimSuffix(domain, "."+m.namespace)
+	}
+	for _, entry := range descriptor.GetEntries() {
+		mapping := m.mapping(d, entry.GetKey())
+		if mapping.Type == ArgumentMethod {
+			target.method = entry.GetValue()
+			continue
+		}
+		target.arguments = append(target.arguments, m.argument(mapping, entry.GetValue()))
+	}
+	return target
+}
+
+// mapping returns the mapping of the key, the mapping of the domain first
+func (m *mapper) mapping(d *domainMapper, key string) *DescriptorMapping {
+	if d != nil {
+		if mapping, ok := d.descriptors[key]; ok {
+			return mapping
+		}
+	}
+	if mapping, ok := m.descriptors[key]; ok {
+		return mapping
+	}
+	return &DescriptorMapping{Key: key, Type: m.defaultType}
+}
+
+func (m *mapper) argument(mapping *DescriptorMapping, value string) model.Argument {
+	name := mapping.Name
+	if len(name) == 0 {
+		name = mapping.Key
+	}
+	switch mapping.Type {
+	case ArgumentHeader:
+		return model.BuildHeaderArgument(name, value)
+	case ArgumentQuery:
+		return model.BuildQueryArgument(name, value)
+	case ArgumentCallerIP:
+		return model.BuildCallerIPArgument(value)
+	case ArgumentCallerService:
+		namespace := mapping.Name
+		if len(namespace) == 0 {
+			namespace = m.namespace
+		}
+		return model.BuildCallerServiceArgument(namespace, value)
+	case ArgumentCustom:
+		return model.BuildCustomArgument(name, value)
+	}
+	return model.BuildArgumentFromLabel(mapping.Key, value)
+}
@@ -0,0 +1,70 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package rls
+
+import (
+	"testing"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_mapper_target(t *testing.T) {
+	m, err := newMapper("default", &MappingConfig{
+		Domains: []*DomainMapping{
+			{Domain: "edge", Namespace: "production", Service: "gateway",
+				Descriptors: []*DescriptorMapping{{Key: "client", Type: ArgumentCallerIP}}},
+		},
+		Descriptors: []*DescriptorMapping{
+			{Key: "path", Type: ArgumentMethod},
+			{Key: "user", Type: ArgumentHeader, Name: "x-user"},
+			{Key: "source", Type: ArgumentCallerService},
+		},
+		DefaultType: ArgumentCustom,
+	})
+	assert.NoError(t, err)
+	descriptor := &v3.RateLimitDescriptor{Entries: []*v3.RateLimitDescriptor_Entry{
+		{Key: "path", Value: "/echo"},
+		{Key: "user", Value: "bob"},
+		{Key: "source", Value: "frontend"},
+		{Key: "client", Value: "10.0.0.1"},
+	}}
+
+	target := m.target("edge", descriptor)
+	assert.Equal(t, "production", target.namespace)
+	assert.Equal(t, "gateway", target.service)
+	assert.Equal(t, "/echo", target.method)
+	assert.Equal(t, []model.Argument{
+		model.BuildHeaderArgument("x-user", "bob"),
+		model.BuildCallerServiceArgument("default", "frontend"),
+		model.BuildCallerIPArgument("10.0.0.1"),
+	}, target.arguments)
+
+	target = m.target("echo.default", descriptor)
+	assert.Equal(t, "default", target.namespace)
+	assert.Equal(t, "echo", target.service)
+	assert.Equal(t, model.BuildCustomArgument("client", "10.0.0.1"), target.arguments[2])
+}
+
+func TestMappingConfig_Verify(t *testing.T) {
+	assert.NoError(t, DefaultMappingConfig().Verify())
+	assert.Error(t, (&MappingConfig{Descriptors: []*DescriptorMapping{{Key: "user", Type: "cookie"}}}).Verify())
+	assert.Error(t, (&MappingConfig{Descriptors: []*DescriptorMapping{{Type: ArgumentHeader}}}).Verify())
+	assert.Error(t, (&MappingConfig{Domains: []*DomainMapping{{Domain: "echo"}, {Domain: "echo"}}}).Verify())
+}
@@ -19,11 +19,16 @@ package rls
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
 	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
 	"github.com/polarismesh/polaris-go"
@@ -33,22 +38,56 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 func New(namespace string, conf *Config) (*RateLimitServer, error) {
 	conf.init()
+	if err := conf.Verify(); err != nil {
+		return nil, err
+	}
+	mapper, err := newMapper(namespace, conf.Mapping)
+	if err != nil {
+		return nil, err
+	}
+	var domains map[string]bool
+	if len(conf.Domains) > 0 {
+		domains = make(map[string]bool, len(conf.Domains))
+		for _, domain := range conf.Domains {
+			domains[domain] = true
+		}
+	}
 	return &RateLimitServer{
 		namespace: namespace,
 		conf:      conf,
+		mapper:    mapper,
+		domains:   domains,
+		local:     newLocalLimiter(conf.Local),
+		stats:     newStats(),
+		decisions: &decisionLog{sampleRate: conf.DecisionLogSampleRate},
+		limits:    &limitLookup{},
+		usages:    newUsageWindows(),
 	}, nil
 }
 
+// quotaGetter acquires the quota from polaris, satisfied by polaris.LimitAPI
+type quotaGetter interface {
+	GetQuota(request polaris.QuotaRequest) (polaris.QuotaFuture, error)
+}
+
 type RateLimitServer struct {
 	namespace string
 	conf      *Config
 	ln        net.Listener
 	grpcSvr   *grpc.Server
-	limiter   polaris.LimitAPI
+	limiter   quotaGetter
+	mapper    *mapper
+	domains   map[string]bool
+	local     *localLimiter
+	stats     *stats
+	decisions *decisionLog
+	limits    *limitLookup
+	usages    *usageWindows
 }
 
 func (svr *RateLimitServer) Run(ctx context.Context) error {
@@ -66,6 +105,7 @@ func (svr *RateLimitServer) Run(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	svr.limits.rules = sdkRules(client.SDKContext)
 
 	// 指定使用服务端证书创建一个 TLS credentials
 	var creds credentials.TransportCredentials
@@ -83,9 +123,25 @@ func (svr *RateLimitServer) Run(ctx context.Context) error {
 	}
 	server := grpc.NewServer(opts...)
 	pb.RegisterRateLimitServiceServer(server, svr)
+	svr.grpcSvr = server
+	go svr.expireUsages(ctx)
 	return server.Serve(ln)
 }
 
+// expireUsages removes the ended usage windows periodically
+func (svr *RateLimitServer) expireUsages(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			svr.usages.expire(now)
+		}
+	}
+}
+
 func (svr *RateLimitServer) Destroy() {
 	if svr.grpcSvr != nil {
 		svr.grpcSvr.GracefulStop()
@@ -97,67 +153,186 @@ func (svr *RateLimitServer) Destroy() {
 
 const MaxUint32 = uint32(1<<32 - 1)
 
+const (
+	headerLimit     = "x-ratelimit-limit"
+	headerRemaining = "x-ratelimit-remaining"
+	headerReset     = "x-ratelimit-reset"
+)
+
 func (svr *RateLimitServer) ShouldRateLimit(ctx context.Context, req *pb.RateLimitRequest) (*pb.RateLimitResponse, error) {
-	log.Info("[envoy-rls] receive ratelimit request", zap.Any("req", req))
+	if log.DebugEnabled() {
+		log.Debug("[envoy-rls] receive ratelimit request", zap.Any("req", req))
+	}
+	svr.stats.requests.WithLabelValues(req.GetDomain()).Inc()
+	if svr.domains != nil && !svr.domains[req.GetDomain()] {
+		return okResponse(len(req.GetDescriptors())), nil
+	}
 	acquireQuota := req.GetHitsAddend()
 	if acquireQuota == 0 {
 		acquireQuota = 1
 	}
 
-	quotaReq, err := svr.buildQuotaRequest(req.GetDomain(), acquireQuota, req.GetDescriptors())
-	if err != nil {
-		log.Error("[envoy-rls] build ratelimit quota request", zap.Error(err))
-		return nil, err
+	overallCode := pb.RateLimitResponse_OK
+	descriptorStatus := make([]*pb.RateLimitResponse_DescriptorStatus, 0, len(req.GetDescriptors()))
+	sources := make([]string, 0, len(req.GetDescriptors()))
+	var tightest *pb.RateLimitResponse_DescriptorStatus
+	var infos []string
+	for _, descriptor := range req.GetDescriptors() {
+		status, info, source := svr.descriptorStatus(req.GetDomain(), descriptor, acquireQuota)
+		svr.stats.decision(req.GetDomain(), descriptor, status.Code, source)
+		if status.Code == pb.RateLimitResponse_OVER_LIMIT {
+			overallCode = pb.RateLimitResponse_OVER_LIMIT
+		}
+		if len(info) > 0 {
+			infos = append(infos, info)
+		}
+		if status.CurrentLimit != nil && tighter(status, tightest) {
+			tightest = status
+		}
+		descriptorStatus = append(descriptorStatus, status)
+		sources = append(sources, source)
+	}
+
+	rlsRsp := &pb.RateLimitResponse{
+		OverallCode: overallCode,
+		Statuses:    descriptorStatus,
+		RawBody:     []byte(strings.Join(infos, "\n")),
+	}
+	if svr.conf.Shadow && overallCode == pb.RateLimitResponse_OVER_LIMIT {
+		svr.stats.shadowed.WithLabelValues(req.GetDomain()).Inc()
+		svr.decisions.log(req, rlsRsp, sources, true)
+		return okResponse(len(req.GetDescriptors())), nil
+	}
+	if tightest != nil {
+		rlsRsp.ResponseHeadersToAdd = rateLimitHeaders(tightest)
 	}
-	future, err := svr.limiter.GetQuota(quotaReq)
+	svr.decisions.log(req, rlsRsp, sources, false)
+	if log.DebugEnabled() {
+		log.Debug("[envoy-rls] send envoy rls response", zap.Any("rsp", rlsRsp))
+	}
+	return rlsRsp, nil
+}
+
+// descriptorStatus evaluates the descriptor by the local limit in primary mode, or by polaris,
+// which degrades to the local limit in fallback mode or to the failure policy when unreachable.
+// It returns the source of the decision as well
+func (svr *RateLimitServer) descriptorStatus(domain string, descriptor *v3.RateLimitDescriptor,
+	acquireQuota uint32) (*pb.RateLimitResponse_DescriptorStatus, string, string) {
+	idx, local := svr.local.find(domain, descriptor)
+	if local != nil && local.primary() {
+		return svr.local.acquire(idx, local, descriptor, acquireQuota), "", sourceLocal
+	}
+	target := svr.mapper.target(domain, descriptor)
+	start := time.Now()
+	status, info, err := svr.evaluate(target, acquireQuota)
+	svr.stats.polarisCall(domain, start, err)
+	if err == nil {
+		return status, info, sourcePolaris
+	}
+	if local != nil {
+		log.Warn("[envoy-rls] get quota, degrade to local limit", zap.String("target", target.key()),
+			zap.Error(err))
+		return svr.local.acquire(idx, local, descriptor, acquireQuota), "", sourceLocal
+	}
+	log.Error("[envoy-rls] get quota", zap.String("target", target.key()),
+		zap.String("failure_policy", svr.conf.FailurePolicy), zap.Error(err))
+	return svr.failureStatus(), "", sourceFailure
+}
+
+// evaluate acquires the quota of one descriptor from polaris, the limit of the status is filled in when
+// a rule of the service matches the descriptor. The remaining and the reset are counted by the hits of
+// this sidecar, so they are filled in for local rules only, the remaining of a global rule is shared
+// by all the sidecars and only known to the polaris server
+func (svr *RateLimitServer) evaluate(target *quotaTarget,
+	acquireQuota uint32) (*pb.RateLimitResponse_DescriptorStatus, string, error) {
+	future, err := svr.limiter.GetQuota(target.quotaRequest(acquireQuota))
 	if err != nil {
-		log.Error("[envoy-rls] get quota", zap.Error(err))
-		return nil, err
+		return nil, "", err
 	}
 	resp := future.Get()
-
-	overallCode := pb.RateLimitResponse_OK
+	status := &pb.RateLimitResponse_DescriptorStatus{Code: pb.RateLimitResponse_OK}
 	if resp.Code == model.QuotaResultLimited {
-		overallCode = pb.RateLimitResponse_OVER_LIMIT
+		status.Code = pb.RateLimitResponse_OVER_LIMIT
+	}
+	limit := svr.limits.lookup(target)
+	if limit == nil {
+		return status, resp.Info, nil
+	}
+	status.CurrentLimit = limit.rateLimit()
+	if limit.global {
+		return status, resp.Info, nil
+	}
+	var hits uint32
+	if status.Code == pb.RateLimitResponse_OK {
+		hits = acquireQuota
 	}
+	remaining, reset := svr.usages.hit(target, limit, hits, time.Now())
+	if status.Code == pb.RateLimitResponse_OVER_LIMIT {
+		remaining = 0
+	}
+	status.LimitRemaining = remaining
+	status.DurationUntilReset = durationpb.New(reset)
+	return status, resp.Info, nil
+}
 
-	descriptorStatus := make([]*pb.RateLimitResponse_DescriptorStatus, 0, len(req.GetDescriptors()))
-	for range req.GetDescriptors() {
-		descriptorStatus = append(descriptorStatus, &pb.RateLimitResponse_DescriptorStatus{
-			Code: overallCode,
-		})
+// failureStatus returns the status of the descriptor by the failure policy
+func (svr *RateLimitServer) failureStatus() *pb.RateLimitResponse_DescriptorStatus {
+	if svr.conf.FailurePolicy == FailClosed {
+		return &pb.RateLimitResponse_DescriptorStatus{Code: pb.RateLimitResponse_OVER_LIMIT}
 	}
+	return &pb.RateLimitResponse_DescriptorStatus{Code: pb.RateLimitResponse_OK}
+}
 
-	rlsRsp := &pb.RateLimitResponse{
-		OverallCode: overallCode,
-		Statuses:    descriptorStatus,
-		RawBody:     []byte(resp.Info),
+// okResponse answers all the descriptors OK
+func okResponse(descriptors int) *pb.RateLimitResponse {
+	statuses := make([]*pb.RateLimitResponse_DescriptorStatus, 0, descriptors)
+	for i := 0; i < descriptors; i++ {
+		statuses = append(statuses, &pb.RateLimitResponse_DescriptorStatus{Code: pb.RateLimitResponse_OK})
 	}
-	log.Info("[envoy-rls] send envoy rls response", zap.Any("rsp", rlsRsp))
-	return rlsRsp, nil
+	return &pb.RateLimitResponse{OverallCode: pb.RateLimitResponse_OK, Statuses: statuses}
 }
 
-func (svr *RateLimitServer) buildQuotaRequest(domain string, acquireQuota uint32,
-	descriptors []*v3.RateLimitDescriptor) (polaris.QuotaRequest, error) {
-
-	req := polaris.NewQuotaRequest()
-	for i := range descriptors {
-		descriptor := descriptors[i]
-		for _, entry := range descriptor.GetEntries() {
-			if entry.GetKey() == ":path" {
-				req.SetMethod(entry.GetValue())
-				continue
-			}
-			req.AddArgument(model.BuildArgumentFromLabel(entry.GetKey(), entry.GetValue()))
-		}
+// tighter reports whether the status is tighter than the current one, a status with the remaining
+// is preferred to the status of a global rule which has none
+func tighter(status *pb.RateLimitResponse_DescriptorStatus, current *pb.RateLimitResponse_DescriptorStatus) bool {
+	if current == nil {
+		return true
+	}
+	if (status.DurationUntilReset == nil) != (current.DurationUntilReset == nil) {
+		return status.DurationUntilReset != nil
 	}
+	return status.LimitRemaining < current.LimitRemaining
+}
+
+// rateLimitHeaders builds the x-ratelimit-* headers from the status of the tightest descriptor,
+// the remaining and the reset are omitted for the status of a global rule
+func rateLimitHeaders(status *pb.RateLimitResponse_DescriptorStatus) []*core.HeaderValue {
+	limit := status.GetCurrentLimit()
+	window := unitSeconds(limit.GetUnit())
+	limitValue := strconv.FormatUint(uint64(limit.GetRequestsPerUnit()), 10)
+	if window > 0 {
+		limitValue = fmt.Sprintf("%s, %s;w=%d", limitValue, limitValue, window)
+	}
+	headers := []*core.HeaderValue{{Key: headerLimit, Value: limitValue}}
+	if status.DurationUntilReset == nil {
+		return headers
+	}
+	reset := status.GetDurationUntilReset().AsDuration()
+	return append(headers,
+		&core.HeaderValue{Key: headerRemaining, Value: strconv.FormatUint(uint64(status.GetLimitRemaining()), 10)},
+		&core.HeaderValue{Key: headerReset, Value: strconv.FormatInt(int64(math.Ceil(reset.Seconds())), 10)})
+}
 
-	if strings.HasSuffix(domain, "."+svr.namespace) {
-		domain = strings.TrimSuffix(domain, "."+svr.namespace)
+func unitSeconds(unit pb.RateLimitResponse_RateLimit_Unit) int64 {
+	switch unit {
+	case pb.RateLimitResponse_RateLimit_SECOND:
+		return 1
+	case pb.RateLimitResponse_RateLimit_MINUTE:
+		return 60
+	case pb.RateLimitResponse_RateLimit_HOUR:
+		return 3600
+	case pb.RateLimitResponse_RateLimit_DAY:
+		return 86400
 	}
-	req.SetNamespace(svr.namespace)
-	req.SetService(domain)
-	req.SetToken(acquireQuota)
-	log.Info("[envoy-rls] build polaris quota request", zap.Any("param", req))
-	return req, nil
+	return 0
 }
@@ -0,0 +1,259 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package rls
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/polarismesh/polaris-go"
+	"github.com/polarismesh/polaris-go/pkg/model"
+	apimodel "github.com/polarismesh/specification/source/go/api/v1/model"
+	apitraffic "github.com/polarismesh/specification/source/go/api/v1/traffic_manage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testFuture struct {
+	resp *model.QuotaResponse
+}
+
+func (f *testFuture) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+func (f *testFuture) Get() *model.QuotaResponse {
+	return f.resp
+}
+
+func (f *testFuture) GetImmediately() *model.QuotaResponse {
+	return f.resp
+}
+
+func (f *testFuture) Release() {
+}
+
+// testLimiter limits the requests carrying the limited header value
+type testLimiter struct {
+	limited string
+	err     error
+}
+
+func (l *testLimiter) GetQuota(request polaris.QuotaRequest) (polaris.QuotaFuture, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	code := model.QuotaResultOk
+	for _, argument := range request.(*model.QuotaRequestImpl).Arguments() {
+		if argument.Value() == l.limited {
+			code = model.QuotaResultLimited
+		}
+	}
+	return &testFuture{resp: &model.QuotaResponse{Code: code}}, nil
+}
+
+func testRules(ruleType apitraffic.Rule_Type) ruleGetter {
+	return func(namespace string, service string) (*apitraffic.RateLimit, error) {
+		return &apitraffic.RateLimit{Rules: []*apitraffic.Rule{{
+			Type: ruleType,
+			Arguments: []*apitraffic.MatchArgument{{
+				Type:  apitraffic.MatchArgument_HEADER,
+				Key:   "user",
+				Value: &apimodel.MatchString{Type: apimodel.MatchString_EXACT, Value: wrapperspb.String("bob")},
+			}},
+			Amounts: []*apitraffic.Amount{
+				{MaxAmount: wrapperspb.UInt32(10), ValidDuration: durationpb.New(60e9)},
+				{MaxAmount: wrapperspb.UInt32(3), ValidDuration: durationpb.New(1e9)},
+			},
+		}}}, nil
+	}
+}
+
+func TestRateLimitServer_ShouldRateLimit(t *testing.T) {
+	svr, err := New("default", &Config{})
+	assert.NoError(t, err)
+	svr.limiter = &testLimiter{limited: "alice"}
+	svr.limits.rules = testRules(apitraffic.Rule_LOCAL)
+
+	descriptor := func(user string) *v3.RateLimitDescriptor {
+		return &v3.RateLimitDescriptor{Entries: []*v3.RateLimitDescriptor_Entry{
+			{Key: ":path", Value: "/echo"}, {Key: "$header.user", Value: user}}}
+	}
+	req := &pb.RateLimitRequest{
+		Domain:      "echo.default",
+		Descriptors: []*v3.RateLimitDescriptor{descriptor("bob"), descriptor("alice")},
+	}
+	rsp, err := svr.ShouldRateLimit(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, pb.RateLimitResponse_OVER_LIMIT, rsp.OverallCode)
+	assert.Len(t, rsp.Statuses, 2)
+
+	bob := rsp.Statuses[0]
+	assert.Equal(t, pb.RateLimitResponse_OK, bob.Code)
+	assert.Equal(t, uint32(10), bob.CurrentLimit.RequestsPerUnit)
+	assert.Equal(t, pb.RateLimitResponse_RateLimit_MINUTE, bob.CurrentLimit.Unit)
+	assert.Equal(t, uint32(9), bob.LimitRemaining)
+	assert.NotNil(t, bob.DurationUntilReset)
+
+	alice := rsp.Statuses[1]
+	assert.Equal(t, pb.RateLimitResponse_OVER_LIMIT, alice.Code)
+	assert.Nil(t, alice.CurrentLimit)
+
+	headers := map[string]string{}
+	for _, header := range rsp.ResponseHeadersToAdd {
+		headers[header.Key] = header.Value
+	}
+	assert.Equal(t, "10, 10;w=60", headers[headerLimit])
+	assert.Equal(t, "9", headers[headerRemaining])
+	assert.NotEmpty(t, headers[headerReset])
+}
+
+func TestRateLimitServer_globalRule(t *testing.T) {
+	svr, err := New("default", &Config{})
+	assert.NoError(t, err)
+	svr.limiter = &testLimiter{}
+	svr.limits.rules = testRules(apitraffic.Rule_GLOBAL)
+
+	req := &pb.RateLimitRequest{
+		Domain: "echo.default",
+		Descriptors: []*v3.RateLimitDescriptor{{Entries: []*v3.RateLimitDescriptor_Entry{
+			{Key: ":path", Value: "/echo"}, {Key: "$header.user", Value: "bob"}}}},
+	}
+	rsp, err := svr.ShouldRateLimit(context.Background(), req)
+	assert.NoError(t, err)
+	bob := rsp.Statuses[0]
+	assert.Equal(t, pb.RateLimitResponse_OK, bob.Code)
+	assert.Equal(t, uint32(10), bob.CurrentLimit.RequestsPerUnit)
+	assert.Equal(t, uint32(0), bob.LimitRemaining)
+	assert.Nil(t, bob.DurationUntilReset)
+
+	assert.Len(t, rsp.ResponseHeadersToAdd, 1)
+	assert.Equal(t, headerLimit, rsp.ResponseHeadersToAdd[0].Key)
+	assert.Equal(t, "10, 10;w=60", rsp.ResponseHeadersToAdd[0].Value)
+}
+
+func TestRateLimitServer_policies(t *testing.T) {
+	req := &pb.RateLimitRequest{
+		Domain: "echo",
+		Descriptors: []*v3.RateLimitDescriptor{{Entries: []*v3.RateLimitDescriptor_Entry{
+			{Key: "$header.user", Value: "alice"}}}},
+	}
+	tests := []struct {
+		name    string
+		conf    *Config
+		limiter *testLimiter
+		code    pb.RateLimitResponse_Code
+	}{
+		{"over limit", &Config{}, &testLimiter{limited: "alice"}, pb.RateLimitResponse_OVER_LIMIT},
+		{"fail open", &Config{}, &testLimiter{err: errors.New("unreachable")}, pb.RateLimitResponse_OK},
+		{"fail closed", &Config{FailurePolicy: FailClosed}, &testLimiter{err: errors.New("unreachable")},
+			pb.RateLimitResponse_OVER_LIMIT},
+		{"shadow", &Config{Shadow: true}, &testLimiter{limited: "alice"}, pb.RateLimitResponse_OK},
+		{"domain not listed", &Config{Domains: []string{"other"}}, &testLimiter{limited: "alice"},
+			pb.RateLimitResponse_OK},
+		{"domain listed", &Config{Domains: []string{"echo"}}, &testLimiter{limited: "alice"},
+			pb.RateLimitResponse_OVER_LIMIT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svr, err := New("default", tt.conf)
+			assert.NoError(t, err)
+			svr.limiter = tt.limiter
+			rsp, err := svr.ShouldRateLimit(context.Background(), req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, rsp.OverallCode)
+			assert.Len(t, rsp.Statuses, 1)
+			assert.Equal(t, tt.code, rsp.Statuses[0].Code)
+		})
+	}
+
+	_, err := New("default", &Config{FailurePolicy: "retry"})
+	assert.Error(t, err)
+}
+
+func TestRateLimitServer_local(t *testing.T) {
+	descriptor := func(user string) *v3.RateLimitDescriptor {
+		return &v3.RateLimitDescriptor{Entries: []*v3.RateLimitDescriptor_Entry{{Key: "user", Value: user}}}
+	}
+	local := &LocalLimitConfig{Domain: "echo", Entries: []*LocalEntry{{Key: "user"}}, RequestsPerUnit: 2,
+		Unit: "minute"}
+	for _, mode := range []string{LocalFallback, LocalPrimary} {
+		t.Run(mode, func(t *testing.T) {
+			conf := *local
+			conf.Mode = mode
+			svr, err := New("default", &Config{FailurePolicy: FailClosed, Local: []*LocalLimitConfig{&conf}})
+			assert.NoError(t, err)
+			// the limiter fails, which is not called in primary mode
+			svr.limiter = &testLimiter{err: errors.New("unreachable")}
+
+			var codes []pb.RateLimitResponse_Code
+			for i := 0; i < 3; i++ {
+				rsp, err := svr.ShouldRateLimit(context.Background(), &pb.RateLimitRequest{
+					Domain: "echo", Descriptors: []*v3.RateLimitDescriptor{descriptor("bob")}})
+				assert.NoError(t, err)
+				codes = append(codes, rsp.OverallCode)
+			}
+			assert.Equal(t, []pb.RateLimitResponse_Code{pb.RateLimitResponse_OK, pb.RateLimitResponse_OK,
+				pb.RateLimitResponse_OVER_LIMIT}, codes)
+
+			// each value has a bucket of its own
+			rsp, err := svr.ShouldRateLimit(context.Background(), &pb.RateLimitRequest{
+				Domain: "echo", Descriptors: []*v3.RateLimitDescriptor{descriptor("alice")}})
+			assert.NoError(t, err)
+			assert.Equal(t, pb.RateLimitResponse_OK, rsp.OverallCode)
+			assert.Equal(t, uint32(2), rsp.Statuses[0].CurrentLimit.RequestsPerUnit)
+			assert.Equal(t, pb.RateLimitResponse_RateLimit_MINUTE, rsp.Statuses[0].CurrentLimit.Unit)
+			assert.Equal(t, uint32(1), rsp.Statuses[0].LimitRemaining)
+		})
+	}
+
+	_, err := New("default", &Config{Local: []*LocalLimitConfig{{Domain: "echo", Entries: local.Entries,
+		RequestsPerUnit: 1, Unit: "week"}}})
+	assert.Error(t, err)
+}
+
+func TestRateLimitServer_stats(t *testing.T) {
+	svr, err := New("default", &Config{Shadow: true})
+	assert.NoError(t, err)
+	svr.limiter = &testLimiter{limited: "alice"}
+	for _, user := range []string{"alice", "bob"} {
+		_, err := svr.ShouldRateLimit(context.Background(), &pb.RateLimitRequest{
+			Domain: "echo",
+			Descriptors: []*v3.RateLimitDescriptor{{Entries: []*v3.RateLimitDescriptor_Entry{
+				{Key: "$header.user", Value: user}}}},
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(svr.stats.requests.WithLabelValues("echo")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(svr.stats.shadowed.WithLabelValues("echo")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		svr.stats.decisions.WithLabelValues("echo", "$header.user", "OVER_LIMIT", sourcePolaris)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(
+		svr.stats.decisions.WithLabelValues("echo", "$header.user", "OK", sourcePolaris)))
+	assert.Equal(t, 1, testutil.CollectAndCount(svr.stats.latency))
+
+	_, err = New("default", &Config{DecisionLogSampleRate: 2})
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package rls
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	pb "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+)
+
+// the sources of the descriptor decisions
+const (
+	sourcePolaris = "polaris"
+	sourceLocal   = "local"
+	sourceFailure = "failure_policy"
+)
+
+// stats the metrics of the rate limit service, the descriptor label is the keys of the entries
+// rather than the values, which keeps the cardinality bounded
+type stats struct {
+	requests  *prometheus.CounterVec
+	decisions *prometheus.CounterVec
+	shadowed  *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+}
+
+func newStats() *stats {
+	s := &stats{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "polaris_sidecar_ratelimit_requests_total",
+			Help: "The rate limit requests received from envoy.",
+		}, []string{"domain"}),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "polaris_sidecar_ratelimit_decisions_total",
+			Help: "The descriptors answered, by code and by the source of the decision.",
+		}, []string{"domain", "descriptor", "code", "source"}),
+		shadowed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "polaris_sidecar_ratelimit_shadow_over_limit_total",
+			Help: "The requests over limit answered OK in shadow mode.",
+		}, []string{"domain"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "polaris_sidecar_ratelimit_polaris_latency_seconds",
+			Help:    "The latency of acquiring the quota from polaris.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"domain"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "polaris_sidecar_ratelimit_polaris_errors_total",
+			Help: "The failures of acquiring the quota from polaris.",
+		}, []string{"domain"}),
+	}
+	return s
+}
+
+func (s *stats) decision(domain string, descriptor *v3.RateLimitDescriptor, code pb.RateLimitResponse_Code,
+	source string) {
+	s.decisions.WithLabelValues(domain, descriptorKeys(descriptor), code.String(), source).Inc()
+}
+
+func (s *stats) polarisCall(domain string, start time.Time, err error) {
+	s.latency.WithLabelValues(domain).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.errors.WithLabelValues(domain).Inc()
+	}
+}
+
+func descriptorKeys(descriptor *v3.RateLimitDescriptor) string {
+	keys := make([]string, 0, len(descriptor.GetEntries()))
+	for _, entry := range descriptor.GetEntries() {
+		keys = append(keys, entry.GetKey())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// decisionLog logs the sampled decisions of the requests
+type decisionLog struct {
+	sampleRate float64
+}
+
+func (d *decisionLog) sampled() bool {
+	return d.sampleRate > 0 && (d.sampleRate >= 1 || rand.Float64() < d.sampleRate)
+}
+
+func (d *decisionLog) log(req *pb.RateLimitRequest, rsp *pb.RateLimitResponse, sources []string, shadow bool) {
+	if !d.sampled() {
+		return
+	}
+	descriptors := make([]map[string]interface{}, 0, len(req.GetDescriptors()))
+	for i, descriptor := range req.GetDescriptors() {
+		entries := make(map[string]string, len(descriptor.GetEntries()))
+		for _, entry := range descriptor.GetEntries() {
+			entries[entry.GetKey()] = entry.GetValue()
+		}
+		value := map[string]interface{}{"entries": entries}
+		if i < len(sources) {
+			value["source"] = sources[i]
+		}
+		if i < len(rsp.GetStatuses()) {
+			status := rsp.GetStatuses()[i]
+			value["code"] = status.GetCode().String()
+			if status.GetCurrentLimit() != nil {
+				value["limit"] = status.GetCurrentLimit().GetRequestsPerUnit()
+				value["unit"] = status.GetCurrentLimit().GetUnit().String()
+				value["remaining"] = status.GetLimitRemaining()
+			}
+		}
+		descriptors = append(descriptors, value)
+	}
+	log.Info("[envoy-rls] decision", zap.String("domain", req.GetDomain()),
+		zap.String("code", rsp.GetOverallCode().String()), zap.Bool("shadow", shadow),
+		zap.Uint32("hits", req.GetHitsAddend()), zap.Any("descriptors", descriptors))
+}
+
+// Collectors returns the metrics of the rate limit service, which are served by the metric server
+func (svr *RateLimitServer) Collectors() []prometheus.Collector {
+	s := svr.stats
+	return []prometheus.Collector{s.requests, s.decisions, s.shadowed, s.latency, s.errors}
+}
@@ -20,6 +20,7 @@ package main
 import (
 	"github.com/polarismesh/polaris-sidecar/cmd"
 	_ "github.com/polarismesh/polaris-sidecar/resolver/dnsagent"
+	_ "github.com/polarismesh/polaris-sidecar/resolver/kubernetes"
 	_ "github.com/polarismesh/polaris-sidecar/resolver/meshproxy"
 )
 
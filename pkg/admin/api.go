@@ -0,0 +1,58 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+// Package admin defines the versioned admin api of the sidecar, served on the debugger port
+package admin
+
+import "time"
+
+// the paths of the admin api
+const (
+	PathStatus     = "/v1/status"
+	PathConfig     = "/v1/config"
+	PathResolvers  = "/v1/resolvers"
+	PathLookup     = "/v1/lookup"
+	PathCacheFlush = "/v1/cache/flush"
+	PathLogLevel   = "/v1/log/level"
+	PathMTLSCert   = "/v1/mtls/cert"
+)
+
+// Status the running state of the sidecar
+type Status struct {
+	Version   string          `json:"version"`
+	StartTime time.Time       `json:"start_time"`
+	Uptime    string          `json:"uptime"`
+	Listeners []string        `json:"listeners"`
+	Resolvers []string        `json:"resolvers"`
+	Features  map[string]bool `json:"features"`
+}
+
+// ErrorResponse the body answered with the failed requests
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// LogLevel the output level of the log scope
+type LogLevel struct {
+	Scope string `json:"scope"`
+	Level string `json:"level"`
+}
+
+// CacheFlushResponse the count of the flushed entries of each cache
+type CacheFlushResponse struct {
+	Flushed map[string]int `json:"flushed"`
+}
@@ -0,0 +1,149 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+	"github.com/polarismesh/polaris-sidecar/security/mtls/certificate"
+)
+
+// Client calls the admin api of the running sidecar
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient creates the client of the admin api served on the address, such as 127.0.0.1:30000
+func NewClient(address string, timeout time.Duration) *Client {
+	baseURL := address
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *Client) do(method string, path string, query url.Values, body interface{}, out interface{}) error {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fail to call the sidecar admin api, is the debugger enabled? %v", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		errResp := &ErrorResponse{}
+		if err := json.Unmarshal(content, errResp); err != nil || len(errResp.Error) == 0 {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, errResp.Error)
+	}
+	return json.Unmarshal(content, out)
+}
+
+// Status returns the running state of the sidecar
+func (c *Client) Status() (*Status, error) {
+	status := &Status{}
+	return status, c.do(http.MethodGet, PathStatus, nil, nil, status)
+}
+
+// Config returns the effective config, the secrets are redacted
+func (c *Client) Config() (map[string]interface{}, error) {
+	conf := make(map[string]interface{})
+	return conf, c.do(http.MethodGet, PathConfig, nil, nil, &conf)
+}
+
+// Resolvers returns the resolvers and the zones they serve
+func (c *Client) Resolvers() ([]*resolver.ResolverStatus, error) {
+	var statuses []*resolver.ResolverStatus
+	return statuses, c.do(http.MethodGet, PathResolvers, nil, nil, &statuses)
+}
+
+// Lookup resolves the name by the sidecar resolvers without sending it to the recursors
+func (c *Client) Lookup(listener string, name string, qtype string) (*resolver.LookupTrace, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	if len(qtype) > 0 {
+		query.Set("type", qtype)
+	}
+	if len(listener) > 0 {
+		query.Set("listener", listener)
+	}
+	trace := &resolver.LookupTrace{}
+	return trace, c.do(http.MethodGet, PathLookup, query, nil, trace)
+}
+
+// FlushCache flushes the caches of the resolvers
+func (c *Client) FlushCache() (*CacheFlushResponse, error) {
+	resp := &CacheFlushResponse{}
+	return resp, c.do(http.MethodPost, PathCacheFlush, nil, nil, resp)
+}
+
+// LogLevels returns the output levels of the log scopes, all the scopes if scope is empty
+func (c *Client) LogLevels(scope string) ([]*LogLevel, error) {
+	query := url.Values{}
+	if len(scope) > 0 {
+		query.Set("scope", scope)
+	}
+	var levels []*LogLevel
+	return levels, c.do(http.MethodGet, PathLogLevel, query, nil, &levels)
+}
+
+// SetLogLevel sets the output level of the log scope, all the scopes if scope is empty
+func (c *Client) SetLogLevel(scope string, level string) ([]*LogLevel, error) {
+	var levels []*LogLevel
+	return levels, c.do(http.MethodPut, PathLogLevel, nil, &LogLevel{Scope: scope, Level: level}, &levels)
+}
+
+// Certificate returns the details of the mtls workload certificate
+func (c *Client) Certificate() (*certificate.CertInfo, error) {
+	info := &certificate.CertInfo{}
+	return info, c.do(http.MethodGet, PathMTLSCert, nil, nil, info)
+}
@@ -0,0 +1,60 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathLogLevel, func(resp http.ResponseWriter, req *http.Request) {
+		level := &LogLevel{Scope: req.URL.Query().Get("scope"), Level: "info"}
+		if req.Method == http.MethodPut {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(level))
+		}
+		_ = json.NewEncoder(resp).Encode([]*LogLevel{level})
+	})
+	mux.HandleFunc(PathMTLSCert, func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(resp).Encode(&ErrorResponse{Error: "mtls not enabled"})
+	})
+	svr := httptest.NewServer(mux)
+	defer svr.Close()
+
+	client := NewClient(svr.Listener.Addr().String(), time.Second)
+	levels, err := client.LogLevels("default")
+	assert.NoError(t, err)
+	assert.Equal(t, []*LogLevel{{Scope: "default", Level: "info"}}, levels)
+
+	levels, err = client.SetLogLevel("dns", "debug")
+	assert.NoError(t, err)
+	assert.Equal(t, []*LogLevel{{Scope: "dns", Level: "debug"}}, levels)
+
+	_, err = client.Certificate()
+	assert.EqualError(t, err, "GET /v1/mtls/cert: mtls not enabled")
+
+	_, err = client.Status()
+	assert.EqualError(t, err, "GET /v1/status: 404 Not Found")
+}
@@ -83,3 +83,10 @@ func GetLimitAPI() (polaris.LimitAPI, error) {
 	}
 	return polaris.NewLimitAPIByContext(SDKContext), nil
 }
+
+func GetConfigAPI() (polaris.ConfigAPI, error) {
+	if SDKContext == nil {
+		return nil, errors.New("polaris SDKContext is nil")
+	}
+	return polaris.NewConfigAPIByContext(SDKContext), nil
+}
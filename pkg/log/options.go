@@ -19,6 +19,8 @@ package log
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 )
 
 const (
@@ -68,6 +70,20 @@ var stringToLevel = map[string]Level{
 	"none":  NoneLevel,
 }
 
+// String returns the name of the level
+func (l Level) String() string {
+	return levelToString[l]
+}
+
+// ParseLevel returns the level of the name, such as debug or info
+func ParseLevel(name string) (Level, error) {
+	level, exist := stringToLevel[strings.ToLower(name)]
+	if !exist {
+		return NoneLevel, fmt.Errorf("invalid log level %s", name)
+	}
+	return level, nil
+}
+
 // Options defines the set of options supported by logging package.
 type Options struct {
 	// OutputPaths is a list of file system paths to write the log data to.
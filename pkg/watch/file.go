@@ -0,0 +1,75 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// FileWatcher polls the file and notifies the changes of its content. Polling is used
+// instead of inotify, as the watched files are often replaced by rename or bind mounted
+type FileWatcher struct {
+	path     string
+	interval time.Duration
+	digest   []byte
+}
+
+// NewFileWatcher creates the watcher of the file, the current content is taken as unchanged
+func NewFileWatcher(path string, interval time.Duration) *FileWatcher {
+	w := &FileWatcher{path: path, interval: interval}
+	w.digest, _ = w.read()
+	return w
+}
+
+func (w *FileWatcher) read() ([]byte, []byte) {
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		// the absent file is treated as the empty content
+		content = nil
+	}
+	digest := sha256.Sum256(content)
+	return digest[:], content
+}
+
+// Reset takes the current content as unchanged, used after the owner rewrites the file
+func (w *FileWatcher) Reset() {
+	w.digest, _ = w.read()
+}
+
+// Watch calls onChange with the new content whenever the content changes, until the context is done
+func (w *FileWatcher) Watch(ctx context.Context, onChange func(content []byte)) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			digest, content := w.read()
+			if bytes.Equal(digest, w.digest) {
+				continue
+			}
+			w.digest = digest
+			onChange(content)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redirect
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// BackendIPTables redirects with iptables and ip6tables
+	BackendIPTables = "iptables"
+	// BackendNFTables redirects with nftables
+	BackendNFTables = "nftables"
+	// BackendAuto uses nftables when the nft binary is found, otherwise iptables
+	BackendAuto = "auto"
+
+	defaultDNSPort = 53
+)
+
+// Config the redirection of the dns queries to the sidecar
+type Config struct {
+	// Enable installs the rules on startup
+	Enable bool `yaml:"enable"`
+	// Backend iptables, nftables or auto
+	Backend string `yaml:"backend"`
+	// Port the sidecar dns port the queries are redirected to, default to the sidecar port
+	Port int `yaml:"port"`
+	// DNSPort the destination port of the queries to redirect
+	DNSPort int `yaml:"dns_port"`
+	// Protocols udp and tcp, default to both
+	Protocols []string `yaml:"protocols"`
+	// AppUIDs redirects only the queries of the uids, all the queries are redirected when empty
+	AppUIDs []int `yaml:"app_uids"`
+	// SidecarUID the queries of the uid are not redirected, so that the upstream traffic
+	// of the sidecar is not looped back, default to the uid of the process. It should not be
+	// root, otherwise the queries of all the processes of root are not redirected
+	SidecarUID *int `yaml:"sidecar_uid"`
+	// Netns the network namespace path to install the rules in, such as /proc/<pid>/ns/net
+	Netns string `yaml:"netns"`
+	// IPv6 installs the rules for ipv6 as well
+	IPv6 bool `yaml:"ipv6"`
+	// CleanupOnExit removes the rules when the sidecar exits
+	CleanupOnExit bool `yaml:"cleanup_on_exit"`
+}
+
+// DefaultConfig returns the default redirect config
+func DefaultConfig() *Config {
+	return &Config{
+		Backend:       BackendAuto,
+		DNSPort:       defaultDNSPort,
+		IPv6:          true,
+		CleanupOnExit: true,
+	}
+}
+
+// Verify checks the config
+func (c *Config) Verify() error {
+	switch c.Backend {
+	case BackendAuto, BackendIPTables, BackendNFTables:
+	default:
+		return fmt.Errorf("redirect.backend should be one of %s, %s and %s",
+			BackendAuto, BackendIPTables, BackendNFTables)
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("redirect.port should between 1 and 65535")
+	}
+	if c.DNSPort <= 0 || c.DNSPort > 65535 {
+		return fmt.Errorf("redirect.dns_port should between 1 and 65535")
+	}
+	for _, protocol := range c.Protocols {
+		if p := strings.ToLower(protocol); p != "udp" && p != "tcp" {
+			return fmt.Errorf("redirect unknown protocol %s", protocol)
+		}
+	}
+	for _, uid := range c.AppUIDs {
+		if uid < 0 {
+			return fmt.Errorf("redirect.app_uids should greater or equals to 0")
+		}
+	}
+	if c.sidecarUID() == 0 {
+		return fmt.Errorf("redirect.sidecar_uid should be set to the non-root uid the sidecar runs as, " +
+			"the queries of root are not redirected otherwise")
+	}
+	return nil
+}
+
+func (c *Config) protocols() []string {
+	if len(c.Protocols) == 0 {
+		return []string{"udp", "tcp"}
+	}
+	ret := make([]string, 0, len(c.Protocols))
+	for _, protocol := range c.Protocols {
+		ret = append(ret, strings.ToLower(protocol))
+	}
+	return ret
+}
+
+func (c *Config) sidecarUID() int {
+	if c.SidecarUID != nil {
+		return *c.SidecarUID
+	}
+	return os.Getuid()
+}
+
+// backend returns the backend to use, auto is resolved by the binaries found
+func (c *Config) backend() string {
+	if c.Backend != BackendAuto {
+		return c.Backend
+	}
+	if _, err := exec.LookPath("nft"); err == nil {
+		return BackendNFTables
+	}
+	return BackendIPTables
+}
@@ -0,0 +1,109 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redirect
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+)
+
+// Runner runs the commands rendering the rules
+type Runner interface {
+	Run(command Command) error
+}
+
+type execRunner struct{}
+
+// Run executes the command
+func (execRunner) Run(command Command) error {
+	output, err := exec.Command(command.Name, command.Args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v, output: %s", command, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// DryRunner prints the commands instead of running them
+type DryRunner struct {
+	Out io.Writer
+}
+
+// Run prints the command
+func (r DryRunner) Run(command Command) error {
+	_, err := fmt.Fprintln(r.Out, command.String())
+	return err
+}
+
+// Manager installs and removes the redirect rules
+type Manager struct {
+	config    *Config
+	install   []Command
+	uninstall []Command
+	runner    Runner
+}
+
+// NewManager creates the manager running the commands with the runner, the commands are
+// executed when the runner is nil
+func NewManager(config *Config, runner Runner) (*Manager, error) {
+	if err := config.Verify(); err != nil {
+		return nil, err
+	}
+	if runner == nil {
+		runner = execRunner{}
+	}
+	backend := config.backend()
+	install, uninstall := Render(config, backend)
+	log.Infof("[redirect] redirect dns queries to port %d with %s", config.Port, backend)
+	return &Manager{config: config, install: install, uninstall: uninstall, runner: runner}, nil
+}
+
+// Install installs the rules, the rules installed are removed when any of the commands fails
+func (m *Manager) Install() error {
+	for _, command := range m.install {
+		if err := m.runner.Run(command); err != nil {
+			if command.IgnoreError {
+				continue
+			}
+			log.Errorf("[redirect] fail to install rules, err: %v", err)
+			m.Uninstall()
+			return err
+		}
+	}
+	log.Infof("[redirect] success to install redirect rules")
+	return nil
+}
+
+// Uninstall removes the rules, the absent rules are ignored
+func (m *Manager) Uninstall() error {
+	for _, command := range m.uninstall {
+		if err := m.runner.Run(command); err != nil && !command.IgnoreError {
+			return err
+		}
+	}
+	log.Infof("[redirect] success to remove redirect rules")
+	return nil
+}
+
+// CleanupOnExit returns whether the rules should be removed when the sidecar exits
+func (m *Manager) CleanupOnExit() bool {
+	return m.config.CleanupOnExit
+}
@@ -0,0 +1,142 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redirect
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// chainName the iptables chain holding the redirect rules
+	chainName = "POLARIS_SIDECAR_DNS"
+	// tableName the nftables table holding the redirect rules
+	tableName = "polaris_sidecar_dns"
+)
+
+// Command the command to install or remove the rules
+type Command struct {
+	Name string
+	Args []string
+	// IgnoreError the failure of the command is ignored, such as removing the absent rules
+	IgnoreError bool
+}
+
+// String returns the shell form of the command
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Render renders the commands to install and remove the redirect rules of the backend,
+// the commands run in the network namespace when the config has one
+func Render(c *Config, backend string) (install []Command, uninstall []Command) {
+	if backend == BackendNFTables {
+		install, uninstall = renderNFTables(c)
+	} else {
+		install, uninstall = renderIPTables(c)
+	}
+	if len(c.Netns) > 0 {
+		install = inNetns(c.Netns, install)
+		uninstall = inNetns(c.Netns, uninstall)
+	}
+	return install, uninstall
+}
+
+func inNetns(netns string, commands []Command) []Command {
+	ret := make([]Command, 0, len(commands))
+	for _, command := range commands {
+		ret = append(ret, Command{
+			Name:        "nsenter",
+			Args:        append([]string{"--net=" + netns, "--", command.Name}, command.Args...),
+			IgnoreError: command.IgnoreError,
+		})
+	}
+	return ret
+}
+
+func renderIPTables(c *Config) ([]Command, []Command) {
+	binaries := []string{"iptables"}
+	if c.IPv6 {
+		binaries = append(binaries, "ip6tables")
+	}
+	var install, uninstall []Command
+	for _, binary := range binaries {
+		cmd := func(ignoreError bool, args ...string) Command {
+			return Command{Name: binary, Args: append([]string{"-t", "nat"}, args...), IgnoreError: ignoreError}
+		}
+		// the stale rules of the previous run are removed before installing
+		remove := []Command{
+			cmd(true, "-D", "OUTPUT", "-j", chainName),
+			cmd(true, "-F", chainName),
+			cmd(true, "-X", chainName),
+		}
+		install = append(install, remove...)
+		install = append(install, cmd(false, "-N", chainName))
+		install = append(install, cmd(false, "-A", chainName, "-m", "owner",
+			"--uid-owner", strconv.Itoa(c.sidecarUID()), "-j", "RETURN"))
+		for _, protocol := range c.protocols() {
+			redirect := []string{"-p", protocol, "--dport", strconv.Itoa(c.DNSPort),
+				"-j", "REDIRECT", "--to-ports", strconv.Itoa(c.Port)}
+			if len(c.AppUIDs) == 0 {
+				install = append(install, cmd(false, append([]string{"-A", chainName}, redirect...)...))
+				continue
+			}
+			for _, uid := range c.AppUIDs {
+				args := append([]string{"-A", chainName, "-m", "owner", "--uid-owner", strconv.Itoa(uid)}, redirect...)
+				install = append(install, cmd(false, args...))
+			}
+		}
+		install = append(install, cmd(false, "-A", "OUTPUT", "-j", chainName))
+		uninstall = append(uninstall, remove...)
+	}
+	return install, uninstall
+}
+
+func renderNFTables(c *Config) ([]Command, []Command) {
+	family := "ip"
+	if c.IPv6 {
+		family = "inet"
+	}
+	// the arguments follow --, so that the negative priority is not parsed as an option
+	cmd := func(ignoreError bool, args ...string) Command {
+		return Command{Name: "nft", Args: append([]string{"--"}, args...), IgnoreError: ignoreError}
+	}
+	remove := cmd(true, "delete", "table", family, tableName)
+	install := []Command{
+		remove,
+		cmd(false, "add", "table", family, tableName),
+		cmd(false, "add", "chain", family, tableName, "output",
+			"{", "type", "nat", "hook", "output", "priority", "-100", ";", "}"),
+		cmd(false, "add", "rule", family, tableName, "output",
+			"meta", "skuid", strconv.Itoa(c.sidecarUID()), "return"),
+	}
+	var owner []string
+	if len(c.AppUIDs) > 0 {
+		uids := make([]string, 0, len(c.AppUIDs))
+		for _, uid := range c.AppUIDs {
+			uids = append(uids, strconv.Itoa(uid))
+		}
+		owner = []string{"meta", "skuid", "{", strings.Join(uids, ", "), "}"}
+	}
+	for _, protocol := range c.protocols() {
+		args := append([]string{"add", "rule", family, tableName, "output"}, owner...)
+		args = append(args, protocol, "dport", strconv.Itoa(c.DNSPort), "redirect", "to", ":"+strconv.Itoa(c.Port))
+		install = append(install, cmd(false, args...))
+	}
+	return install, []Command{remove}
+}
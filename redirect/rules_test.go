@@ -0,0 +1,117 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redirect
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() *Config {
+	conf := DefaultConfig()
+	sidecarUID := 1337
+	conf.Port = 15053
+	conf.SidecarUID = &sidecarUID
+	conf.AppUIDs = []int{1000}
+	conf.IPv6 = false
+	return conf
+}
+
+func TestRender(t *testing.T) {
+	install, uninstall := Render(testConfig(), BackendIPTables)
+	assert.Equal(t, []string{
+		"iptables -t nat -D OUTPUT -j POLARIS_SIDECAR_DNS",
+		"iptables -t nat -F POLARIS_SIDECAR_DNS",
+		"iptables -t nat -X POLARIS_SIDECAR_DNS",
+		"iptables -t nat -N POLARIS_SIDECAR_DNS",
+		"iptables -t nat -A POLARIS_SIDECAR_DNS -m owner --uid-owner 1337 -j RETURN",
+		"iptables -t nat -A POLARIS_SIDECAR_DNS -m owner --uid-owner 1000 -p udp --dport 53 -j REDIRECT --to-ports 15053",
+		"iptables -t nat -A POLARIS_SIDECAR_DNS -m owner --uid-owner 1000 -p tcp --dport 53 -j REDIRECT --to-ports 15053",
+		"iptables -t nat -A OUTPUT -j POLARIS_SIDECAR_DNS",
+	}, commandLines(install))
+	assert.Len(t, uninstall, 3)
+
+	conf := testConfig()
+	conf.Netns = "/proc/100/ns/net"
+	conf.Protocols = []string{"UDP"}
+	install, uninstall = Render(conf, BackendNFTables)
+	assert.Equal(t, []string{
+		"nsenter --net=/proc/100/ns/net -- nft -- delete table ip polaris_sidecar_dns",
+		"nsenter --net=/proc/100/ns/net -- nft -- add table ip polaris_sidecar_dns",
+		"nsenter --net=/proc/100/ns/net -- nft -- add chain ip polaris_sidecar_dns output " +
+			"{ type nat hook output priority -100 ; }",
+		"nsenter --net=/proc/100/ns/net -- nft -- add rule ip polaris_sidecar_dns output meta skuid 1337 return",
+		"nsenter --net=/proc/100/ns/net -- nft -- add rule ip polaris_sidecar_dns output " +
+			"meta skuid { 1000 } udp dport 53 redirect to :15053",
+	}, commandLines(install))
+	assert.Equal(t, []string{"nsenter --net=/proc/100/ns/net -- nft -- delete table ip polaris_sidecar_dns"},
+		commandLines(uninstall))
+}
+
+type failRunner struct {
+	ran []string
+}
+
+func (r *failRunner) Run(command Command) error {
+	r.ran = append(r.ran, command.String())
+	if strings.Contains(command.String(), "REDIRECT") {
+		return errors.New("no such target")
+	}
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	conf := testConfig()
+	conf.Backend = BackendIPTables
+	out := &bytes.Buffer{}
+	manager, err := NewManager(conf, DryRunner{Out: out})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.Install())
+	assert.Equal(t, 8, strings.Count(out.String(), "\n"))
+
+	// the rules are removed when the install fails
+	runner := &failRunner{}
+	manager, err = NewManager(conf, runner)
+	assert.NoError(t, err)
+	assert.Error(t, manager.Install())
+	assert.Equal(t, "iptables -t nat -X POLARIS_SIDECAR_DNS", runner.ran[len(runner.ran)-1])
+
+	conf.Port = 0
+	_, err = NewManager(conf, nil)
+	assert.Error(t, err)
+}
+
+func commandLines(commands []Command) []string {
+	ret := make([]string, 0, len(commands))
+	for _, command := range commands {
+		ret = append(ret, command.String())
+	}
+	return ret
+}
+
+func TestConfig_VerifySidecarUID(t *testing.T) {
+	conf := testConfig()
+	assert.NoError(t, conf.Verify())
+	root := 0
+	conf.SidecarUID = &root
+	assert.Error(t, conf.Verify())
+}
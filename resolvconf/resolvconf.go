@@ -0,0 +1,233 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolvconf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/pkg/watch"
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+const (
+	// DefaultPath the system resolv.conf
+	DefaultPath = "/etc/resolv.conf"
+
+	defaultBackupSuffix     = ".polaris-sidecar.bak"
+	defaultWatchIntervalSec = 5
+
+	managedMarker = "# Generated by polaris-sidecar, do not edit."
+)
+
+// Config the management of the resolv.conf, which points the system resolver at the sidecar
+type Config struct {
+	// Manage rewrites the resolv.conf on startup and restores it on shutdown
+	Manage bool `yaml:"manage"`
+	// Path the resolv.conf to manage
+	Path string `yaml:"path"`
+	// BackupPath the backup of the original resolv.conf, default to <path>.polaris-sidecar.bak
+	BackupPath string `yaml:"backup_path"`
+	// Nameservers the sidecar addresses written as the nameservers, default to the dns listeners on port 53
+	Nameservers []string `yaml:"nameservers"`
+	// WatchIntervalSec the interval to check the external rewrites of the file
+	WatchIntervalSec int `yaml:"watch_interval_sec"`
+	// RestoreOnExit restores the original resolv.conf when the sidecar exits
+	RestoreOnExit bool `yaml:"restore_on_exit"`
+}
+
+// DefaultConfig returns the default resolv.conf config
+func DefaultConfig() *Config {
+	return &Config{
+		Path:             DefaultPath,
+		WatchIntervalSec: defaultWatchIntervalSec,
+		RestoreOnExit:    true,
+	}
+}
+
+// Verify checks the config
+func (c *Config) Verify() error {
+	if len(c.Path) == 0 {
+		return fmt.Errorf("resolv_conf.path should not be empty")
+	}
+	if len(c.Nameservers) == 0 {
+		return fmt.Errorf("resolv_conf.nameservers should not be empty, " +
+			"none of the dns listeners serves port 53")
+	}
+	for _, nameserver := range c.Nameservers {
+		if net.ParseIP(nameserver) == nil {
+			return fmt.Errorf("resolv_conf nameserver %s should be an ip", nameserver)
+		}
+	}
+	if c.WatchIntervalSec <= 0 {
+		return fmt.Errorf("resolv_conf.watch_interval_sec should greater than 0")
+	}
+	return nil
+}
+
+// Backup returns the path of the backup
+func (c *Config) Backup() string {
+	if len(c.BackupPath) > 0 {
+		return c.BackupPath
+	}
+	return c.Path + defaultBackupSuffix
+}
+
+// Manager rewrites the resolv.conf to point at the sidecar
+type Manager struct {
+	config  *Config
+	watcher *watch.FileWatcher
+
+	lock     sync.Mutex
+	rendered []byte
+}
+
+// NewManager creates the manager of the resolv.conf
+func NewManager(config *Config) (*Manager, error) {
+	if err := config.Verify(); err != nil {
+		return nil, err
+	}
+	return &Manager{
+		config:  config,
+		watcher: watch.NewFileWatcher(config.Path, time.Duration(config.WatchIntervalSec)*time.Second),
+	}, nil
+}
+
+func isManaged(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(managedMarker))
+}
+
+// Backup backs up the original resolv.conf, which holds the upstream nameservers of the host
+// once the resolv.conf points at the sidecar. The resolv.conf managed by the previous run,
+// such as left by a crash, is not backed up
+func (m *Manager) Backup() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, _, err := m.backup()
+	return err
+}
+
+// backup returns the current content and the original content of the resolv.conf
+func (m *Manager) backup() ([]byte, []byte, error) {
+	content, err := os.ReadFile(m.config.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	if !isManaged(content) {
+		if err := resolver.WriteFileAtomic(m.config.Backup(), content); err != nil {
+			return nil, nil, fmt.Errorf("fail to backup resolv.conf to %s: %v", m.config.Backup(), err)
+		}
+		return content, content, nil
+	}
+	// left by the previous run, render from the backup
+	original, err := os.ReadFile(m.config.Backup())
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolv.conf %s is managed but the backup is missing: %v", m.config.Path, err)
+	}
+	return content, original, nil
+}
+
+// Apply backs up the original resolv.conf and rewrites it to point at the sidecar,
+// the search, domain and options lines of the original are kept
+func (m *Manager) Apply() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	content, original, err := m.backup()
+	if err != nil {
+		return err
+	}
+	m.rendered = render(original, m.config)
+	if !bytes.Equal(content, m.rendered) {
+		// written in place, the resolv.conf is often a bind mount or a symlink
+		if err := os.WriteFile(m.config.Path, m.rendered, 0644); err != nil {
+			return err
+		}
+	}
+	m.watcher.Reset()
+	log.Infof("[resolvconf] %s points at %v, the original is backed up to %s",
+		m.config.Path, m.config.Nameservers, m.config.Backup())
+	return nil
+}
+
+// Restore writes the original resolv.conf back and removes the backup
+func (m *Manager) Restore() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	original, err := os.ReadFile(m.config.Backup())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.config.Path, original, 0644); err != nil {
+		return err
+	}
+	log.Infof("[resolvconf] restored %s from %s", m.config.Path, m.config.Backup())
+	return os.Remove(m.config.Backup())
+}
+
+// RestoreOnExit returns whether the original resolv.conf should be restored when the sidecar exits
+func (m *Manager) RestoreOnExit() bool {
+	return m.config.RestoreOnExit
+}
+
+// Watch re-applies the resolv.conf rewritten externally, such as by DHCP or NetworkManager,
+// the rewritten file is taken as the new original
+func (m *Manager) Watch(ctx context.Context) {
+	m.watcher.Watch(ctx, func(content []byte) {
+		m.lock.Lock()
+		unchanged := bytes.Equal(content, m.rendered)
+		m.lock.Unlock()
+		if unchanged {
+			return
+		}
+		log.Warnf("[resolvconf] %s is rewritten externally, re-apply it", m.config.Path)
+		if err := m.Apply(); err != nil {
+			log.Errorf("[resolvconf] fail to re-apply %s, err: %v", m.config.Path, err)
+		}
+	})
+}
+
+// render renders the resolv.conf pointing at the sidecar from the original
+func render(original []byte, c *Config) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, managedMarker)
+	fmt.Fprintf(buf, "# The original file is backed up to %s\n", c.Backup())
+	for _, nameserver := range c.Nameservers {
+		fmt.Fprintf(buf, "nameserver %s\n", nameserver)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(original))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "search", "domain", "options", "sortlist":
+			fmt.Fprintln(buf, line)
+		}
+	}
+	return buf.Bytes()
+}
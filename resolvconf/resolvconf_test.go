@@ -0,0 +1,76 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolvconf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	original := "nameserver 10.0.0.2\nsearch default.svc.cluster.local svc.cluster.local\noptions ndots:5\n"
+	assert.NoError(t, os.WriteFile(path, []byte(original), 0644))
+
+	conf := DefaultConfig()
+	conf.Manage = true
+	conf.Path = path
+	conf.Nameservers = []string{"127.0.0.1"}
+	conf.WatchIntervalSec = 1
+	manager, err := NewManager(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, manager.Backup())
+	backup, _ := os.ReadFile(conf.Backup())
+	assert.Equal(t, original, string(backup))
+
+	assert.NoError(t, manager.Apply())
+	content, _ := os.ReadFile(path)
+	assert.True(t, isManaged(content))
+	assert.Contains(t, string(content), "nameserver 127.0.0.1\nsearch default.svc.cluster.local")
+	assert.NotContains(t, string(content), "10.0.0.2")
+	// applying again keeps the original backup
+	assert.NoError(t, manager.Apply())
+	assert.NoError(t, manager.Backup())
+	backup, _ = os.ReadFile(conf.Backup())
+	assert.Equal(t, original, string(backup))
+
+	// the external rewrite is taken as the new original
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Watch(ctx)
+	rewritten := "nameserver 10.0.0.3\nsearch example.com\n"
+	assert.NoError(t, os.WriteFile(path, []byte(rewritten), 0644))
+	assert.Eventually(t, func() bool {
+		content, _ := os.ReadFile(path)
+		return isManaged(content)
+	}, 5*time.Second, 100*time.Millisecond)
+	backup, _ = os.ReadFile(conf.Backup())
+	assert.Equal(t, rewritten, string(backup))
+
+	cancel()
+	assert.NoError(t, manager.Restore())
+	content, _ = os.ReadFile(path)
+	assert.Equal(t, rewritten, string(content))
+	_, err = os.Stat(conf.Backup())
+	assert.True(t, os.IsNotExist(err))
+}
@@ -18,7 +18,16 @@
 package resolver
 
 import (
+	"context"
+	"errors"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	debughttp "github.com/polarismesh/polaris-sidecar/pkg/http"
 )
 
 func Test_dnsHandler_preprocess(t *testing.T) {
@@ -77,12 +86,364 @@ func Test_dnsHandler_preprocess(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d := &dnsServer{
-				searchNames: tt.fields.searchNames,
-			}
+			d := buildDNSServer("udp", nil, tt.fields.searchNames, 0, nil, false)
 			if got := d.Preprocess(tt.args.qname); got != tt.want {
 				t.Errorf("dnsHandler.preprocess() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+type testResolver struct {
+	name string
+	resp func(question dns.Question) (*dns.Msg, error)
+}
+
+func (r *testResolver) Name() string {
+	return r.name
+}
+
+func (r *testResolver) Initialize(c *ConfigEntry) error {
+	return nil
+}
+
+func (r *testResolver) Start(context.Context) {
+}
+
+func (r *testResolver) Destroy() {
+}
+
+func (r *testResolver) ServeDNS(ctx context.Context, question dns.Question, qname string) (*dns.Msg, error) {
+	return r.resp(question)
+}
+
+func (r *testResolver) Debugger() []debughttp.DebugHandler {
+	return nil
+}
+
+func answerA(ip string) func(question dns.Question) (*dns.Msg, error) {
+	return func(question dns.Question) (*dns.Msg, error) {
+		msg := &dns.Msg{}
+		msg.Answer = append(msg.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 10},
+			A:   net.ParseIP(ip),
+		})
+		return msg, nil
+	}
+}
+
+func answerErr(err error) func(question dns.Question) (*dns.Msg, error) {
+	return func(question dns.Question) (*dns.Msg, error) {
+		return nil, err
+	}
+}
+
+type testResponseWriter struct {
+	msg *dns.Msg
+}
+
+func (w *testResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+func (w *testResponseWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+}
+
+func (w *testResponseWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+	return nil
+}
+
+func (w *testResponseWriter) Write(b []byte) (int, error) {
+	w.msg = new(dns.Msg)
+	return len(b), w.msg.Unpack(b)
+}
+
+func (w *testResponseWriter) Close() error {
+	return nil
+}
+
+func (w *testResponseWriter) TsigStatus() error {
+	return nil
+}
+
+func (w *testResponseWriter) TsigTimersOnly(bool) {
+}
+
+func (w *testResponseWriter) Hijack() {
+}
+
+func Test_dnsServer_route(t *testing.T) {
+	root := &testResolver{name: "root", resp: answerA("10.0.0.1")}
+	mesh := &testResolver{name: "mesh", resp: answerErr(ErrNotMine)}
+	cluster := &testResolver{name: "cluster", resp: answerErr(ErrNameNotFound)}
+	broken := &testResolver{name: "broken", resp: answerErr(errors.New("polaris server unreachable"))}
+	srvOnly := &testResolver{name: "srv", resp: answerA("10.0.0.4")}
+	entries := []*ConfigEntry{
+		{Name: "srv", Zones: []string{"."}, QTypes: []string{"srv"}, Enable: true},
+		{Name: "root", Suffix: ".", Enable: true},
+		{Name: "mesh", Zones: []string{"mesh"}, Enable: true},
+		{Name: "cluster", Zones: []string{"svc.cluster.local."}, Enable: true},
+		{Name: "broken", Zones: []string{"broken.local"}, Enable: true},
+	}
+	routes, err := buildRoutes(entries, []NamingResolver{root, mesh, cluster, broken, srvOnly})
+	assert.NoError(t, err)
+	assert.Equal(t, "svc.cluster.local.", routes[0].zone)
+
+	d := buildDNSServer("udp", routes, nil, time.Second, nil, false)
+	query := func(qname string, qtype uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(qname, qtype)
+		w := &testResponseWriter{}
+		d.ServeDNS(w, req)
+		return w.msg
+	}
+
+	resp := query("foo.mesh.", dns.TypeA)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Equal(t, "10.0.0.1", resp.Answer[0].(*dns.A).A.String())
+
+	resp = query("foo.default.svc.cluster.local.", dns.TypeA)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	assert.True(t, resp.Authoritative)
+
+	resp = query("foo.broken.local.", dns.TypeA)
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+
+	resp = query("_http._tcp.foo.", dns.TypeSRV)
+	assert.Equal(t, "10.0.0.4", resp.Answer[0].(*dns.A).A.String())
+
+	_, err = buildRoutes([]*ConfigEntry{{Name: "root", Enable: true, QTypes: []string{"BAD"}}}, []NamingResolver{root})
+	assert.Error(t, err)
+}
+
+func Test_dnsServer_validate(t *testing.T) {
+	root := &testResolver{name: "root", resp: answerA("10.0.0.1")}
+	routes, err := buildRoutes([]*ConfigEntry{{Name: "root", Suffix: ".", Enable: true}}, []NamingResolver{root})
+	assert.NoError(t, err)
+	d := buildDNSServer("udp", routes, nil, time.Second, nil, false)
+	serve := func(req *dns.Msg) *dns.Msg {
+		w := &testResponseWriter{}
+		d.ServeDNS(w, req)
+		return w.msg
+	}
+
+	req := new(dns.Msg)
+	req.Id = dns.Id()
+	resp := serve(req)
+	assert.Equal(t, dns.RcodeFormatError, resp.Rcode)
+
+	req = new(dns.Msg)
+	req.SetQuestion("foo.", dns.TypeA)
+	req.Question = append(req.Question, dns.Question{Name: "bar.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	resp = serve(req)
+	assert.Equal(t, dns.RcodeFormatError, resp.Rcode)
+
+	req = new(dns.Msg)
+	req.SetNotify("foo.")
+	resp = serve(req)
+	assert.Equal(t, dns.RcodeNotImplemented, resp.Rcode)
+
+	req = new(dns.Msg)
+	req.SetQuestion("foo.", dns.TypeA)
+	req.Response = true
+	assert.Nil(t, serve(req))
+
+	req = new(dns.Msg)
+	req.SetQuestion("foo.", dns.TypeANY)
+	resp = serve(req)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Equal(t, "RFC8482", resp.Answer[0].(*dns.HINFO).Cpu)
+
+	req = new(dns.Msg)
+	req.SetQuestion("version.bind.", dns.TypeTXT)
+	req.Question[0].Qclass = dns.ClassCHAOS
+	resp = serve(req)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Contains(t, resp.Answer[0].(*dns.TXT).Txt[0], "polaris-sidecar")
+
+	req = new(dns.Msg)
+	req.SetQuestion("foo.bind.", dns.TypeTXT)
+	req.Question[0].Qclass = dns.ClassCHAOS
+	resp = serve(req)
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+
+	req = new(dns.Msg)
+	req.SetQuestion("foo.", dns.TypeA)
+	req.SetEdns0(1232, false)
+	req.IsEdns0().SetVersion(1)
+	resp = serve(req)
+	assert.Equal(t, dns.RcodeBadVers, resp.Rcode)
+	_, err = resp.Pack()
+	assert.NoError(t, err)
+}
+
+func Test_dnsServer_extendedError(t *testing.T) {
+	mesh := &testResolver{name: "mesh", resp: answerErr(NotMine("host foo.mesh. not found in mesh"))}
+	cluster := &testResolver{name: "cluster", resp: answerErr(NameNotFound("foo not found"))}
+	broken := &testResolver{name: "broken", resp: answerErr(NewExtendedError(dns.RcodeServerFailure,
+		dns.ExtendedErrorCodeNoReachableAuthority, "polaris server unreachable"))}
+	entries := []*ConfigEntry{
+		{Name: "mesh", Zones: []string{"mesh"}, Enable: true},
+		{Name: "cluster", Zones: []string{"svc.cluster.local."}, Enable: true},
+		{Name: "broken", Zones: []string{"broken.local"}, Enable: true},
+	}
+	routes, err := buildRoutes(entries, []NamingResolver{mesh, cluster, broken})
+	assert.NoError(t, err)
+	d := buildDNSServer("udp", routes, nil, time.Second, nil, false)
+	query := func(qname string, qtype uint16, edns bool) (*dns.Msg, *dns.EDNS0_EDE) {
+		req := new(dns.Msg)
+		req.SetQuestion(qname, qtype)
+		if edns {
+			req.SetEdns0(1232, false)
+		}
+		w := &testResponseWriter{}
+		d.ServeDNS(w, req)
+		opt := w.msg.IsEdns0()
+		if opt == nil {
+			return w.msg, nil
+		}
+		for _, option := range opt.Option {
+			if ede, ok := option.(*dns.EDNS0_EDE); ok {
+				return w.msg, ede
+			}
+		}
+		return w.msg, nil
+	}
+
+	resp, ede := query("foo.broken.local.", dns.TypeA, true)
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+	assert.Equal(t, dns.ExtendedErrorCodeNoReachableAuthority, ede.InfoCode)
+	assert.Equal(t, "polaris server unreachable", ede.ExtraText)
+
+	resp, ede = query("foo.default.svc.cluster.local.", dns.TypeA, true)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	assert.Equal(t, "foo not found", ede.ExtraText)
+
+	resp, ede = query("foo.mesh.", dns.TypeA, true)
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+	assert.Equal(t, dns.ExtendedErrorCodeNotAuthoritative, ede.InfoCode)
+	assert.Contains(t, ede.ExtraText, "not found in mesh")
+
+	resp, ede = query("foo.", dns.TypeAXFR, true)
+	assert.Equal(t, dns.RcodeRefused, resp.Rcode)
+	assert.Equal(t, dns.ExtendedErrorCodeNotSupported, ede.InfoCode)
+
+	resp, ede = query("foo.broken.local.", dns.TypeA, false)
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+	assert.Nil(t, ede)
+}
+
+func Test_dnsServer_protect(t *testing.T) {
+	root := &testResolver{name: "root", resp: answerA("10.0.0.1")}
+	routes, err := buildRoutes([]*ConfigEntry{{Name: "root", Suffix: ".", Enable: true}}, []NamingResolver{root})
+	assert.NoError(t, err)
+	serve := func(d *dnsServer) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion("foo.", dns.TypeA)
+		w := &testResponseWriter{}
+		d.ServeDNS(w, req)
+		return w.msg
+	}
+
+	d := buildDNSServer("udp", routes, nil, time.Second, nil, false)
+	d.guard, err = newGuard(&ProtectionConfig{AllowCIDRs: []string{"10.0.0.0/8"}})
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeRefused, serve(d).Rcode)
+
+	d.guard, err = newGuard(&ProtectionConfig{AllowCIDRs: []string{"127.0.0.1"}, ClientQPS: 0.001, Slip: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, serve(d).Rcode)
+	// the rate limited udp queries are dropped and truncated alternately
+	assert.Nil(t, serve(d))
+	resp := serve(d)
+	assert.True(t, resp.Truncated)
+	assert.Empty(t, resp.Answer)
+
+	tcp := buildDNSServer("tcp", routes, nil, time.Second, nil, false)
+	tcp.guard = d.guard
+	assert.Equal(t, dns.RcodeRefused, serve(tcp).Rcode)
+
+	_, err = newGuard(&ProtectionConfig{AllowCIDRs: []string{"bad"}})
+	assert.Error(t, err)
+}
+
+func Test_dnsServer_staleAnswer(t *testing.T) {
+	stale := &testResolver{name: "stale", resp: func(question dns.Question) (*dns.Msg, error) {
+		msg, _ := answerA("10.0.0.1")(question)
+		return msg, NewExtendedError(dns.RcodeSuccess, dns.ExtendedErrorCodeStaleAnswer,
+			"polaris server unreachable, serving stale answer")
+	}}
+	routes, err := buildRoutes([]*ConfigEntry{{Name: "stale", Suffix: ".", Enable: true}}, []NamingResolver{stale})
+	assert.NoError(t, err)
+	d := buildDNSServer("udp", routes, nil, time.Second, nil, false)
+	req := new(dns.Msg)
+	req.SetQuestion("foo.", dns.TypeA)
+	req.SetEdns0(1232, false)
+	w := &testResponseWriter{}
+	d.ServeDNS(w, req)
+	assert.Equal(t, dns.RcodeSuccess, w.msg.Rcode)
+	assert.Len(t, w.msg.Answer, 1)
+	ede := w.msg.IsEdns0().Option[0].(*dns.EDNS0_EDE)
+	assert.Equal(t, dns.ExtendedErrorCodeStaleAnswer, ede.InfoCode)
+}
+
+// testRecursor starts an udp recursor answering by the handler, returns its address
+func testRecursor(t *testing.T, handler dns.HandlerFunc) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	svr := &dns.Server{PacketConn: conn, Handler: handler}
+	go svr.ActivateAndServe()
+	t.Cleanup(func() {
+		_ = svr.Shutdown()
+	})
+	return conn.LocalAddr().String()
+}
+
+func Test_dnsServer_recurseTruncate(t *testing.T) {
+	recursor := testRecursor(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(req)
+		count := 40
+		if req.Question[0].Name == "tc.example." {
+			// the records of the truncated answer are incomplete, the signatures are left out
+			msg.Truncated = true
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			msg.Answer = append(msg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 10},
+				A:   net.IPv4(10, 0, 0, byte(i)),
+			})
+		}
+		if opt := req.IsEdns0(); opt != nil {
+			msg.SetEdns0(opt.UDPSize(), opt.Do())
+		}
+		_ = w.WriteMsg(msg)
+	})
+	d := buildDNSServer("udp", nil, nil, time.Second, []string{recursor}, true)
+	validator, err := newDNSSECValidator(&DNSSECConfig{Enable: true}, d.exchange)
+	assert.NoError(t, err)
+	d.validator = validator
+
+	// the answer sized for the forwarded EDNS buffer is truncated for the client without EDNS
+	req := new(dns.Msg)
+	req.SetQuestion("big.example.", dns.TypeA)
+	req.CheckingDisabled = true
+	w := &testResponseWriter{}
+	d.ServeDNS(w, req)
+	assert.Equal(t, dns.RcodeSuccess, w.msg.Rcode)
+	assert.True(t, w.msg.Truncated)
+	assert.Nil(t, w.msg.IsEdns0())
+	assert.LessOrEqual(t, w.msg.Len(), dns.MinMsgSize)
+
+	// the truncated answer is passed on without validation
+	req = new(dns.Msg)
+	req.SetQuestion("tc.example.", dns.TypeA)
+	w = &testResponseWriter{}
+	d.ServeDNS(w, req)
+	assert.Equal(t, dns.RcodeSuccess, w.msg.Rcode)
+	assert.True(t, w.msg.Truncated)
+	assert.Nil(t, w.msg.IsEdns0())
+}
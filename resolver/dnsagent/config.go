@@ -18,14 +18,34 @@
 package dnsagent
 
 import (
-	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+const (
+	defaultStaleMaxAgeSec           = 86400
+	defaultStaleAnswerTtl           = 30
+	defaultStaleSnapshotIntervalSec = 60
 )
 
 type resolverConfig struct {
 	RouteLabelsMap map[string]string `json:"-"`
 	RouteLabels    string            `json:"route_labels"`
+	// ServeStale serves the last good answer when polaris lookup fails, see RFC 8767
+	ServeStale bool `json:"serve_stale"`
+	// StaleMaxAgeSec the answers older than it are not served
+	StaleMaxAgeSec int `json:"stale_max_age_sec"`
+	// StaleAnswerTtl the ttl of the stale answers
+	StaleAnswerTtl int `json:"stale_answer_ttl"`
+	// StaleSnapshotPath persists the stale answers to the file, so that the restarted sidecar
+	// could answer before it reconnects to polaris
+	StaleSnapshotPath string `json:"stale_snapshot_path"`
+	// StaleSnapshotIntervalSec the interval to persist the stale answers
+	StaleSnapshotIntervalSec int `json:"stale_snapshot_interval_sec"`
 }
 
 func parseLabels(value string) map[string]string {
@@ -45,18 +65,50 @@ func parseLabels(value string) map[string]string {
 	return values
 }
 
-func parseOptions(options map[string]interface{}) (*resolverConfig, error) {
-	config := &resolverConfig{}
-	if len(options) == 0 {
-		return config, nil
+// NewOptions returns the options with the default values
+func (r *resolverDiscovery) NewOptions() resolver.Options {
+	return &resolverConfig{
+		StaleMaxAgeSec:           defaultStaleMaxAgeSec,
+		StaleAnswerTtl:           defaultStaleAnswerTtl,
+		StaleSnapshotIntervalSec: defaultStaleSnapshotIntervalSec,
+	}
+}
+
+// Verify checks the options and parses the route labels
+func (c *resolverConfig) Verify() error {
+	c.RouteLabelsMap = parseLabels(c.RouteLabels)
+	if c.StaleMaxAgeSec <= 0 || c.StaleAnswerTtl < 0 || c.StaleSnapshotIntervalSec <= 0 {
+		return fmt.Errorf("%s stale_max_age_sec and stale_snapshot_interval_sec should greater than 0, "+
+			"stale_answer_ttl should greater or equals to 0", name)
 	}
-	jsonBytes, err := json.Marshal(options)
-	if nil != err {
-		return nil, fmt.Errorf("fail to marshal %s config entry, err is %v", name, err)
+	return nil
+}
+
+// ValidateOptions checks the files referenced by the options, the directory of the stale snapshot should exist
+func (r *resolverDiscovery) ValidateOptions(options resolver.Options) error {
+	config := options.(*resolverConfig)
+	if len(config.StaleSnapshotPath) > 0 {
+		if err := resolver.VerifyFileDir(config.StaleSnapshotPath); nil != err {
+			return fmt.Errorf("%s stale_snapshot_path is not writable: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// UpdateOptions applies the changed route labels, the stale options are applied on restart
+func (r *resolverDiscovery) UpdateOptions(options resolver.Options) error {
+	config := options.(*resolverConfig)
+	current := *r.config
+	next := *config
+	current.RouteLabels, current.RouteLabelsMap = "", nil
+	next.RouteLabels, next.RouteLabelsMap = "", nil
+	if !reflect.DeepEqual(current, next) {
+		log.Warnf("[discovery] the changed stale options are applied on restart")
 	}
-	if err = json.Unmarshal(jsonBytes, config); nil != err {
-		return nil, fmt.Errorf("fail to unmarshal %s config entry, err is %v", name, err)
+	previous, _ := r.routeLabels.Load().(map[string]string)
+	if !reflect.DeepEqual(previous, config.RouteLabelsMap) {
+		r.routeLabels.Store(config.RouteLabelsMap)
+		log.Infof("[discovery] route labels changed %v -> %v", previous, config.RouteLabelsMap)
 	}
-	config.RouteLabelsMap = parseLabels(config.RouteLabels)
-	return config, nil
+	return nil
 }
@@ -20,13 +20,18 @@ package dnsagent
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/polarismesh/polaris-go"
 	"github.com/polarismesh/polaris-go/pkg/model"
+	apimodel "github.com/polarismesh/specification/source/go/api/v1/model"
 	"go.uber.org/zap"
 
 	"github.com/polarismesh/polaris-sidecar/pkg/client"
@@ -47,6 +52,12 @@ type resolverDiscovery struct {
 	dnsTtl    int
 	config    *resolverConfig
 	namespace string
+	stale     *resolver.StaleCache
+	// zones the zones configured explicitly, the polaris failures of the names in them are answered
+	// SERVFAIL, the names out of them are recursed
+	zones []string
+	// routeLabels the route labels changed at runtime
+	routeLabels atomic.Value
 }
 
 // Name will return the name to resolver
@@ -56,11 +67,12 @@ func (r *resolverDiscovery) Name() string {
 
 // Initialize will init the resolver on startup
 func (r *resolverDiscovery) Initialize(c *resolver.ConfigEntry) error {
-	var err error
-	r.config, err = parseOptions(c.Option)
+	options, err := resolver.ParseOptions(r, c.Option)
 	if nil != err {
 		return err
 	}
+	r.config = options.(*resolverConfig)
+	r.routeLabels.Store(r.config.RouteLabelsMap)
 	r.consumer, err = client.GetConsumerAPI()
 	if nil != err {
 		return err
@@ -72,12 +84,62 @@ func (r *resolverDiscovery) Initialize(c *resolver.ConfigEntry) error {
 	}
 	r.dnsTtl = c.DnsTtl
 	r.namespace = c.Namespace
+	r.zones = ownedZones(c)
+	if r.config.ServeStale {
+		r.stale = resolver.NewStaleCache(time.Duration(r.config.StaleMaxAgeSec)*time.Second,
+			uint32(r.config.StaleAnswerTtl))
+		if len(r.config.StaleSnapshotPath) > 0 {
+			if err := r.stale.Restore(r.config.StaleSnapshotPath); nil != err && !os.IsNotExist(err) {
+				log.Warnf("[discovery] fail to restore stale snapshot %s, err: %v", r.config.StaleSnapshotPath, err)
+			} else {
+				log.Infof("[discovery] restored %d stale answers from %s", r.stale.Len(), r.config.StaleSnapshotPath)
+			}
+		}
+	}
 	return err
 }
 
 // Start the plugin runnable
-func (r *resolverDiscovery) Start(context.Context) {
+func (r *resolverDiscovery) Start(ctx context.Context) {
+	if r.stale == nil {
+		return
+	}
+	go r.maintainStale(ctx)
+}
+
+// maintainStale prunes the expired stale answers and persists the others periodically
+func (r *resolverDiscovery) maintainStale(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.config.StaleSnapshotIntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.saveStale()
+			return
+		case <-ticker.C:
+			r.stale.Prune()
+			r.saveStale()
+		}
+	}
+}
+
+func (r *resolverDiscovery) saveStale() {
+	if len(r.config.StaleSnapshotPath) == 0 {
+		return
+	}
+	if err := r.stale.Save(r.config.StaleSnapshotPath); nil != err {
+		log.Errorf("[discovery] fail to save stale snapshot %s, err: %v", r.config.StaleSnapshotPath, err)
+	}
+}
 
+// FlushCache removes the stale answers, the snapshot is rewritten so that they are not restored
+func (r *resolverDiscovery) FlushCache() int {
+	if r.stale == nil {
+		return 0
+	}
+	count := r.stale.Flush()
+	r.saveStale()
+	return count
 }
 
 func (r *resolverDiscovery) Debugger() []debughttp.DebugHandler {
@@ -105,43 +167,48 @@ func canDoResolve(qType uint16) bool {
 	return false
 }
 
-// ServeDNS is like dns.Handler except ServeDNS may return an rcode
-// and/or error.
-// If ServeDNS writes to the response body, it should return a status
-// code. Resolvers assumes *no* reply has yet been written if the status
-// code is one of the following:
-//
-// * SERVFAIL (dns.RcodeServerFailure)
-//
-// * REFUSED (dns.RecodeRefused)
-//
-// * NOTIMP (dns.RcodeNotImplemented)
-func (r *resolverDiscovery) ServeDNS(ctx context.Context, question dns.Question, qname string) *dns.Msg {
+// ServeDNS is like dns.Handler except ServeDNS returns the response or an error.
+// The names which are not registered in polaris return resolver.ErrNotMine,
+// so that the query could be answered by the other resolvers or recursors.
+// So do the names failed to lookup out of the zones configured explicitly.
+func (r *resolverDiscovery) ServeDNS(ctx context.Context, question dns.Question, qname string) (*dns.Msg, error) {
 	if !canDoResolve(question.Qtype) {
-		return nil
+		return nil, resolver.ErrNotMine
 	}
 
 	msg := &dns.Msg{}
 	labels := dns.SplitDomainName(qname)
 	for i := range labels {
-		if labels[i] == "_addr" {
+		if labels[i] == "_addr" && i > 0 {
 			ret, err := hex.DecodeString(labels[i-1])
 			if err != nil {
 				log.Error("decode ip str fail", zap.String("domain", qname), zap.Error(err))
-				return nil
+				return nil, resolver.NameNotFound("invalid address label %s", labels[i-1])
 			}
 			rr := r.markRecord(question, net.IP(ret), nil)
 			msg.Answer = append(msg.Answer, rr)
-			return msg
+			return msg, nil
 		}
 	}
 
-	instances, err := r.lookupFromPolaris(qname, r.namespace)
+	instances, err := r.lookupFromPolaris(ctx, qname, r.namespace)
 	if err != nil {
-		return nil
-	}
-	if instances == nil {
-		return nil
+		if r.stale != nil && !errors.Is(err, resolver.ErrNotMine) {
+			if staleMsg, ok := r.stale.Load(question); ok {
+				reason := err.Error()
+				var extendedErr *resolver.ExtendedError
+				if errors.As(err, &extendedErr) {
+					reason = extendedErr.Text
+				}
+				return staleMsg, resolver.NewExtendedError(dns.RcodeSuccess, dns.ExtendedErrorCodeStaleAnswer,
+					"%s, serving stale answer", reason).Wrap(err)
+			}
+		}
+		// the outage of polaris should not fail the names resolved by the recursors
+		if !errors.Is(err, resolver.ErrNotMine) && !r.ownsZone(qname) {
+			return nil, resolver.NotMine("polaris lookup failed, %v", err)
+		}
+		return nil, err
 	}
 
 	//do reorder and unique
@@ -153,30 +220,116 @@ func (r *resolverDiscovery) ServeDNS(ctx context.Context, question dns.Question,
 
 	msg.Authoritative = true
 	msg.Rcode = dns.RcodeSuccess
+	if r.stale != nil {
+		r.stale.Store(question, msg)
+	}
 
-	return msg
+	return msg, nil
 }
 
-func (r *resolverDiscovery) lookupFromPolaris(qname string, currentNs string) ([]model.Instance, error) {
+func (r *resolverDiscovery) lookupFromPolaris(ctx context.Context, qname string,
+	currentNs string) ([]model.Instance, error) {
 	svcKey := resolver.ParseQname(qname, r.suffix, currentNs)
 	if nil == svcKey {
-		return nil, nil
+		return nil, resolver.ErrNotMine
 	}
 	request := &polaris.GetOneInstanceRequest{}
 	request.Namespace = svcKey.Namespace
 	request.Service = svcKey.Service
-	if len(r.config.RouteLabelsMap) > 0 {
-		request.SourceService = &model.ServiceInfo{Metadata: r.config.RouteLabelsMap}
+	if deadline, ok := ctx.Deadline(); ok {
+		// part of the deadline is left for serving the stale answer when the lookup times out
+		timeout := time.Until(deadline) * 4 / 5
+		if timeout <= 0 {
+			return nil, lookupError(ctx.Err())
+		}
+		retryCount := 0
+		request.Timeout = &timeout
+		request.RetryCount = &retryCount
+	}
+	if routeLabels, _ := r.routeLabels.Load().(map[string]string); len(routeLabels) > 0 {
+		request.SourceService = &model.ServiceInfo{Metadata: routeLabels}
 	}
 	resp, err := r.consumer.GetOneInstance(request)
 	if nil != err {
+		if isNotFound(err) {
+			log.Debugf("[discovery] service %s not found, err: %v", *svcKey, err)
+			return nil, resolver.NotMine("service %s not found in namespace %s", svcKey.Service, svcKey.Namespace)
+		}
 		log.Errorf("[discovery] fail to lookup service %s, err: %v", *svcKey, err)
-		return nil, err
+		return nil, lookupError(err)
+	}
+	if len(resp.GetInstances()) == 0 {
+		return nil, resolver.NotMine("service %s has no available instance in namespace %s",
+			svcKey.Service, svcKey.Namespace)
 	}
-
 	return resp.GetInstances(), nil
 }
 
+// ownedZones returns the zones or the suffix of the config except the root zone
+func ownedZones(c *resolver.ConfigEntry) []string {
+	zones := c.Zones
+	if len(zones) == 0 {
+		zones = []string{c.Suffix}
+	}
+	var ret []string
+	for _, zone := range zones {
+		zone = dns.Fqdn(strings.ToLower(strings.TrimSpace(zone)))
+		if zone == resolver.Quota {
+			continue
+		}
+		ret = append(ret, zone)
+	}
+	return ret
+}
+
+// ownsZone checks whether the name is in the zones configured explicitly
+func (r *resolverDiscovery) ownsZone(qname string) bool {
+	qname = strings.ToLower(qname)
+	for _, zone := range r.zones {
+		if dns.IsSubDomain(zone, qname) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound checks whether the polaris error means the service or instance does not exist
+func isNotFound(err error) bool {
+	sdkErr, ok := err.(model.SDKError)
+	if !ok {
+		return false
+	}
+	switch sdkErr.ErrorCode() {
+	case model.ErrCodeServiceNotFound, model.ErrCodeAPIInstanceNotFound:
+		return true
+	}
+	switch apimodel.Code(sdkErr.ServerCode()) {
+	case apimodel.Code_NotFoundResource, apimodel.Code_NotFoundService, apimodel.Code_NotFoundInstance:
+		return true
+	}
+	return false
+}
+
+// lookupError classifies the polaris error into the extended dns error answered to the client
+func lookupError(err error) error {
+	sdkErr, ok := err.(model.SDKError)
+	if !ok {
+		return resolver.NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeOther,
+			"polaris lookup failed").Wrap(err)
+	}
+	switch sdkErr.ErrorCode() {
+	case model.ErrCodeNetworkError, model.ErrCodeConnectError, model.ErrorCodeRpcError,
+		model.ErrorCodeRpcTimeout, model.ErrCodeAPITimeoutError, model.ErrCodeServerException:
+		return resolver.NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNoReachableAuthority,
+			"polaris server unreachable").Wrap(err)
+	case model.ErrCodeRequestLimit:
+		return resolver.NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeOther,
+			"rate limited by polaris server").Wrap(err)
+	}
+	return resolver.NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeOther,
+		"polaris lookup failed").Wrap(err)
+}
+
 func encodeIPAsFqdn(ip net.IP, svcKey model.ServiceKey) string {
 	respDomain := fmt.Sprintf("%s._addr.%s.%s", hex.EncodeToString(ip), svcKey.Service, svcKey.Namespace)
 	return dns.Fqdn(respDomain)
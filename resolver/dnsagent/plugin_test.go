@@ -18,13 +18,18 @@
 package dnsagent
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"net"
 	"testing"
 
 	"github.com/miekg/dns"
+	"github.com/polarismesh/polaris-go"
 	"github.com/polarismesh/polaris-go/pkg/model"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
 )
 
 func Test_encodeIPAsFqdn(t *testing.T) {
@@ -109,3 +114,37 @@ func Test_encodeIPAsFqdn(t *testing.T) {
 		})
 	}
 }
+
+// unreachableConsumer fails the lookups like an unreachable polaris server
+type unreachableConsumer struct {
+	polaris.ConsumerAPI
+}
+
+func (c *unreachableConsumer) GetOneInstance(req *polaris.GetOneInstanceRequest) (*model.OneInstanceResponse, error) {
+	return nil, model.NewSDKError(model.ErrCodeNetworkError, nil, "connection refused")
+}
+
+func Test_resolverDiscovery_ServeDNSUnreachable(t *testing.T) {
+	question := func(name string) dns.Question {
+		return dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	}
+	r := &resolverDiscovery{consumer: &unreachableConsumer{}, suffix: ".", namespace: "default",
+		config: &resolverConfig{}}
+	r.zones = ownedZones(&resolver.ConfigEntry{Suffix: "."})
+
+	// the names are recursed with the default root suffix
+	_, err := r.ServeDNS(context.Background(), question("www.google.com."), "www.google.com.")
+	assert.True(t, errors.Is(err, resolver.ErrNotMine))
+
+	// the names in the zones configured are answered SERVFAIL
+	r.zones = ownedZones(&resolver.ConfigEntry{Suffix: ".", Zones: []string{"polaris."}})
+	_, err = r.ServeDNS(context.Background(), question("echo.default.polaris."), "echo.default.polaris.")
+	assert.False(t, errors.Is(err, resolver.ErrNotMine))
+	var extendedErr *resolver.ExtendedError
+	assert.True(t, errors.As(err, &extendedErr))
+	assert.Equal(t, dns.RcodeServerFailure, extendedErr.Rcode)
+	assert.Equal(t, dns.ExtendedErrorCodeNoReachableAuthority, extendedErr.Code)
+
+	_, err = r.ServeDNS(context.Background(), question("www.google.com."), "www.google.com.")
+	assert.True(t, errors.Is(err, resolver.ErrNotMine))
+}
@@ -0,0 +1,613 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+)
+
+const (
+	// maxValidateDepth the max length of the chain of trust
+	maxValidateDepth = 16
+	// maxKeyCacheTtl the max time the validated zone keys are cached
+	maxKeyCacheTtl = time.Hour
+)
+
+// defaultTrustAnchors the DS records of the root zone KSK-2017 and KSK-2024
+var defaultTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// DNSSECConfig dnssec validation config of the recursion
+type DNSSECConfig struct {
+	// Enable validate the answers from the upstreams
+	Enable bool `yaml:"enable"`
+	// TrustAnchors DS or DNSKEY records in presentation format, default to the root zone anchors
+	TrustAnchors []string `yaml:"trust_anchors"`
+	// TrustAnchorFile file which contains the DS or DNSKEY records, one record per line
+	TrustAnchorFile string `yaml:"trust_anchor_file"`
+}
+
+// errInsecure the chain of trust ends at an unsigned delegation
+var errInsecure = errors.New("insecure delegation")
+
+// zoneCut the kind of the name in the zone of its parent
+type zoneCut int
+
+const (
+	// cutNone the name is not a zone cut, it stays in the zone of the parent
+	cutNone zoneCut = iota
+	// cutSecure the name is a delegation with the DS records validated
+	cutSecure
+	// cutInsecure the name is a delegation proven to have no DS records
+	cutInsecure
+)
+
+type cachedCut struct {
+	cut      zoneCut
+	expireAt time.Time
+}
+
+type zoneKeys struct {
+	keys     []*dns.DNSKEY
+	expireAt time.Time
+}
+
+// dnssecValidator validates the signatures of the answers from the upstreams, the keys are
+// validated by the chain of DS records up to the configured trust anchors.
+// Negative answers are not validated, as the denial of existence proofs are not checked.
+type dnssecValidator struct {
+	anchors  map[string][]*dns.DS
+	exchange func(ctx context.Context, req *dns.Msg) (*dns.Msg, error)
+	lock     sync.RWMutex
+	keys     map[string]*zoneKeys
+	cuts     map[string]*cachedCut
+}
+
+// Verify checks the trust anchors and the trust anchor file
+func (c *DNSSECConfig) Verify() error {
+	_, err := c.anchors()
+	return err
+}
+
+// anchors returns the DS records of the trust anchors by zone
+func (c *DNSSECConfig) anchors() (map[string][]*dns.DS, error) {
+	records := append([]string{}, c.TrustAnchors...)
+	if len(c.TrustAnchorFile) > 0 {
+		content, err := os.ReadFile(c.TrustAnchorFile)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read trust anchor file %s, err: %v", c.TrustAnchorFile, err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 || strings.HasPrefix(line, ";") {
+				continue
+			}
+			records = append(records, line)
+		}
+	}
+	if len(records) == 0 {
+		records = defaultTrustAnchors
+	}
+	anchors := make(map[string][]*dns.DS, len(records))
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse trust anchor %s, err: %v", record, err)
+		}
+		var ds *dns.DS
+		switch anchor := rr.(type) {
+		case *dns.DS:
+			ds = anchor
+		case *dns.DNSKEY:
+			ds = anchor.ToDS(dns.SHA256)
+		default:
+			return nil, fmt.Errorf("trust anchor %s should be DS or DNSKEY record", record)
+		}
+		if ds == nil {
+			return nil, fmt.Errorf("fail to parse trust anchor %s", record)
+		}
+		zone := strings.ToLower(ds.Hdr.Name)
+		anchors[zone] = append(anchors[zone], ds)
+	}
+	return anchors, nil
+}
+
+func newDNSSECValidator(conf *DNSSECConfig, exchange func(ctx context.Context, req *dns.Msg) (*dns.Msg, error)) (*dnssecValidator, error) {
+	anchors, err := conf.anchors()
+	if err != nil {
+		return nil, err
+	}
+	return &dnssecValidator{
+		anchors:  anchors,
+		exchange: exchange,
+		keys:     map[string]*zoneKeys{},
+		cuts:     map[string]*cachedCut{},
+	}, nil
+}
+
+// validate validates the answer of the response, returns true if all the answers are secure,
+// false if some answers are insecure, and the error if any answer is bogus. The status of each
+// rrset is decided by the chain of trust of its own zone, so that an unsigned rrset is accepted
+// only when its zone is proven to be under an insecure delegation
+func (v *dnssecValidator) validate(ctx context.Context, resp *dns.Msg) (bool, error) {
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		return false, nil
+	}
+	rrsets, sigs := splitRRSets(resp.Answer)
+	secure := true
+	for key, rrset := range rrsets {
+		var err error
+		if rrsetSigs := sigs[key]; len(rrsetSigs) > 0 {
+			err = v.verifyRRSet(ctx, rrset, rrsetSigs, 0)
+		} else {
+			err = v.verifyUnsigned(ctx, rrset[0].Header().Name, 0)
+		}
+		if errors.Is(err, errInsecure) {
+			secure = false
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return secure, nil
+}
+
+func rrsetKey(name string, rrtype uint16, class uint16) string {
+	return fmt.Sprintf("%s/%d/%d", strings.ToLower(name), rrtype, class)
+}
+
+// splitRRSets groups the records into rrsets and the signatures covering them
+func splitRRSets(records []dns.RR) (map[string][]dns.RR, map[string][]*dns.RRSIG) {
+	rrsets := map[string][]dns.RR{}
+	sigs := map[string][]*dns.RRSIG{}
+	for _, rr := range records {
+		hdr := rr.Header()
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := rrsetKey(hdr.Name, sig.TypeCovered, hdr.Class)
+			sigs[key] = append(sigs[key], sig)
+			continue
+		}
+		key := rrsetKey(hdr.Name, hdr.Rrtype, hdr.Class)
+		rrsets[key] = append(rrsets[key], rr)
+	}
+	return rrsets, sigs
+}
+
+func (v *dnssecValidator) verifyRRSet(ctx context.Context, rrset []dns.RR, sigs []*dns.RRSIG, depth int) error {
+	owner := rrset[0].Header().Name
+	if len(sigs) == 0 {
+		return NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeRRSIGsMissing,
+			"rrsig missing for %s %s", owner, dns.TypeToString[rrset[0].Header().Rrtype])
+	}
+	var lastErr error
+	now := time.Now()
+	for _, sig := range sigs {
+		if !dns.IsSubDomain(sig.SignerName, owner) {
+			lastErr = NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSBogus,
+				"signer %s is not the ancestor of %s", sig.SignerName, owner)
+			continue
+		}
+		if !sig.ValidityPeriod(now) {
+			code := dns.ExtendedErrorCodeSignatureExpired
+			if now.Before(time.Unix(int64(sig.Inception), 0)) {
+				code = dns.ExtendedErrorCodeSignatureNotYetValid
+			}
+			lastErr = NewExtendedError(dns.RcodeServerFailure, code,
+				"signature of %s by %s is out of validity period", owner, sig.SignerName)
+			continue
+		}
+		keys, err := v.zoneKeys(ctx, sig.SignerName, depth)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := verifyWithKeys(sig, keys, rrset); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+func verifyWithKeys(sig *dns.RRSIG, keys []*dns.DNSKEY, rrset []dns.RR) error {
+	var verifyErr error
+	for _, key := range keys {
+		if key.Algorithm != sig.Algorithm || key.KeyTag() != sig.KeyTag {
+			continue
+		}
+		if verifyErr = sig.Verify(key, rrset); verifyErr == nil {
+			return nil
+		}
+	}
+	if verifyErr == nil {
+		return NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSKEYMissing,
+			"dnskey %d of %s not found", sig.KeyTag, sig.SignerName)
+	}
+	return NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSBogus,
+		"signature of %s by %s is bogus", sig.Header().Name, sig.SignerName).Wrap(verifyErr)
+}
+
+// zoneKeys returns the validated DNSKEY records of the zone
+func (v *dnssecValidator) zoneKeys(ctx context.Context, zone string, depth int) ([]*dns.DNSKEY, error) {
+	zone = strings.ToLower(dns.Fqdn(zone))
+	if depth > maxValidateDepth {
+		return nil, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSSECIndeterminate,
+			"chain of trust of %s is too long", zone)
+	}
+	v.lock.RLock()
+	cached, ok := v.keys[zone]
+	v.lock.RUnlock()
+	if ok && time.Now().Before(cached.expireAt) {
+		return cached.keys, nil
+	}
+
+	resp, err := v.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*dns.DNSKEY
+	var keySet []dns.RR
+	var keySigs []*dns.RRSIG
+	ttl := uint32(maxKeyCacheTtl / time.Second)
+	for _, rr := range resp.Answer {
+		switch record := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, record)
+			keySet = append(keySet, record)
+			if record.Hdr.Ttl < ttl {
+				ttl = record.Hdr.Ttl
+			}
+		case *dns.RRSIG:
+			if record.TypeCovered == dns.TypeDNSKEY {
+				keySigs = append(keySigs, record)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSKEYMissing,
+			"dnskey of %s not found", zone)
+	}
+
+	trustedDS, err := v.trustedDS(ctx, zone, depth)
+	if err != nil {
+		return nil, err
+	}
+	var trustedKeys []*dns.DNSKEY
+	for _, key := range keys {
+		for _, ds := range trustedDS {
+			if key.Algorithm != ds.Algorithm || key.KeyTag() != ds.KeyTag {
+				continue
+			}
+			keyDS := key.ToDS(ds.DigestType)
+			if keyDS != nil && strings.EqualFold(keyDS.Digest, ds.Digest) {
+				trustedKeys = append(trustedKeys, key)
+			}
+		}
+	}
+	if len(trustedKeys) == 0 {
+		return nil, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSKEYMissing,
+			"no dnskey of %s matches the ds records", zone)
+	}
+	var verifyErr error = NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeRRSIGsMissing,
+		"rrsig missing for dnskey of %s", zone)
+	now := time.Now()
+	for _, sig := range keySigs {
+		if !sig.ValidityPeriod(now) {
+			verifyErr = NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeSignatureExpired,
+				"signature of dnskey of %s is out of validity period", zone)
+			continue
+		}
+		if verifyErr = verifyWithKeys(sig, trustedKeys, keySet); verifyErr == nil {
+			break
+		}
+	}
+	if verifyErr != nil {
+		return nil, verifyErr
+	}
+
+	v.lock.Lock()
+	v.keys[zone] = &zoneKeys{keys: keys, expireAt: now.Add(time.Duration(ttl) * time.Second)}
+	v.lock.Unlock()
+	log.Debugf("[agent] dnssec keys of zone %s validated", zone)
+	return keys, nil
+}
+
+// trustedDS returns the trust anchors of the zone, or the DS records validated by the parent zone
+func (v *dnssecValidator) trustedDS(ctx context.Context, zone string, depth int) ([]*dns.DS, error) {
+	if anchors, ok := v.anchors[zone]; ok {
+		return anchors, nil
+	}
+	if zone == Quota {
+		return nil, errInsecure
+	}
+	resp, err := v.query(ctx, zone, dns.TypeDS)
+	if err != nil {
+		return nil, err
+	}
+	var dsSet []dns.RR
+	var dsSigs []*dns.RRSIG
+	var trusted []*dns.DS
+	for _, rr := range resp.Answer {
+		switch record := rr.(type) {
+		case *dns.DS:
+			dsSet = append(dsSet, record)
+			trusted = append(trusted, record)
+		case *dns.RRSIG:
+			if record.TypeCovered == dns.TypeDS {
+				dsSigs = append(dsSigs, record)
+			}
+		}
+	}
+	if len(dsSet) == 0 {
+		// the missing DS records are insecure only if the delegation is proven to be unsigned
+		if _, err := v.secureZone(ctx, zone, depth+1); err != nil {
+			return nil, err
+		}
+		return nil, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSBogus,
+			"ds records of %s are missing", zone)
+	}
+	if err := v.verifyRRSet(ctx, dsSet, dsSigs, depth+1); err != nil {
+		return nil, err
+	}
+	return trusted, nil
+}
+
+// verifyUnsigned checks the unsigned rrset of the owner, which is insecure only if the owner is under
+// a delegation proven to have no DS records. The unsigned rrset in a secure zone is bogus, as the
+// signatures may be stripped on path
+func (v *dnssecValidator) verifyUnsigned(ctx context.Context, owner string, depth int) error {
+	zone, err := v.secureZone(ctx, owner, depth)
+	if err != nil {
+		return err
+	}
+	return NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeRRSIGsMissing,
+		"rrsig missing for %s in the secure zone %s", owner, zone)
+}
+
+// secureZone walks the zone cuts from the closest trust anchor down to the name, returns the secure
+// zone of the name, or errInsecure if the name is under an insecure delegation or out of the anchors
+func (v *dnssecValidator) secureZone(ctx context.Context, name string, depth int) (string, error) {
+	name = strings.ToLower(dns.Fqdn(name))
+	anchor, found := "", false
+	for zone := range v.anchors {
+		if dns.IsSubDomain(zone, name) && (!found || dns.CountLabel(zone) > dns.CountLabel(anchor)) {
+			anchor, found = zone, true
+		}
+	}
+	if !found {
+		return "", errInsecure
+	}
+	zone := anchor
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - dns.CountLabel(anchor) - 1; i >= 0; i-- {
+		child := dns.Fqdn(strings.Join(labels[i:], "."))
+		cut, err := v.zoneCut(ctx, zone, child, depth)
+		if err != nil {
+			return "", err
+		}
+		switch cut {
+		case cutSecure:
+			zone = child
+		case cutInsecure:
+			return "", errInsecure
+		}
+	}
+	return zone, nil
+}
+
+// zoneCut finds whether the name is a secure, an insecure or no delegation of the secure zone,
+// by the DS records of the name or the authenticated denial of them
+func (v *dnssecValidator) zoneCut(ctx context.Context, zone string, name string, depth int) (zoneCut, error) {
+	v.lock.RLock()
+	cached, ok := v.cuts[name]
+	v.lock.RUnlock()
+	if ok && time.Now().Before(cached.expireAt) {
+		return cached.cut, nil
+	}
+
+	resp, err := v.query(ctx, name, dns.TypeDS)
+	if err != nil {
+		return cutNone, err
+	}
+	ttl := uint32(maxKeyCacheTtl / time.Second)
+	var cut zoneCut
+	dsSet, dsSigs := splitRRSets(resp.Answer)
+	key := rrsetKey(name, dns.TypeDS, dns.ClassINET)
+	if records := dsSet[key]; len(records) > 0 && resp.Rcode == dns.RcodeSuccess {
+		if err := v.verifyRRSet(ctx, records, dsSigs[key], depth+1); err != nil {
+			return cutNone, err
+		}
+		cut = cutSecure
+		ttl = minTtl(ttl, records)
+	} else {
+		var denial []dns.RR
+		if cut, denial, err = v.denyDS(ctx, zone, name, resp.Ns, depth); err != nil {
+			return cutNone, err
+		}
+		ttl = minTtl(ttl, denial)
+	}
+
+	v.lock.Lock()
+	v.cuts[name] = &cachedCut{cut: cut, expireAt: time.Now().Add(time.Duration(ttl) * time.Second)}
+	v.lock.Unlock()
+	return cut, nil
+}
+
+// denyDS checks the NSEC or NSEC3 records signed by the zone, which prove the name has no DS records.
+// The name with the NS but not the SOA type is an insecure delegation, the other names and the empty
+// non-terminals stay in the zone. It returns the records of the proof as well
+func (v *dnssecValidator) denyDS(ctx context.Context, zone string, name string, authority []dns.RR, depth int) (zoneCut, []dns.RR,
+	error) {
+	rrsets, sigs := splitRRSets(authority)
+	for key, rrset := range rrsets {
+		rrtype := rrset[0].Header().Rrtype
+		if rrtype != dns.TypeNSEC && rrtype != dns.TypeNSEC3 {
+			continue
+		}
+		var zoneSigs []*dns.RRSIG
+		for _, sig := range sigs[key] {
+			if strings.EqualFold(sig.SignerName, zone) {
+				zoneSigs = append(zoneSigs, sig)
+			}
+		}
+		if len(zoneSigs) == 0 {
+			continue
+		}
+		for _, rr := range rrset {
+			cut, matched, err := deniedCut(name, rr)
+			if !matched {
+				continue
+			}
+			if err == nil {
+				err = v.verifyRRSet(ctx, rrset, zoneSigs, depth+1)
+			}
+			if err != nil {
+				return cutNone, nil, err
+			}
+			return cut, rrset, nil
+		}
+	}
+	return cutNone, nil, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNSECMissing,
+		"no ds record or denial of it for %s in the secure zone %s", name, zone)
+}
+
+// deniedCut returns the zone cut of the name proven by the NSEC or NSEC3 record, matched is false
+// if the record proves nothing about the name
+func deniedCut(name string, rr dns.RR) (zoneCut, bool, error) {
+	var types []uint16
+	switch record := rr.(type) {
+	case *dns.NSEC:
+		if !strings.EqualFold(record.Hdr.Name, name) {
+			if !nsecCovers(record, name) {
+				return cutNone, false, nil
+			}
+			// the empty non-terminal is covered by the record followed by its descendant
+			if dns.IsSubDomain(name, strings.ToLower(record.NextDomain)) {
+				return cutNone, true, nil
+			}
+			return cutNone, true, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSBogus,
+				"%s is proven to not exist", name)
+		}
+		types = record.TypeBitMap
+	case *dns.NSEC3:
+		if !record.Match(name) {
+			// the unsigned delegations are skipped by the opt-out records, RFC 5155 section 6
+			if record.Flags&1 == 1 && record.Cover(name) {
+				return cutInsecure, true, nil
+			}
+			return cutNone, false, nil
+		}
+		types = record.TypeBitMap
+	default:
+		return cutNone, false, nil
+	}
+	if hasType(types, dns.TypeDS) {
+		return cutNone, true, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeDNSBogus,
+			"ds records of %s are missing", name)
+	}
+	if hasType(types, dns.TypeNS) && !hasType(types, dns.TypeSOA) {
+		return cutInsecure, true, nil
+	}
+	return cutNone, true, nil
+}
+
+func hasType(types []uint16, rrtype uint16) bool {
+	for _, t := range types {
+		if t == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+// nsecCovers checks whether the name is between the owner and the next name of the NSEC record
+// in the canonical order, RFC 4034 section 6.1
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner, next := nsec.Hdr.Name, nsec.NextDomain
+	if canonicalCompare(owner, next) < 0 {
+		return canonicalCompare(owner, name) < 0 && canonicalCompare(name, next) < 0
+	}
+	// the last record of the zone is followed by the apex
+	return canonicalCompare(owner, name) < 0 || canonicalCompare(name, next) < 0
+}
+
+func canonicalCompare(a string, b string) int {
+	al := dns.SplitDomainName(strings.ToLower(a))
+	bl := dns.SplitDomainName(strings.ToLower(b))
+	for i, j := len(al)-1, len(bl)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(al[i], bl[j]); c != 0 {
+			return c
+		}
+	}
+	return len(al) - len(bl)
+}
+
+func minTtl(ttl uint32, records []dns.RR) uint32 {
+	for _, rr := range records {
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl
+}
+
+func (v *dnssecValidator) query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	req.SetEdns0(dns.DefaultMsgSize, true)
+	req.CheckingDisabled = true
+	resp, err := v.exchange(ctx, req)
+	if err != nil {
+		return nil, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNetworkError,
+			"fail to query %s %s", name, dns.TypeToString[qtype]).Wrap(err)
+	}
+	return resp, nil
+}
+
+// flush removes the cached zone keys and zone cuts, returns the count of the removed entries
+func (v *dnssecValidator) flush() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	count := len(v.keys) + len(v.cuts)
+	v.keys = make(map[string]*zoneKeys)
+	v.cuts = make(map[string]*cachedCut)
+	return count
+}
+
+// isDNSSECRecord checks whether the record is only answered to the DNSSEC aware clients
+func isDNSSECRecord(rr dns.RR) bool {
+	switch rr.Header().Rrtype {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+		return true
+	}
+	return false
+}
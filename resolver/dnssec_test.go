@@ -0,0 +1,173 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+type testZone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestZone(t *testing.T, name string) *testZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	assert.NoError(t, err)
+	return &testZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+func (z *testZone) sign(t *testing.T, rrset []dns.RR) *dns.RRSIG {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		Algorithm:  z.key.Algorithm,
+		SignerName: z.name,
+		KeyTag:     z.key.KeyTag(),
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	assert.NoError(t, sig.Sign(z.priv, rrset))
+	return sig
+}
+
+func Test_dnssecValidator_validate(t *testing.T) {
+	root := newTestZone(t, ".")
+	example := newTestZone(t, "example.")
+	exampleDS := example.key.ToDS(dns.SHA256)
+
+	records := map[string][]dns.RR{
+		".":        {root.key, root.sign(t, []dns.RR{root.key})},
+		"example.": {example.key, example.sign(t, []dns.RR{example.key})},
+	}
+	nsec := func(name string, next string, types ...uint16) []dns.RR {
+		record := &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+			NextDomain: next,
+			TypeBitMap: types,
+		}
+		return []dns.RR{record, example.sign(t, []dns.RR{record})}
+	}
+	// the DS records or the denial of them by name
+	dsAnswers := map[string][]dns.RR{
+		"example.": {exampleDS, root.sign(t, []dns.RR{exampleDS})},
+	}
+	dsDenials := map[string][]dns.RR{
+		// www.example. is a name in the signed zone
+		"www.example.": nsec("www.example.", "zzz.example.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC),
+		// cdn.example. is an unsigned delegation
+		"cdn.example.": nsec("cdn.example.", "www.example.", dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC),
+	}
+	exchange := func(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		switch q.Qtype {
+		case dns.TypeDNSKEY:
+			resp.Answer = records[q.Name]
+		case dns.TypeDS:
+			resp.Answer = dsAnswers[q.Name]
+			resp.Ns = dsDenials[q.Name]
+		}
+		return resp, nil
+	}
+	validator, err := newDNSSECValidator(&DNSSECConfig{
+		Enable:       true,
+		TrustAnchors: []string{root.key.ToDS(dns.SHA256).String()},
+	}, exchange)
+	assert.NoError(t, err)
+
+	a := &dns.A{
+		Hdr: dns.RR_Header{Name: "www.example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("10.0.0.1"),
+	}
+	resp := new(dns.Msg)
+	resp.Answer = []dns.RR{a, example.sign(t, []dns.RR{a})}
+	secure, err := validator.validate(context.Background(), resp)
+	assert.NoError(t, err)
+	assert.True(t, secure)
+
+	// unsigned answers in the signed zone are bogus, the signatures may be stripped
+	var extendedErr *ExtendedError
+	resp.Answer = []dns.RR{a}
+	_, err = validator.validate(context.Background(), resp)
+	assert.True(t, errors.As(err, &extendedErr))
+	assert.Equal(t, dns.ExtendedErrorCodeRRSIGsMissing, extendedErr.Code)
+
+	// unsigned answers under the unsigned delegation are insecure
+	cdnA := &dns.A{
+		Hdr: dns.RR_Header{Name: "www.cdn.example.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("10.0.0.3"),
+	}
+	resp.Answer = []dns.RR{cdnA}
+	secure, err = validator.validate(context.Background(), resp)
+	assert.NoError(t, err)
+	assert.False(t, secure)
+
+	// the signed cname to the unsigned delegation is insecure rather than bogus
+	cname := &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: "www.example.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+		Target: "www.cdn.example.",
+	}
+	resp.Answer = []dns.RR{cname, example.sign(t, []dns.RR{cname}), cdnA}
+	secure, err = validator.validate(context.Background(), resp)
+	assert.NoError(t, err)
+	assert.False(t, secure)
+
+	// forged answers are bogus
+	forged := dns.Copy(a).(*dns.A)
+	forged.A = net.ParseIP("10.0.0.2")
+	resp.Answer = []dns.RR{forged, example.sign(t, []dns.RR{a})}
+	_, err = validator.validate(context.Background(), resp)
+	assert.True(t, errors.As(err, &extendedErr))
+	assert.Equal(t, dns.ExtendedErrorCodeDNSBogus, extendedErr.Code)
+
+	// keys which are not in the chain of trust are bogus
+	other := newTestZone(t, "example.")
+	resp.Answer = []dns.RR{a, other.sign(t, []dns.RR{a})}
+	_, err = validator.validate(context.Background(), resp)
+	assert.Error(t, err)
+
+	// the DS records stripped without the denial of them are bogus
+	delete(dsAnswers, "example.")
+	validator.flush()
+	resp.Answer = []dns.RR{a}
+	_, err = validator.validate(context.Background(), resp)
+	assert.True(t, errors.As(err, &extendedErr))
+	assert.Equal(t, dns.ExtendedErrorCodeNSECMissing, extendedErr.Code)
+	resp.Answer = []dns.RR{a, other.sign(t, []dns.RR{a})}
+	_, err = validator.validate(context.Background(), resp)
+	assert.Error(t, err)
+
+	_, err = newDNSSECValidator(&DNSSECConfig{Enable: true, TrustAnchors: []string{"example. IN A 10.0.0.1"}}, exchange)
+	assert.Error(t, err)
+}
@@ -0,0 +1,117 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// ExtendedError is the error answered with a RFC 8914 extended dns error,
+// which explains the client why the query failed
+type ExtendedError struct {
+	// Rcode the response code answered to the client
+	Rcode int
+	// Code the extended dns error info code
+	Code uint16
+	// Text the extended dns error extra text
+	Text string
+	// Err the cause of the error
+	Err error
+}
+
+// NewExtendedError creates the extended error answered with the rcode
+func NewExtendedError(rcode int, code uint16, format string, args ...interface{}) *ExtendedError {
+	return &ExtendedError{Rcode: rcode, Code: code, Text: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the error message
+func (e *ExtendedError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Text, e.Err)
+	}
+	return e.Text
+}
+
+// Unwrap returns the cause of the error
+func (e *ExtendedError) Unwrap() error {
+	return e.Err
+}
+
+// Wrap sets the cause of the error
+func (e *ExtendedError) Wrap(err error) *ExtendedError {
+	e.Err = err
+	return e
+}
+
+// option returns the EDNS0 option of the error
+func (e *ExtendedError) option() *dns.EDNS0_EDE {
+	return &dns.EDNS0_EDE{InfoCode: e.Code, ExtraText: e.Text}
+}
+
+// toExtendedError returns the extended error of err, the errors which are not ExtendedError
+// are answered with the rcode and the info code Other
+func toExtendedError(err error, rcode int) *ExtendedError {
+	var extendedErr *ExtendedError
+	if errors.As(err, &extendedErr) {
+		return extendedErr
+	}
+	return &ExtendedError{Rcode: rcode, Code: dns.ExtendedErrorCodeOther, Text: err.Error(), Err: err}
+}
+
+// setExtendedError attaches the extended dns error to the OPT record of the response,
+// the response without OPT record is left untouched, as the client does not support EDNS
+func setExtendedError(response *dns.Msg, extendedErr *ExtendedError) {
+	if extendedErr == nil {
+		return
+	}
+	opt := response.IsEdns0()
+	if opt == nil {
+		return
+	}
+	opt.Option = append(opt.Option, extendedErr.option())
+}
+
+// reasonError is the sentinel error with the reason shown to the client
+type reasonError struct {
+	sentinel error
+	reason   string
+}
+
+// Error returns the reason
+func (e *reasonError) Error() string {
+	return e.reason
+}
+
+// Is reports whether the target is the sentinel error
+func (e *reasonError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// NotMine returns ErrNotMine with the reason why the name is not answered by the resolver,
+// the reason is shown to the client when no other resolver answers the name
+func NotMine(format string, args ...interface{}) error {
+	return &reasonError{sentinel: ErrNotMine, reason: fmt.Sprintf(format, args...)}
+}
+
+// NameNotFound returns ErrNameNotFound with the reason shown to the client
+func NameNotFound(format string, args ...interface{}) error {
+	return &reasonError{sentinel: ErrNameNotFound, reason: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,89 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func newFuzzServer(t testing.TB) *dnsServer {
+	entries := []*ConfigEntry{
+		{Name: "root", Suffix: ".", Enable: true},
+		{Name: "mesh", Zones: []string{"mesh."}, QTypes: []string{"A"}, Enable: true},
+		{Name: "broken", Zones: []string{"broken."}, Enable: true},
+	}
+	routes, err := buildRoutes(entries, []NamingResolver{
+		&testResolver{name: "root", resp: answerErr(ErrNotMine)},
+		&testResolver{name: "mesh", resp: answerA("10.0.0.1")},
+		&testResolver{name: "broken", resp: answerErr(errors.New("broken"))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buildDNSServer("udp", routes, nil, time.Millisecond, nil, false)
+}
+
+func FuzzServeDNS(f *testing.F) {
+	seeds := []*dns.Msg{
+		new(dns.Msg).SetQuestion("foo.mesh.", dns.TypeA),
+		new(dns.Msg).SetQuestion("foo.broken.", dns.TypeAAAA),
+		new(dns.Msg).SetQuestion("foo.", dns.TypeANY),
+		new(dns.Msg).SetQuestion("_http._tcp.foo.mesh.", dns.TypeSRV),
+		new(dns.Msg).SetNotify("foo."),
+		new(dns.Msg).SetEdns0(4096, true),
+	}
+	chaos := new(dns.Msg).SetQuestion("version.bind.", dns.TypeTXT)
+	chaos.Question[0].Qclass = dns.ClassCHAOS
+	seeds = append(seeds, chaos)
+	for _, seed := range seeds {
+		data, err := seed.Pack()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	d := newFuzzServer(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req := new(dns.Msg)
+		if err := req.Unpack(data); err != nil {
+			return
+		}
+		w := &testResponseWriter{}
+		d.ServeDNS(w, req)
+		if req.Response {
+			if w.msg != nil {
+				t.Fatalf("response %v should not be answered", req)
+			}
+			return
+		}
+		if w.msg == nil {
+			t.Fatalf("request %v is not answered", req)
+		}
+		if w.msg.Id != req.Id || !w.msg.Response {
+			t.Fatalf("invalid response %v for request %v", w.msg, req)
+		}
+		if _, err := w.msg.Pack(); err != nil {
+			t.Fatalf("response %v can not be packed, err: %v", w.msg, err)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// the results of the resolvers in the lookup trace
+const (
+	LookupAnswered   = "answered"
+	LookupDegraded   = "degraded"
+	LookupNotMine    = "not_mine"
+	LookupNotFound   = "not_found"
+	LookupError      = "error"
+	LookupRecurse    = "recurse"
+	LookupUnanswered = "unanswered"
+)
+
+// CacheFlusher is implemented by the resolvers caching the answers, returns the count of the flushed entries
+type CacheFlusher interface {
+	FlushCache() int
+}
+
+// ResolverStatus the resolver and the zones it serves
+type ResolverStatus struct {
+	Name      string   `json:"name"`
+	Zones     []string `json:"zones"`
+	QTypes    []string `json:"qtypes,omitempty"`
+	Listeners []string `json:"listeners"`
+}
+
+// LookupStep the resolver consulted by the lookup and its result
+type LookupStep struct {
+	Resolver string `json:"resolver"`
+	Zone     string `json:"zone"`
+	Result   string `json:"result"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// LookupTrace the dry-run resolution of the name, which shows the resolver answering it and why
+type LookupTrace struct {
+	Listener     string        `json:"listener"`
+	Name         string        `json:"name"`
+	Type         string        `json:"type"`
+	Preprocessed string        `json:"preprocessed"`
+	Steps        []*LookupStep `json:"steps"`
+	AnsweredBy   string        `json:"answered_by,omitempty"`
+	Result       string        `json:"result"`
+	Reason       string        `json:"reason,omitempty"`
+	Rcode        string        `json:"rcode,omitempty"`
+	Answer       []string      `json:"answer,omitempty"`
+	Recursors    []string      `json:"recursors,omitempty"`
+}
+
+// listenerHandler the handler serving the listener
+type listenerHandler struct {
+	name    string
+	address string
+	handler *dnsServer
+}
+
+func (l *listenerHandler) String() string {
+	if len(l.name) > 0 {
+		return l.name
+	}
+	return l.address
+}
+
+// lookupResult classifies the response and the error of the resolver
+func lookupResult(resp *dns.Msg, err error) (string, string) {
+	switch {
+	case resp != nil && err != nil:
+		return LookupDegraded, err.Error()
+	case resp == nil && err == nil:
+		return LookupNotMine, ""
+	case errors.Is(err, ErrNotMine):
+		if err == ErrNotMine {
+			return LookupNotMine, ""
+		}
+		return LookupNotMine, err.Error()
+	case errors.Is(err, ErrNameNotFound):
+		if err == ErrNameNotFound {
+			return LookupNotFound, ""
+		}
+		return LookupNotFound, err.Error()
+	case err != nil:
+		return LookupError, err.Error()
+	}
+	return LookupAnswered, ""
+}
+
+// Resolvers returns the resolvers with the zones they serve
+func (svr *Server) Resolvers() []*ResolverStatus {
+	statuses := make(map[string]*ResolverStatus, len(svr.resolvers))
+	ret := make([]*ResolverStatus, 0, len(svr.resolvers))
+	for _, handler := range svr.resolvers {
+		status := &ResolverStatus{Name: handler.Name()}
+		statuses[handler.Name()] = status
+		ret = append(ret, status)
+	}
+	for _, l := range svr.handlers {
+		for _, rt := range l.handler.routes {
+			status := statuses[rt.resolver.Name()]
+			status.Zones = appendUnique(status.Zones, rt.zone)
+			status.Listeners = appendUnique(status.Listeners, l.String())
+			for qtype := range rt.qtypes {
+				status.QTypes = appendUnique(status.QTypes, dns.TypeToString[qtype])
+			}
+		}
+	}
+	for _, status := range ret {
+		sort.Strings(status.QTypes)
+	}
+	return ret
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// Lookup resolves the name by the resolvers of the listener without answering any client,
+// the query is not sent to the recursors. The first listener is used if listener is empty
+func (svr *Server) Lookup(ctx context.Context, listener string, name string, qtype string) (*LookupTrace, error) {
+	var target *listenerHandler
+	for _, l := range svr.handlers {
+		if len(listener) == 0 || l.name == listener || l.address == listener {
+			target = l
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("listener %s not found", listener)
+	}
+	if len(qtype) == 0 {
+		qtype = dns.TypeToString[dns.TypeA]
+	}
+	qtypeValue, ok := dns.StringToType[strings.ToUpper(qtype)]
+	if !ok {
+		return nil, fmt.Errorf("unknown query type %s", qtype)
+	}
+	if _, ok := dns.IsDomainName(name); !ok || len(name) == 0 {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	question := dns.Question{Name: dns.Fqdn(name), Qtype: qtypeValue, Qclass: dns.ClassINET}
+	d := target.handler
+	trace := &LookupTrace{
+		Listener:     target.String(),
+		Name:         question.Name,
+		Type:         dns.TypeToString[qtypeValue],
+		Preprocessed: d.Preprocess(question.Name),
+		Steps:        []*LookupStep{},
+	}
+	ctx, cancel := d.queryContext(context.WithValue(ctx, ContextProtocol, d.protocol))
+	defer cancel()
+	rt, resp, err := d.resolve(ctx, question, trace.Preprocessed, func(rt *route, resp *dns.Msg, err error) {
+		result, reason := lookupResult(resp, err)
+		trace.Steps = append(trace.Steps, &LookupStep{
+			Resolver: rt.resolver.Name(),
+			Zone:     rt.zone,
+			Result:   result,
+			Reason:   reason,
+		})
+	})
+	if rt == nil {
+		if err != nil {
+			trace.Reason = err.Error()
+		}
+		if d.recurseEnable {
+			trace.Result = LookupRecurse
+			trace.Recursors = d.upstream.load().recursors
+		} else {
+			trace.Result = LookupUnanswered
+			trace.Rcode = dns.RcodeToString[dns.RcodeServerFailure]
+		}
+		return trace, nil
+	}
+	trace.AnsweredBy = rt.resolver.Name()
+	trace.Result, trace.Reason = lookupResult(resp, err)
+	switch trace.Result {
+	case LookupNotFound:
+		trace.Rcode = dns.RcodeToString[dns.RcodeNameError]
+	case LookupError:
+		trace.Rcode = dns.RcodeToString[toExtendedError(err, dns.RcodeServerFailure).Rcode]
+	default:
+		trace.Rcode = dns.RcodeToString[resp.Rcode]
+		for _, rr := range resp.Answer {
+			if rr != nil {
+				trace.Answer = append(trace.Answer, rr.String())
+			}
+		}
+	}
+	return trace, nil
+}
+
+// FlushCache flushes the answers cached by the resolvers and the dnssec keys,
+// returns the count of the flushed entries of each cache
+func (svr *Server) FlushCache() map[string]int {
+	ret := make(map[string]int)
+	for _, handler := range svr.resolvers {
+		if flusher, ok := handler.(CacheFlusher); ok {
+			ret[handler.Name()] = flusher.FlushCache()
+		}
+	}
+	if svr.validator != nil {
+		ret["dnssec"] = svr.validator.flush()
+	}
+	return ret
+}
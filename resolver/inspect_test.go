@@ -0,0 +1,68 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Server_Lookup(t *testing.T) {
+	mesh := &testResolver{name: "mesh", resp: answerErr(NotMine("host %s not found in mesh", "foo.mesh."))}
+	root := &testResolver{name: "root", resp: answerA("10.0.0.1")}
+	entries := []*ConfigEntry{
+		{Name: "mesh", Zones: []string{"mesh"}, Enable: true},
+		{Name: "root", Zones: []string{"svc.local"}, QTypes: []string{"A"}, Enable: true},
+	}
+	routes, err := buildRoutes(entries, []NamingResolver{mesh, root})
+	assert.NoError(t, err)
+	d := buildDNSServer("udp", routes, nil, time.Second, []string{"10.0.0.53:53"}, true)
+	svr := &Server{
+		resolvers: []NamingResolver{mesh, root},
+		handlers:  []*listenerHandler{{name: "default", address: "127.0.0.1:53", handler: d}},
+	}
+
+	trace, err := svr.Lookup(context.Background(), "", "foo.svc.local", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, LookupAnswered, trace.Result)
+	assert.Equal(t, "root", trace.AnsweredBy)
+	assert.Equal(t, "NOERROR", trace.Rcode)
+	assert.Len(t, trace.Answer, 1)
+
+	trace, err = svr.Lookup(context.Background(), "default", "foo.mesh", "")
+	assert.NoError(t, err)
+	assert.Equal(t, LookupRecurse, trace.Result)
+	assert.Equal(t, "host foo.mesh. not found in mesh", trace.Reason)
+	assert.Equal(t, []string{"10.0.0.53:53"}, trace.Recursors)
+	assert.Equal(t, []*LookupStep{{Resolver: "mesh", Zone: "mesh.", Result: LookupNotMine,
+		Reason: "host foo.mesh. not found in mesh"}}, trace.Steps)
+
+	_, err = svr.Lookup(context.Background(), "other", "foo.mesh", "")
+	assert.Error(t, err)
+	_, err = svr.Lookup(context.Background(), "", "foo.mesh", "nope")
+	assert.Error(t, err)
+
+	statuses := svr.Resolvers()
+	assert.Equal(t, "mesh", statuses[0].Name)
+	assert.Equal(t, []string{"mesh."}, statuses[0].Zones)
+	assert.Equal(t, []string{"A"}, statuses[1].QTypes)
+	assert.Equal(t, []string{"default"}, statuses[1].Listeners)
+}
@@ -0,0 +1,70 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+const (
+	defaultClusterDomain     = "cluster.local"
+	defaultResyncIntervalSec = 300
+)
+
+type resolverConfig struct {
+	// KubeConfig path of the kubeconfig file, use the in-cluster config when empty
+	KubeConfig string `json:"kubeconfig"`
+	// ClusterDomain the kubernetes cluster domain, services are answered under svc.<ClusterDomain>
+	ClusterDomain string `json:"cluster_domain"`
+	// ResyncIntervalSec informer resync interval
+	ResyncIntervalSec int `json:"resync_interval_sec"`
+}
+
+// NewOptions returns the options with the default values
+func (r *resolverKubernetes) NewOptions() resolver.Options {
+	return &resolverConfig{
+		ClusterDomain:     defaultClusterDomain,
+		ResyncIntervalSec: defaultResyncIntervalSec,
+	}
+}
+
+// Verify checks the options and normalizes the cluster domain
+func (c *resolverConfig) Verify() error {
+	c.ClusterDomain = strings.Trim(strings.ToLower(c.ClusterDomain), ".")
+	if len(c.ClusterDomain) == 0 {
+		c.ClusterDomain = defaultClusterDomain
+	}
+	if c.ResyncIntervalSec < 0 {
+		return fmt.Errorf("%s resync_interval_sec should greater or equals to 0", name)
+	}
+	return nil
+}
+
+// ValidateOptions checks the files referenced by the options, the kubeconfig file should be readable
+func (r *resolverKubernetes) ValidateOptions(options resolver.Options) error {
+	config := options.(*resolverConfig)
+	if len(config.KubeConfig) > 0 {
+		if err := resolver.VerifyReadableFile(config.KubeConfig); nil != err {
+			return fmt.Errorf("%s kubeconfig is not readable: %v", name, err)
+		}
+	}
+	return nil
+}
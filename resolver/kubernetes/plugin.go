@@ -0,0 +1,413 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	debughttp "github.com/polarismesh/polaris-sidecar/pkg/http"
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+func init() {
+	resolver.Register(&resolverKubernetes{})
+}
+
+const name = resolver.PluginNameKubernetes
+
+type resolverKubernetes struct {
+	config   *resolverConfig
+	dnsTtl   uint32
+	zone     string
+	factory  informers.SharedInformerFactory
+	services corelisters.ServiceLister
+	slices   discoverylisters.EndpointSliceLister
+	synced   []cache.InformerSynced
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	stats    *stats
+}
+
+// Name will return the name to resolver
+func (r *resolverKubernetes) Name() string {
+	return name
+}
+
+// Initialize will init the resolver on startup
+func (r *resolverKubernetes) Initialize(c *resolver.ConfigEntry) error {
+	options, err := resolver.ParseOptions(r, c.Option)
+	if nil != err {
+		return err
+	}
+	r.config = options.(*resolverConfig)
+	restConfig, err := buildRestConfig(r.config.KubeConfig)
+	if nil != err {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if nil != err {
+		return err
+	}
+	r.setup(client, c.DnsTtl)
+	return nil
+}
+
+func buildRestConfig(kubeConfig string) (*rest.Config, error) {
+	if len(kubeConfig) > 0 {
+		return clientcmd.BuildConfigFromFlags("", kubeConfig)
+	}
+	return rest.InClusterConfig()
+}
+
+func (r *resolverKubernetes) setup(client kubernetes.Interface, dnsTtl int) {
+	r.dnsTtl = uint32(dnsTtl)
+	r.zone = "svc." + r.config.ClusterDomain + resolver.Quota
+	r.factory = informers.NewSharedInformerFactory(client, time.Duration(r.config.ResyncIntervalSec)*time.Second)
+	svcInformer := r.factory.Core().V1().Services()
+	sliceInformer := r.factory.Discovery().V1().EndpointSlices()
+	r.services = svcInformer.Lister()
+	r.slices = sliceInformer.Lister()
+	r.synced = []cache.InformerSynced{svcInformer.Informer().HasSynced, sliceInformer.Informer().HasSynced}
+	r.stats = newStats(r.hasSynced)
+	_, _ = svcInformer.Informer().AddEventHandler(r.stats.eventHandler("service"))
+	_, _ = sliceInformer.Informer().AddEventHandler(r.stats.eventHandler("endpointslice"))
+	r.stopCh = make(chan struct{})
+}
+
+// Start the plugin runnable
+func (r *resolverKubernetes) Start(ctx context.Context) {
+	r.factory.Start(r.stopCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.Destroy()
+		case <-r.stopCh:
+		}
+	}()
+	go func() {
+		if cache.WaitForCacheSync(r.stopCh, r.synced...) {
+			log.Infof("[kubernetes] finished to sync services and endpointslices")
+		}
+	}()
+}
+
+// Destroy will destroy the resolver on shutdown
+func (r *resolverKubernetes) Destroy() {
+	if r.stopCh == nil {
+		return
+	}
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+		r.factory.Shutdown()
+	})
+}
+
+func (r *resolverKubernetes) Debugger() []debughttp.DebugHandler {
+	return []debughttp.DebugHandler{
+		{
+			Path:    "/debug/kubernetes/services",
+			Handler: r.debugServices,
+		},
+	}
+}
+
+func (r *resolverKubernetes) debugServices(resp http.ResponseWriter, _ *http.Request) {
+	services, err := r.services.List(labels.Everything())
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		_, _ = resp.Write([]byte(err.Error()))
+		return
+	}
+	ret := make(map[string][]string, len(services))
+	for _, svc := range services {
+		var addresses []string
+		for _, ip := range r.serviceIPs(svc) {
+			addresses = append(addresses, ip.String())
+		}
+		ret[svc.Name+"."+svc.Namespace+"."+r.zone] = addresses
+	}
+	data, _ := json.Marshal(ret)
+	resp.Header().Set("Content-Type", "application/json")
+	_, _ = resp.Write(data)
+}
+
+func (r *resolverKubernetes) hasSynced() bool {
+	for _, synced := range r.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return len(r.synced) > 0
+}
+
+// ServeDNS answers <service>.<namespace>.svc.<cluster_domain> names, the named port form
+// _<port>._<proto>.<service>.<namespace>.svc.<cluster_domain> and the endpoint hostname form
+// <hostname>.<service>.<namespace>.svc.<cluster_domain> of headless services.
+// Names outside the cluster domain return resolver.ErrNotMine, unknown names inside it
+// return resolver.ErrNameNotFound.
+func (r *resolverKubernetes) ServeDNS(ctx context.Context, question dns.Question, qname string) (*dns.Msg, error) {
+	if !r.hasSynced() {
+		r.stats.lookups.WithLabelValues(lookupNotSynced).Inc()
+		return nil, resolver.NotMine("kubernetes cache is not synced")
+	}
+	nameLabels, ok := r.splitName(question.Name)
+	if !ok {
+		r.stats.lookups.WithLabelValues(lookupNotMine).Inc()
+		return nil, resolver.ErrNotMine
+	}
+	answers, found := r.lookup(question, nameLabels)
+	if !found {
+		r.stats.lookups.WithLabelValues(lookupNotFound).Inc()
+		return nil, resolver.NameNotFound("%s not found in kubernetes cluster %s", question.Name, r.config.ClusterDomain)
+	}
+	r.stats.lookups.WithLabelValues(lookupAnswered).Inc()
+	msg := &dns.Msg{}
+	msg.Authoritative = true
+	msg.Answer = answers
+	msg.Rcode = dns.RcodeSuccess
+	return msg, nil
+}
+
+func (r *resolverKubernetes) splitName(fqdn string) ([]string, bool) {
+	fqdn = strings.ToLower(dns.Fqdn(fqdn))
+	if fqdn == r.zone {
+		return nil, true
+	}
+	if !strings.HasSuffix(fqdn, resolver.Quota+r.zone) {
+		return nil, false
+	}
+	return dns.SplitDomainName(strings.TrimSuffix(fqdn, resolver.Quota+r.zone)), true
+}
+
+func (r *resolverKubernetes) lookup(question dns.Question, nameLabels []string) ([]dns.RR, bool) {
+	switch len(nameLabels) {
+	case 0, 1:
+		// the zone itself or a namespace, exists but owns no records
+		return nil, true
+	case 2:
+		svc, err := r.services.Services(nameLabels[1]).Get(nameLabels[0])
+		if err != nil {
+			return nil, false
+		}
+		return r.serviceRecords(question, svc), true
+	case 3:
+		svc, err := r.services.Services(nameLabels[2]).Get(nameLabels[1])
+		if err != nil || !isHeadless(svc) {
+			return nil, false
+		}
+		for _, ep := range r.readyEndpoints(svc) {
+			if ep.name() == nameLabels[0] {
+				return r.addressRecords(question, []net.IP{ep.ip}), true
+			}
+		}
+		return nil, false
+	case 4:
+		if !strings.HasPrefix(nameLabels[0], "_") || !strings.HasPrefix(nameLabels[1], "_") {
+			return nil, false
+		}
+		svc, err := r.services.Services(nameLabels[3]).Get(nameLabels[2])
+		if err != nil {
+			return nil, false
+		}
+		portName, protocol := nameLabels[0][1:], nameLabels[1][1:]
+		for _, port := range svc.Spec.Ports {
+			if strings.ToLower(port.Name) == portName && strings.ToLower(string(port.Protocol)) == protocol {
+				if question.Qtype != dns.TypeSRV {
+					return nil, true
+				}
+				return r.srvRecords(question, svc, port), true
+			}
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+func (r *resolverKubernetes) serviceRecords(question dns.Question, svc *corev1.Service) []dns.RR {
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		return []dns.RR{&dns.CNAME{
+			Hdr:    r.header(question.Name, dns.TypeCNAME),
+			Target: dns.Fqdn(svc.Spec.ExternalName),
+		}}
+	}
+	switch question.Qtype {
+	case dns.TypeA, dns.TypeAAAA:
+		return r.addressRecords(question, r.serviceIPs(svc))
+	case dns.TypeSRV:
+		return r.srvRecords(question, svc, svc.Spec.Ports...)
+	}
+	return nil
+}
+
+func (r *resolverKubernetes) serviceIPs(svc *corev1.Service) []net.IP {
+	var ips []net.IP
+	if isHeadless(svc) {
+		for _, ep := range r.readyEndpoints(svc) {
+			ips = append(ips, ep.ip)
+		}
+		return ips
+	}
+	clusterIPs := svc.Spec.ClusterIPs
+	if len(clusterIPs) == 0 && len(svc.Spec.ClusterIP) > 0 {
+		clusterIPs = []string{svc.Spec.ClusterIP}
+	}
+	for _, clusterIP := range clusterIPs {
+		if ip := net.ParseIP(clusterIP); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func (r *resolverKubernetes) srvRecords(question dns.Question, svc *corev1.Service, ports ...corev1.ServicePort) []dns.RR {
+	svcName := svc.Name + resolver.Quota + svc.Namespace + resolver.Quota + r.zone
+	var answers []dns.RR
+	for _, port := range ports {
+		if !isHeadless(svc) {
+			answers = append(answers, r.srv(question.Name, svcName, uint16(port.Port)))
+			continue
+		}
+		for _, ep := range r.readyEndpoints(svc) {
+			epPort, ok := ep.ports[port.Name]
+			if !ok {
+				continue
+			}
+			answers = append(answers, r.srv(question.Name, ep.name()+resolver.Quota+svcName, uint16(epPort)))
+		}
+	}
+	// equal weights sharing 100, at least 1 so that large services are still picked
+	weight := uint16(100 / len(answers))
+	if weight == 0 {
+		weight = 1
+	}
+	for _, rr := range answers {
+		rr.(*dns.SRV).Weight = weight
+	}
+	return answers
+}
+
+func (r *resolverKubernetes) srv(qname string, target string, port uint16) dns.RR {
+	return &dns.SRV{
+		Hdr:    r.header(qname, dns.TypeSRV),
+		Port:   port,
+		Target: target,
+	}
+}
+
+func (r *resolverKubernetes) addressRecords(question dns.Question, ips []net.IP) []dns.RR {
+	var answers []dns.RR
+	for _, ip := range ips {
+		isV4 := ip.To4() != nil
+		switch {
+		case question.Qtype == dns.TypeA && isV4:
+			answers = append(answers, &dns.A{Hdr: r.header(question.Name, dns.TypeA), A: ip})
+		case question.Qtype == dns.TypeAAAA && !isV4:
+			answers = append(answers, &dns.AAAA{Hdr: r.header(question.Name, dns.TypeAAAA), AAAA: ip})
+		}
+	}
+	return answers
+}
+
+func (r *resolverKubernetes) header(qname string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: qname, Rrtype: rrtype, Class: dns.ClassINET, Ttl: r.dnsTtl}
+}
+
+type endpoint struct {
+	hostname string
+	ip       net.IP
+	ports    map[string]int32
+}
+
+// name returns the dns label of the endpoint, the hostname if set or the dashed address
+func (e endpoint) name() string {
+	if len(e.hostname) > 0 {
+		return strings.ToLower(e.hostname)
+	}
+	return strings.NewReplacer(".", "-", ":", "-").Replace(e.ip.String())
+}
+
+func (r *resolverKubernetes) readyEndpoints(svc *corev1.Service) []endpoint {
+	slices, err := r.slices.EndpointSlices(svc.Namespace).List(
+		labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: svc.Name}))
+	if err != nil {
+		log.Errorf("[kubernetes] fail to list endpointslices for %s/%s, err: %v", svc.Namespace, svc.Name, err)
+		return nil
+	}
+	var endpoints []endpoint
+	seen := map[string]struct{}{}
+	for _, slice := range slices {
+		if slice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+		ports := make(map[string]int32, len(slice.Ports))
+		for _, port := range slice.Ports {
+			if port.Port == nil {
+				continue
+			}
+			var portName string
+			if port.Name != nil {
+				portName = *port.Name
+			}
+			ports[portName] = *port.Port
+		}
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, address := range ep.Addresses {
+				ip := net.ParseIP(address)
+				if ip == nil {
+					continue
+				}
+				if _, ok := seen[ip.String()]; ok {
+					continue
+				}
+				seen[ip.String()] = struct{}{}
+				var hostname string
+				if ep.Hostname != nil {
+					hostname = *ep.Hostname
+				}
+				endpoints = append(endpoints, endpoint{hostname: hostname, ip: ip, ports: ports})
+			}
+		}
+	}
+	return endpoints
+}
+
+func isHeadless(svc *corev1.Service) bool {
+	return svc.Spec.ClusterIP == corev1.ClusterIPNone
+}
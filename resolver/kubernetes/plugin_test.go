@@ -0,0 +1,219 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+func newTestResolver(t *testing.T, objects ...runtime.Object) *resolverKubernetes {
+	ready, notReady := true, false
+	webHost := "web-0"
+	httpName, httpPort := "http", int32(8080)
+	objects = append(objects,
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"},
+			Spec: corev1.ServiceSpec{
+				ClusterIP:  "10.96.0.10",
+				ClusterIPs: []string{"10.96.0.10", "fd00::10"},
+				Ports:      []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+			Spec: corev1.ServiceSpec{
+				ClusterIP: corev1.ClusterIPNone,
+				Ports:     []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec: corev1.ServiceSpec{
+				Type:         corev1.ServiceTypeExternalName,
+				ExternalName: "db.example.com",
+			},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web-abc",
+				Namespace: "prod",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Ports:       []discoveryv1.EndpointPort{{Name: &httpName, Port: &httpPort}},
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.1.0.1"}, Hostname: &webHost, Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+				{Addresses: []string{"10.1.0.2"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+				{Addresses: []string{"10.1.0.3"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+			},
+		},
+	)
+	client := fake.NewSimpleClientset(objects...)
+	r := &resolverKubernetes{}
+	r.config = r.NewOptions().(*resolverConfig)
+	r.setup(client, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	r.Start(ctx)
+	assert.True(t, cache.WaitForCacheSync(ctx.Done(), r.synced...))
+	return r
+}
+
+func question(qname string, qtype uint16) dns.Question {
+	return dns.Question{Name: qname, Qtype: qtype, Qclass: dns.ClassINET}
+}
+
+func serve(t *testing.T, r *resolverKubernetes, q dns.Question) *dns.Msg {
+	msg, err := r.ServeDNS(context.Background(), q, q.Name)
+	assert.NoError(t, err)
+	assert.NotNil(t, msg)
+	return msg
+}
+
+func Test_resolverKubernetes_ServeDNS(t *testing.T) {
+	r := newTestResolver(t)
+	ctx := context.Background()
+
+	t.Run("cluster-ip", func(t *testing.T) {
+		msg := serve(t, r, question("api.default.svc.cluster.local.", dns.TypeA))
+		assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+		assert.Len(t, msg.Answer, 1)
+		assert.Equal(t, "10.96.0.10", msg.Answer[0].(*dns.A).A.String())
+
+		msg = serve(t, r, question("API.default.svc.cluster.local.", dns.TypeAAAA))
+		assert.Len(t, msg.Answer, 1)
+		assert.Equal(t, "fd00::10", msg.Answer[0].(*dns.AAAA).AAAA.String())
+	})
+
+	t.Run("headless", func(t *testing.T) {
+		msg := serve(t, r, question("web.prod.svc.cluster.local.", dns.TypeA))
+		assert.Len(t, msg.Answer, 2)
+
+		msg = serve(t, r, question("web-0.web.prod.svc.cluster.local.", dns.TypeA))
+		assert.Len(t, msg.Answer, 1)
+		assert.Equal(t, "10.1.0.1", msg.Answer[0].(*dns.A).A.String())
+
+		msg = serve(t, r, question("10-1-0-2.web.prod.svc.cluster.local.", dns.TypeA))
+		assert.Len(t, msg.Answer, 1)
+	})
+
+	t.Run("srv", func(t *testing.T) {
+		msg := serve(t, r, question("_http._tcp.api.default.svc.cluster.local.", dns.TypeSRV))
+		assert.Len(t, msg.Answer, 1)
+		srv := msg.Answer[0].(*dns.SRV)
+		assert.Equal(t, uint16(80), srv.Port)
+		assert.Equal(t, "api.default.svc.cluster.local.", srv.Target)
+
+		msg = serve(t, r, question("web.prod.svc.cluster.local.", dns.TypeSRV))
+		assert.Len(t, msg.Answer, 2)
+		assert.Equal(t, uint16(8080), msg.Answer[0].(*dns.SRV).Port)
+	})
+
+	t.Run("external-name", func(t *testing.T) {
+		msg := serve(t, r, question("db.default.svc.cluster.local.", dns.TypeA))
+		assert.Len(t, msg.Answer, 1)
+		assert.Equal(t, "db.example.com.", msg.Answer[0].(*dns.CNAME).Target)
+	})
+
+	t.Run("not-found", func(t *testing.T) {
+		_, err := r.ServeDNS(ctx, question("missing.default.svc.cluster.local.", dns.TypeA), "missing.")
+		assert.ErrorIs(t, err, resolver.ErrNameNotFound)
+
+		msg := serve(t, r, question("default.svc.cluster.local.", dns.TypeA))
+		assert.Equal(t, dns.RcodeSuccess, msg.Rcode)
+		assert.Empty(t, msg.Answer)
+	})
+
+	t.Run("outside-zone", func(t *testing.T) {
+		_, err := r.ServeDNS(ctx, question("www.example.com.", dns.TypeA), "www.example.com.")
+		assert.ErrorIs(t, err, resolver.ErrNotMine)
+	})
+}
+
+func Test_resolverKubernetes_srvWeight(t *testing.T) {
+	ready := true
+	httpName, httpPort := "http", int32(8080)
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "big-abc",
+			Namespace: "prod",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "big"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Name: &httpName, Port: &httpPort}},
+	}
+	for i := 0; i < 150; i++ {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{fmt.Sprintf("10.2.%d.%d", i/100, i%100+1)},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		})
+	}
+	r := newTestResolver(t, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "big", Namespace: "prod"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Ports:     []corev1.ServicePort{{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP}},
+		},
+	}, slice)
+
+	msg := serve(t, r, question("big.prod.svc.cluster.local.", dns.TypeSRV))
+	assert.Len(t, msg.Answer, 150)
+	for _, rr := range msg.Answer {
+		assert.Equal(t, uint16(1), rr.(*dns.SRV).Weight)
+	}
+
+	msg = serve(t, r, question("web.prod.svc.cluster.local.", dns.TypeSRV))
+	assert.Len(t, msg.Answer, 2)
+	assert.Equal(t, uint16(50), msg.Answer[0].(*dns.SRV).Weight)
+}
+
+func Test_resolverKubernetes_stats(t *testing.T) {
+	r := newTestResolver(t)
+	ctx := context.Background()
+
+	serve(t, r, question("api.default.svc.cluster.local.", dns.TypeA))
+	_, _ = r.ServeDNS(ctx, question("missing.default.svc.cluster.local.", dns.TypeA), "missing.")
+	_, _ = r.ServeDNS(ctx, question("www.example.com.", dns.TypeA), "www.example.com.")
+
+	lookups := r.stats.lookups
+	assert.Equal(t, float64(1), testutil.ToFloat64(lookups.WithLabelValues(lookupAnswered)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(lookups.WithLabelValues(lookupNotFound)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(lookups.WithLabelValues(lookupNotMine)))
+	// the handlers are called asynchronously after the informers are synced
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(r.stats.events.WithLabelValues("service", eventAdd)) == 3 &&
+			testutil.ToFloat64(r.stats.events.WithLabelValues("endpointslice", eventAdd)) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.stats.synced))
+	assert.Len(t, r.Collectors(), 3)
+}
@@ -0,0 +1,87 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/tools/cache"
+)
+
+// the results of the lookups
+const (
+	lookupAnswered  = "answered"
+	lookupNotFound  = "not_found"
+	lookupNotMine   = "not_mine"
+	lookupNotSynced = "not_synced"
+)
+
+// the events of the informers
+const (
+	eventAdd    = "add"
+	eventUpdate = "update"
+	eventDelete = "delete"
+)
+
+// stats the metrics of the kubernetes resolver, the names are not labeled to keep the cardinality bounded
+type stats struct {
+	events  *prometheus.CounterVec
+	lookups *prometheus.CounterVec
+	synced  prometheus.GaugeFunc
+}
+
+func newStats(synced func() bool) *stats {
+	return &stats{
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "polaris_sidecar_kubernetes_sync_events_total",
+			Help: "The events of the services and endpointslices received from the kubernetes api server.",
+		}, []string{"kind", "event"}),
+		lookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "polaris_sidecar_kubernetes_lookups_total",
+			Help: "The lookups of the kubernetes resolver, by result.",
+		}, []string{"result"}),
+		synced: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "polaris_sidecar_kubernetes_synced",
+			Help: "Whether the services and endpointslices are synced from the kubernetes api server.",
+		}, func() float64 {
+			if synced() {
+				return 1
+			}
+			return 0
+		}),
+	}
+}
+
+// eventHandler counts the events of the informer of the kind
+func (s *stats) eventHandler(kind string) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) {
+			s.events.WithLabelValues(kind, eventAdd).Inc()
+		},
+		UpdateFunc: func(interface{}, interface{}) {
+			s.events.WithLabelValues(kind, eventUpdate).Inc()
+		},
+		DeleteFunc: func(interface{}) {
+			s.events.WithLabelValues(kind, eventDelete).Inc()
+		},
+	}
+}
+
+// Collectors returns the metrics of the resolver, which are served by the metric server
+func (r *resolverKubernetes) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{r.stats.events, r.stats.lookups, r.stats.synced}
+}
@@ -0,0 +1,188 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/netutil"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+)
+
+const (
+	defaultUDPWorkers        = 1
+	defaultTCPIdleTimeoutSec = 8
+	defaultMaxUDPSize        = 1232
+)
+
+// ListenConfig tuning of the dns listeners
+type ListenConfig struct {
+	// UDPWorkers the count of the udp sockets bound to the same address with SO_REUSEPORT,
+	// each socket is served by its own goroutines
+	UDPWorkers int `yaml:"udp_workers"`
+	// ReadBufferBytes the socket receive buffer size, 0 means the system default
+	ReadBufferBytes int `yaml:"read_buffer_bytes"`
+	// WriteBufferBytes the socket send buffer size, 0 means the system default
+	WriteBufferBytes int `yaml:"write_buffer_bytes"`
+	// TCPIdleTimeoutSec the idle timeout of the tcp connections between the queries
+	TCPIdleTimeoutSec int `yaml:"tcp_idle_timeout_sec"`
+	// MaxTCPQueries the pipelined queries of a tcp connection before it is closed,
+	// 0 means the default 128, -1 means unlimited
+	MaxTCPQueries int `yaml:"max_tcp_queries"`
+	// MaxUDPSize the udp payload size advertised in EDNS, the udp answers larger than it are truncated
+	MaxUDPSize int `yaml:"max_udp_size"`
+}
+
+// DefaultListenConfig returns the default listen config
+func DefaultListenConfig() *ListenConfig {
+	return &ListenConfig{
+		UDPWorkers:        defaultUDPWorkers,
+		TCPIdleTimeoutSec: defaultTCPIdleTimeoutSec,
+		MaxUDPSize:        defaultMaxUDPSize,
+	}
+}
+
+// Verify checks the listen config
+func (c *ListenConfig) Verify() error {
+	if c.UDPWorkers <= 0 {
+		return fmt.Errorf("listen.udp_workers should greater than 0")
+	}
+	if c.UDPWorkers > 1 && !supportsReusePort {
+		return fmt.Errorf("listen.udp_workers greater than 1 requires SO_REUSEPORT, which is not supported")
+	}
+	if c.ReadBufferBytes < 0 || c.WriteBufferBytes < 0 {
+		return fmt.Errorf("listen buffer bytes should greater or equals to 0")
+	}
+	if c.TCPIdleTimeoutSec <= 0 {
+		return fmt.Errorf("listen.tcp_idle_timeout_sec should greater than 0")
+	}
+	if c.MaxTCPQueries < -1 {
+		return fmt.Errorf("listen.max_tcp_queries should greater or equals to -1")
+	}
+	if c.MaxUDPSize < dns.MinMsgSize || c.MaxUDPSize > dns.MaxMsgSize {
+		return fmt.Errorf("listen.max_udp_size should between %d and %d", dns.MinMsgSize, dns.MaxMsgSize)
+	}
+	return nil
+}
+
+// newDNSServers creates the udp workers and the tcp server of the address,
+// the server of the protocol is not created when its handler is nil
+func newDNSServers(addr string, conf *ListenConfig, udpHandler, tcpHandler dns.Handler) []*dns.Server {
+	idleTimeout := time.Duration(conf.TCPIdleTimeoutSec) * time.Second
+	servers := make([]*dns.Server, 0, conf.UDPWorkers+1)
+	for i := 0; udpHandler != nil && i < conf.UDPWorkers; i++ {
+		servers = append(servers, &dns.Server{
+			Addr:    addr,
+			Net:     protocolUDP,
+			Handler: udpHandler,
+			// read the whole query advertised with the max udp size
+			UDPSize:   conf.MaxUDPSize,
+			ReusePort: conf.UDPWorkers > 1,
+		})
+	}
+	if tcpHandler != nil {
+		servers = append(servers, &dns.Server{
+			Addr:          addr,
+			Net:           protocolTCP,
+			Handler:       tcpHandler,
+			IdleTimeout:   func() time.Duration { return idleTimeout },
+			MaxTCPQueries: conf.MaxTCPQueries,
+		})
+	}
+	return servers
+}
+
+// listenUDP listens the udp socket of the server with the buffer sizes
+func listenUDP(dnsSvr *dns.Server, conf *ListenConfig) (net.PacketConn, error) {
+	lc := net.ListenConfig{}
+	if dnsSvr.ReusePort {
+		lc.Control = reusePortControl
+	}
+	conn, err := lc.ListenPacket(context.Background(), dnsSvr.Net, dnsSvr.Addr)
+	if nil != err {
+		return nil, err
+	}
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return conn, nil
+	}
+	if err := setBuffers(udpConn, conf); nil != err {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// listenTCP listens the tcp socket of the server, the accepted connections are capped by maxConnections
+func listenTCP(dnsSvr *dns.Server, conf *ListenConfig, maxConnections int) (net.Listener, error) {
+	l, err := net.Listen(dnsSvr.Net, dnsSvr.Addr)
+	if nil != err {
+		return nil, err
+	}
+	if conf.ReadBufferBytes > 0 || conf.WriteBufferBytes > 0 {
+		l = &bufferListener{Listener: l, conf: conf}
+	}
+	if maxConnections > 0 {
+		l = netutil.LimitListener(l, maxConnections)
+	}
+	return l, nil
+}
+
+type bufferConn interface {
+	SetReadBuffer(bytes int) error
+	SetWriteBuffer(bytes int) error
+}
+
+func setBuffers(conn bufferConn, conf *ListenConfig) error {
+	if conf.ReadBufferBytes > 0 {
+		if err := conn.SetReadBuffer(conf.ReadBufferBytes); nil != err {
+			return err
+		}
+	}
+	if conf.WriteBufferBytes > 0 {
+		if err := conn.SetWriteBuffer(conf.WriteBufferBytes); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// bufferListener sets the buffer sizes of the accepted tcp connections
+type bufferListener struct {
+	net.Listener
+	conf *ListenConfig
+}
+
+// Accept waits for and returns the next connection to the listener
+func (l *bufferListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := setBuffers(tcpConn, l.conf); nil != err {
+			log.Warnf("[agent] fail to set buffers of tcp connection %s, err: %v", conn.RemoteAddr(), err)
+		}
+	}
+	return conn, nil
+}
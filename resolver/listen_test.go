@@ -0,0 +1,76 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newDNSServers(t *testing.T) {
+	if !supportsReusePort {
+		t.Skip("SO_REUSEPORT not supported")
+	}
+	conf := DefaultListenConfig()
+	conf.UDPWorkers = 2
+	conf.ReadBufferBytes = 1 << 20
+	assert.NoError(t, conf.Verify())
+	handler := buildDNSServer("udp", nil, nil, 0, nil, false)
+	servers := newDNSServers("127.0.0.1:0", conf, handler, handler)
+	assert.Len(t, servers, 3)
+	assert.Len(t, newDNSServers("127.0.0.1:0", conf, nil, handler), 1)
+
+	first, err := listenUDP(servers[0], conf)
+	assert.NoError(t, err)
+	defer first.Close()
+	// the other workers bind the same port
+	servers[1].Addr = first.LocalAddr().String()
+	second, err := listenUDP(servers[1], conf)
+	assert.NoError(t, err)
+	defer second.Close()
+
+	conf.MaxUDPSize = 100
+	assert.Error(t, conf.Verify())
+
+	req := new(dns.Msg)
+	req.SetEdns0(4096, false)
+	assert.Equal(t, defaultMaxUDPSize, size("udp", req, defaultMaxUDPSize))
+	assert.Equal(t, dns.MaxMsgSize, size("tcp", req, defaultMaxUDPSize))
+}
+
+func Test_VerifyListeners(t *testing.T) {
+	entries := []*ConfigEntry{
+		{Name: "dnsagent", Enable: true},
+		{Name: "meshproxy", Enable: true},
+		{Name: "kubernetes", Enable: false},
+	}
+	app := &ListenerConfig{Name: "app", Bind: "127.0.0.1", Port: 53}
+	node := &ListenerConfig{Name: "node", Bind: "169.254.20.10", Port: 53, Resolvers: []string{"meshproxy"}}
+	envoy := &ListenerConfig{Name: "envoy", Bind: "127.0.0.1", Port: 15053, Protocols: []string{"udp"}}
+	assert.NoError(t, VerifyListeners([]*ListenerConfig{app, node, envoy}, entries))
+	assert.Len(t, listenerEntries(app, entries), 3)
+	assert.Equal(t, "meshproxy", listenerEntries(node, entries)[0].Name)
+	assert.False(t, envoy.serves(protocolTCP))
+
+	dup := &ListenerConfig{Name: "dup", Bind: "127.0.0.1", Port: 53, Protocols: []string{"tcp"}}
+	assert.Error(t, VerifyListeners([]*ListenerConfig{app, dup}, entries))
+	disabled := &ListenerConfig{Name: "k8s", Bind: "127.0.0.1", Port: 54, Resolvers: []string{"kubernetes"}}
+	assert.Error(t, VerifyListeners([]*ListenerConfig{disabled}, entries))
+}
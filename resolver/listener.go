@@ -0,0 +1,129 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	protocolUDP = "udp"
+	protocolTCP = "tcp"
+)
+
+// ListenerConfig the dns listener, which serves the queries with a set of the resolvers
+type ListenerConfig struct {
+	// Name the name of the listener, used in the logs
+	Name string `yaml:"name"`
+	// Bind the ip to listen
+	Bind string `yaml:"bind"`
+	// Port the port to listen
+	Port int `yaml:"port"`
+	// Protocols udp and tcp, default to both
+	Protocols []string `yaml:"protocols"`
+	// Resolvers the names of the resolvers serving the listener, default to all the enabled resolvers
+	Resolvers []string `yaml:"resolvers"`
+}
+
+// Address returns the host:port of the listener
+func (l *ListenerConfig) Address() string {
+	return net.JoinHostPort(l.Bind, strconv.Itoa(l.Port))
+}
+
+// serves checks whether the listener serves the protocol
+func (l *ListenerConfig) serves(protocol string) bool {
+	if len(l.Protocols) == 0 {
+		return true
+	}
+	for _, p := range l.Protocols {
+		if strings.ToLower(p) == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// BindLocalhost checks whether the listener is reachable by the loopback address
+func (l *ListenerConfig) BindLocalhost() bool {
+	bindIP := net.ParseIP(l.Bind)
+	return bindIP.IsLoopback() || bindIP.IsUnspecified()
+}
+
+// VerifyListeners checks the listeners against the resolver config entries
+func VerifyListeners(listeners []*ListenerConfig, entries []*ConfigEntry) error {
+	enabled := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		enabled[entry.Name] = entry.Enable
+	}
+	addresses := make(map[string]string)
+	for idx, l := range listeners {
+		name := l.Name
+		if len(name) == 0 {
+			name = strconv.Itoa(idx)
+		}
+		if len(l.Bind) == 0 || net.ParseIP(l.Bind) == nil {
+			return fmt.Errorf("listener %s bind %q should be an ip", name, l.Bind)
+		}
+		if l.Port <= 0 || l.Port > 65535 {
+			return fmt.Errorf("listener %s port should between 1 and 65535", name)
+		}
+		for _, p := range l.Protocols {
+			p = strings.ToLower(p)
+			if p != protocolUDP && p != protocolTCP {
+				return fmt.Errorf("listener %s unknown protocol %s", name, p)
+			}
+		}
+		for _, protocol := range []string{protocolUDP, protocolTCP} {
+			if !l.serves(protocol) {
+				continue
+			}
+			key := protocol + "/" + l.Address()
+			if exist, ok := addresses[key]; ok {
+				return fmt.Errorf("listener %s and %s both listen %s %s", exist, name, protocol, l.Address())
+			}
+			addresses[key] = name
+		}
+		for _, resolverName := range l.Resolvers {
+			if !enabled[resolverName] {
+				return fmt.Errorf("listener %s resolver %s is not enabled", name, resolverName)
+			}
+		}
+	}
+	return nil
+}
+
+// listenerEntries returns the config entries of the resolvers serving the listener
+func listenerEntries(l *ListenerConfig, entries []*ConfigEntry) []*ConfigEntry {
+	if len(l.Resolvers) == 0 {
+		return entries
+	}
+	names := make(map[string]struct{}, len(l.Resolvers))
+	for _, name := range l.Resolvers {
+		names[name] = struct{}{}
+	}
+	ret := make([]*ConfigEntry, 0, len(l.Resolvers))
+	for _, entry := range entries {
+		if _, ok := names[entry.Name]; ok {
+			ret = append(ret, entry)
+		}
+	}
+	return ret
+}
@@ -18,8 +18,10 @@
 package meshproxy
 
 import (
-	"encoding/json"
 	"fmt"
+	"net"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
 )
 
 type resolverConfig struct {
@@ -30,19 +32,51 @@ type resolverConfig struct {
 	DNSAnswerIp        string `json:"dns_answer_ip"`
 	FilterByBusiness   string `json:"filter_by_business"`
 	RecursionAvailable bool   `json:"recursion_available"`
+	// SnapshotPath persists the lookup table to the file, which is loaded at startup
+	SnapshotPath string `json:"snapshot_path"`
+	// SnapshotMaxAgeSec the snapshot older than it is not loaded
+	SnapshotMaxAgeSec int `json:"snapshot_max_age_sec"`
+}
+
+const (
+	defaultSnapshotMaxAgeSec = 86400
+	defaultReloadIntervalSec = 30
+	defaultDNSAnswerIp       = "10.4.4.4"
+)
+
+// NewOptions returns the options with the default values
+func (r *resolverMesh) NewOptions() resolver.Options {
+	return &resolverConfig{
+		ReloadIntervalSec: defaultReloadIntervalSec,
+		DNSAnswerIp:       defaultDNSAnswerIp,
+		SnapshotMaxAgeSec: defaultSnapshotMaxAgeSec,
+	}
 }
 
-func parseOptions(options map[string]interface{}) (*resolverConfig, error) {
-	config := &resolverConfig{}
-	if len(options) == 0 {
-		return config, nil
+// Verify checks the options
+func (c *resolverConfig) Verify() error {
+	if c.ReloadIntervalSec <= 0 {
+		return fmt.Errorf("%s reload_interval_sec should greater than 0", name)
+	}
+	if len(c.DNSAnswerIp) > 0 && net.ParseIP(c.DNSAnswerIp) == nil {
+		return fmt.Errorf("%s dns_answer_ip %s should be an ip", name, c.DNSAnswerIp)
+	}
+	if c.RegistryPort < 0 || c.RegistryPort > 65535 {
+		return fmt.Errorf("%s registry_port should between 0 and 65535", name)
 	}
-	jsonBytes, err := json.Marshal(options)
-	if nil != err {
-		return nil, fmt.Errorf("fail to marshal %s config entry, err is %v", name, err)
+	if c.SnapshotMaxAgeSec <= 0 {
+		return fmt.Errorf("%s snapshot_max_age_sec should greater than 0", name)
 	}
-	if err = json.Unmarshal(jsonBytes, config); nil != err {
-		return nil, fmt.Errorf("fail to unmarshal %s config entry, err is %v", name, err)
+	return nil
+}
+
+// ValidateOptions checks the files referenced by the options, the directory of the snapshot should exist
+func (r *resolverMesh) ValidateOptions(options resolver.Options) error {
+	config := options.(*resolverConfig)
+	if len(config.SnapshotPath) > 0 {
+		if err := resolver.VerifyFileDir(config.SnapshotPath); nil != err {
+			return fmt.Errorf("%s snapshot_path is not writable: %v", name, err)
+		}
 	}
-	return config, nil
+	return nil
 }
@@ -19,6 +19,7 @@ package meshproxy
 
 import (
 	"context"
+	"os"
 	"strings"
 	"time"
 
@@ -40,6 +41,9 @@ type resolverMesh struct {
 	registry       registry
 	suffix         string
 	consumer       polaris.ConsumerAPI
+	snapshotAt     time.Time
+	// snapshotServices the services loaded from the snapshot on initialize
+	snapshotServices map[string]struct{}
 }
 
 // Name will return the name to resolver
@@ -49,11 +53,11 @@ func (r *resolverMesh) Name() string {
 
 // Initialize will init the resolver on startup
 func (r *resolverMesh) Initialize(c *resolver.ConfigEntry) error {
-	var err error
-	r.config, err = parseOptions(c.Option)
+	options, err := resolver.ParseOptions(r, c.Option)
 	if nil != err {
 		return err
 	}
+	r.config = options.(*resolverConfig)
 	r.config.Namespace = c.Namespace
 	r.consumer, err = client.GetConsumerAPI()
 	if nil != err {
@@ -68,6 +72,8 @@ func (r *resolverMesh) Initialize(c *resolver.ConfigEntry) error {
 	if nil != err {
 		return err
 	}
+	// the snapshot is loaded before serving, so that the queries at startup are answered by it
+	r.snapshotServices = r.loadSnapshot()
 	return err
 }
 
@@ -76,26 +82,17 @@ func (r *resolverMesh) Destroy() {
 
 }
 
-// ServeDNS is like dns.Handler except ServeDNS may return an rcode
-// and/or error.
-// If ServeDNS writes to the response body, it should return a status
-// code. Resolvers assumes *no* reply has yet been written if the status
-// code is one of the following:
-//
-// * SERVFAIL (dns.RcodeServerFailure)
-//
-// * REFUSED (dns.RecodeRefused)
-//
-// * NOTIMP (dns.RcodeNotImplemented)
-func (r *resolverMesh) ServeDNS(ctx context.Context, question dns.Question, qname string) *dns.Msg {
+// ServeDNS is like dns.Handler except ServeDNS returns the response or an error.
+// The hosts which are not in the lookup table return resolver.ErrNotMine.
+func (r *resolverMesh) ServeDNS(ctx context.Context, question dns.Question, qname string) (*dns.Msg, error) {
 	_, matched := resolver.MatchSuffix(qname, r.suffix)
 	if !matched {
 		log.Infof("[Mesh] suffix not matched for name %s, suffix %s", qname, r.suffix)
-		return nil
+		return nil, resolver.ErrNotMine
 	}
 	ret := r.localDNSServer.ServeDNS(ctx, &question, qname)
 	if ret != nil {
-		return ret
+		return ret, nil
 	}
 	// 可能这个时候 qname 只有服务名称，这里手动补充 Namespace 信息
 	if strings.HasSuffix(qname, resolver.Quota) {
@@ -105,8 +102,9 @@ func (r *resolverMesh) ServeDNS(ctx context.Context, question dns.Question, qnam
 	ret = r.localDNSServer.ServeDNS(ctx, &question, qname)
 	if ret == nil {
 		log.Infof("[Mesh] host not found for name %s", qname)
+		return nil, resolver.NotMine("host %s not found in mesh", question.Name)
 	}
-	return ret
+	return ret, nil
 }
 
 func (r *resolverMesh) Start(ctx context.Context) {
@@ -115,7 +113,7 @@ func (r *resolverMesh) Start(ctx context.Context) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
-		var currentServices map[string]struct{}
+		currentServices := r.snapshotServices
 		var nextServices map[string]struct{}
 		var changed bool
 
@@ -147,13 +145,51 @@ func (r *resolverMesh) doReload(currentServices map[string]struct{}) (map[string
 		log.Errorf("[mesh] error to get services, err: %v", err)
 		return nil, false
 	}
-	if ifServiceListChanged(currentServices, services) {
+	changed := ifServiceListChanged(currentServices, services)
+	if changed {
 		r.localDNSServer.UpdateLookupTable(services, r.config.DNSAnswerIp)
+	}
+	// refresh the snapshot before it gets stale even though nothing changed
+	maxAge := time.Duration(r.config.SnapshotMaxAgeSec) * time.Second
+	if changed || time.Since(r.snapshotAt) > maxAge/2 {
+		r.saveSnapshot(services)
+	}
+	if changed {
 		return services, true
 	}
 	return nil, false
 }
 
+// loadSnapshot loads the lookup table from the snapshot before the first reload,
+// returns the services of the snapshot
+func (r *resolverMesh) loadSnapshot() map[string]struct{} {
+	if len(r.config.SnapshotPath) == 0 {
+		return nil
+	}
+	maxAge := time.Duration(r.config.SnapshotMaxAgeSec) * time.Second
+	services, err := loadSnapshot(r.config.SnapshotPath, r.config.Namespace, maxAge)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("[mesh] fail to load snapshot %s, err: %v", r.config.SnapshotPath, err)
+		}
+		return nil
+	}
+	r.localDNSServer.UpdateLookupTable(services, r.config.DNSAnswerIp)
+	log.Infof("[mesh] loaded %d services from snapshot %s", len(services), r.config.SnapshotPath)
+	return services
+}
+
+func (r *resolverMesh) saveSnapshot(services map[string]struct{}) {
+	if len(r.config.SnapshotPath) == 0 {
+		return
+	}
+	if err := saveSnapshot(r.config.SnapshotPath, r.config.Namespace, services); err != nil {
+		log.Errorf("[mesh] fail to save snapshot %s, err: %v", r.config.SnapshotPath, err)
+		return
+	}
+	r.snapshotAt = time.Now()
+}
+
 func ifServiceListChanged(currentServices, newNsServices map[string]struct{}) bool {
 	if len(currentServices) != len(newNsServices) {
 		return true
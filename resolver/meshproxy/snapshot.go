@@ -0,0 +1,84 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package meshproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+const snapshotVersion = 1
+
+// snapshot the services of the lookup table persisted to the local file,
+// which is loaded at startup before the first reload from polaris
+type snapshot struct {
+	Version   int       `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	Namespace string    `json:"namespace"`
+	Services  []string  `json:"services"`
+}
+
+func saveSnapshot(path string, namespace string, services map[string]struct{}) error {
+	snap := &snapshot{
+		Version:   snapshotVersion,
+		Timestamp: time.Now(),
+		Namespace: namespace,
+		Services:  make([]string, 0, len(services)),
+	}
+	for svc := range services {
+		snap.Services = append(snap.Services, svc)
+	}
+	sort.Strings(snap.Services)
+	data, err := json.Marshal(snap)
+	if nil != err {
+		return err
+	}
+	return resolver.WriteFileAtomic(path, data)
+}
+
+// loadSnapshot loads the services from the snapshot, the snapshot older than maxAge
+// or of the other namespace is rejected
+func loadSnapshot(path string, namespace string, maxAge time.Duration) (map[string]struct{}, error) {
+	data, err := os.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+	snap := &snapshot{}
+	if err := json.Unmarshal(data, snap); nil != err {
+		return nil, fmt.Errorf("fail to parse snapshot %s, err: %v", path, err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+	if snap.Namespace != namespace {
+		return nil, fmt.Errorf("snapshot namespace %s not match %s", snap.Namespace, namespace)
+	}
+	if age := time.Since(snap.Timestamp); age > maxAge {
+		return nil, fmt.Errorf("snapshot is stale, age %s", age.Truncate(time.Second))
+	}
+	services := make(map[string]struct{}, len(snap.Services))
+	for _, svc := range snap.Services {
+		services[svc] = struct{}{}
+	}
+	return services, nil
+}
@@ -0,0 +1,41 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package meshproxy
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_snapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mesh.json")
+	services := map[string]struct{}{"foo.default": {}, "bar.default": {}}
+	assert.NoError(t, saveSnapshot(path, "default", services))
+
+	loaded, err := loadSnapshot(path, "default", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, services, loaded)
+
+	_, err = loadSnapshot(path, "prod", time.Hour)
+	assert.Error(t, err)
+	_, err = loadSnapshot(path, "default", -time.Second)
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Options the typed options of the resolver, decoded from the option map of the config entry
+type Options interface {
+	// Verify checks the options decoded over the defaults, the fields derived from
+	// the others are filled as well
+	Verify() error
+}
+
+// OptionsDeclarer is implemented by the resolvers declaring the typed options, the options
+// are decoded through the json tags of the struct
+type OptionsDeclarer interface {
+	// NewOptions returns the pointer to the options struct filled with the default values
+	NewOptions() Options
+}
+
+// ParseOptions decodes the option map over the default options declared by the resolver,
+// the unknown keys are rejected. Nil is returned if the resolver declares no options
+func ParseOptions(handler NamingResolver, option map[string]interface{}) (Options, error) {
+	declarer, ok := handler.(OptionsDeclarer)
+	if !ok {
+		if len(option) > 0 {
+			return nil, fmt.Errorf("resolver %s accepts no option", handler.Name())
+		}
+		return nil, nil
+	}
+	options := declarer.NewOptions()
+	if len(option) > 0 {
+		if err := decodeOptions(option, options); nil != err {
+			return nil, fmt.Errorf("fail to unmarshal %s config entry, err is %v", handler.Name(), err)
+		}
+	}
+	if err := options.Verify(); nil != err {
+		return nil, err
+	}
+	return options, nil
+}
+
+// OptionValidator is implemented by the resolvers checking the environment of the parsed options,
+// such as the unreachable files, used by the validate command
+type OptionValidator interface {
+	ValidateOptions(options Options) error
+}
+
+// OptionsUpdater is implemented by the resolvers applying the changed options at runtime,
+// the options not supported to change should be kept and logged
+type OptionsUpdater interface {
+	UpdateOptions(options Options) error
+}
+
+// decodeOptions decodes the option map into the target through json, the unknown keys are rejected
+func decodeOptions(option map[string]interface{}, target interface{}) error {
+	jsonBytes, err := json.Marshal(option)
+	if nil != err {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+// VerifyReadableFile checks the file exists and could be read
+func VerifyReadableFile(path string) error {
+	f, err := os.Open(path)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if nil != err {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// VerifyFileDir checks the directory of the file exists, so that the file could be written
+func VerifyFileDir(path string) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if nil != err {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
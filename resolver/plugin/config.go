@@ -0,0 +1,82 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultSocketDir       = "/tmp/polaris-sidecar/plugins"
+	defaultTimeoutMs       = 500
+	defaultStartTimeoutSec = 10
+)
+
+// Config the resolver plugin binary launched and supervised by the sidecar,
+// the resolver entry of the same name is served by the plugin
+type Config struct {
+	Name string   `yaml:"name"`
+	Path string   `yaml:"path"`
+	Args []string `yaml:"args"`
+	// Env the extra environments of the plugin in the form of key=value
+	Env []string `yaml:"env"`
+	// Socket the unix socket the plugin listens on, default to /tmp/polaris-sidecar/plugins/<name>.sock
+	Socket string `yaml:"socket"`
+	// TimeoutMs the timeout of the query served by the plugin
+	TimeoutMs int `yaml:"timeout_ms"`
+	// StartTimeoutSec the timeout of the plugin to listen and initialize the resolver
+	StartTimeoutSec int `yaml:"start_timeout_sec"`
+}
+
+// Verify checks the config of the plugin
+func (c *Config) Verify() error {
+	if len(c.Name) == 0 {
+		return errors.New("plugin name should not be empty")
+	}
+	if len(c.Path) == 0 {
+		return fmt.Errorf("plugin %s path should not be empty", c.Name)
+	}
+	if c.TimeoutMs < 0 || c.StartTimeoutSec < 0 {
+		return fmt.Errorf("plugin %s timeout_ms and start_timeout_sec should greater or equals to 0", c.Name)
+	}
+	return nil
+}
+
+func (c *Config) socket() string {
+	if len(c.Socket) > 0 {
+		return c.Socket
+	}
+	return filepath.Join(defaultSocketDir, c.Name+".sock")
+}
+
+func (c *Config) timeout() time.Duration {
+	if c.TimeoutMs > 0 {
+		return time.Duration(c.TimeoutMs) * time.Millisecond
+	}
+	return defaultTimeoutMs * time.Millisecond
+}
+
+func (c *Config) startTimeout() time.Duration {
+	if c.StartTimeoutSec > 0 {
+		return time.Duration(c.StartTimeoutSec) * time.Second
+	}
+	return defaultStartTimeoutSec * time.Second
+}
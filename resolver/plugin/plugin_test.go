@@ -0,0 +1,178 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	debughttp "github.com/polarismesh/polaris-sidecar/pkg/http"
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+const envHelperPlugin = "GO_WANT_HELPER_PLUGIN"
+
+// testResolver answers cmdb.local., and the names of the errors under it
+type testResolver struct {
+	ttl int
+}
+
+func (r *testResolver) Name() string {
+	return "cmdb"
+}
+
+func (r *testResolver) Initialize(c *resolver.ConfigEntry) error {
+	r.ttl = c.DnsTtl
+	return nil
+}
+
+func (r *testResolver) Start(context.Context) {
+}
+
+func (r *testResolver) Destroy() {
+}
+
+func (r *testResolver) ServeDNS(ctx context.Context, question dns.Question, qname string) (*dns.Msg, error) {
+	switch qname {
+	case "cmdb.local.":
+		msg := &dns.Msg{}
+		rr, _ := dns.NewRR(question.Name + " 10 IN A 10.0.0.1")
+		rr.Header().Ttl = uint32(r.ttl)
+		msg.Answer = append(msg.Answer, rr)
+		return msg, nil
+	case "missing.cmdb.local.":
+		return nil, resolver.NameNotFound("host missing not in cmdb")
+	case "stale.cmdb.local.":
+		msg := &dns.Msg{}
+		return msg, resolver.NewExtendedError(dns.RcodeSuccess, dns.ExtendedErrorCodeStaleAnswer, "cmdb down")
+	case "slow.cmdb.local.":
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case "protocol.cmdb.local.":
+		return nil, errors.New(ctx.Value(resolver.ContextProtocol).(string))
+	}
+	return nil, resolver.ErrNotMine
+}
+
+func (r *testResolver) Debugger() []debughttp.DebugHandler {
+	return nil
+}
+
+// TestHelperPlugin is the plugin binary launched by the tests
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv(envHelperPlugin) != "1" {
+		return
+	}
+	if err := Serve(&testResolver{}); nil != err {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func question(name string) dns.Question {
+	return dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET}
+}
+
+func TestPluginResolver_ServeDNS(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "cmdb.sock")
+	ln, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = serve(ctx, ln, &testResolver{})
+	}()
+
+	r := &pluginResolver{conf: &Config{Name: "cmdb", Socket: socket, TimeoutMs: 100}}
+	r.request = newInitializeRequest(&resolver.ConfigEntry{Name: "cmdb", DnsTtl: 30})
+	r.conn, err = dial(socket)
+	assert.NoError(t, err)
+	defer r.conn.Close()
+	assert.NoError(t, r.initialize(ctx))
+	assert.Error(t, r.initialize(ctx))
+
+	resp, err := r.ServeDNS(ctx, question("cmdb.local.svc."), "cmdb.local.")
+	assert.NoError(t, err)
+	assert.Len(t, resp.Answer, 1)
+	assert.Equal(t, uint32(30), resp.Answer[0].Header().Ttl)
+
+	_, err = r.ServeDNS(ctx, question("other.local."), "other.local.")
+	assert.Equal(t, resolver.ErrNotMine, err)
+
+	_, err = r.ServeDNS(ctx, question("missing.cmdb.local."), "missing.cmdb.local.")
+	assert.True(t, errors.Is(err, resolver.ErrNameNotFound))
+	assert.Equal(t, "host missing not in cmdb", err.Error())
+
+	resp, err = r.ServeDNS(ctx, question("stale.cmdb.local."), "stale.cmdb.local.")
+	assert.NotNil(t, resp)
+	var extendedErr *resolver.ExtendedError
+	assert.True(t, errors.As(err, &extendedErr))
+	assert.Equal(t, dns.ExtendedErrorCodeStaleAnswer, extendedErr.Code)
+
+	protocolCtx := context.WithValue(ctx, resolver.ContextProtocol, "tcp")
+	_, err = r.ServeDNS(protocolCtx, question("protocol.cmdb.local."), "protocol.cmdb.local.")
+	assert.EqualError(t, err, "tcp")
+
+	// the slow plugin is answered with SERVFAIL in time
+	start := time.Now()
+	_, err = r.ServeDNS(ctx, question("slow.cmdb.local."), "slow.cmdb.local.")
+	assert.True(t, errors.As(err, &extendedErr))
+	assert.Equal(t, dns.RcodeServerFailure, extendedErr.Rcode)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestPluginResolver_restart(t *testing.T) {
+	conf := &Config{
+		Name:   "cmdb",
+		Path:   os.Args[0],
+		Args:   []string{"-test.run=TestHelperPlugin"},
+		Env:    []string{envHelperPlugin + "=1"},
+		Socket: filepath.Join(t.TempDir(), "cmdb.sock"),
+	}
+	r := &pluginResolver{conf: conf}
+	assert.NoError(t, r.Initialize(&resolver.ConfigEntry{Name: "cmdb", DnsTtl: 10}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Start(ctx)
+	defer r.Destroy()
+
+	_, err := r.ServeDNS(ctx, question("cmdb.local."), "cmdb.local.")
+	assert.NoError(t, err)
+
+	r.lock.Lock()
+	p := r.process
+	r.lock.Unlock()
+	assert.NoError(t, p.cmd.Process.Kill())
+	<-p.exited
+	assert.Eventually(t, func() bool {
+		_, err := r.ServeDNS(ctx, question("cmdb.local."), "cmdb.local.")
+		return err == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	r.lock.Lock()
+	assert.NotEqual(t, p, r.process)
+	r.lock.Unlock()
+}
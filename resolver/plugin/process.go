@@ -0,0 +1,80 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package plugin
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+)
+
+const stopTimeout = 5 * time.Second
+
+// process the running plugin binary
+type process struct {
+	cmd       *exec.Cmd
+	startTime time.Time
+	exited    chan struct{}
+}
+
+// startProcess launches the plugin binary listening on the socket, the output of the plugin
+// is written to the output of the sidecar
+func startProcess(conf *Config) (*process, error) {
+	socket := conf.socket()
+	if err := os.MkdirAll(filepath.Dir(socket), os.ModePerm); nil != err {
+		return nil, err
+	}
+	_ = os.Remove(socket)
+	cmd := exec.Command(conf.Path, conf.Args...)
+	cmd.Env = append(append(os.Environ(), conf.Env...), EnvPluginSocket+"="+socket)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); nil != err {
+		return nil, err
+	}
+	p := &process{cmd: cmd, startTime: time.Now(), exited: make(chan struct{})}
+	go func() {
+		err := cmd.Wait()
+		log.Infof("[plugin] plugin %s pid %d exited, err: %v", conf.Name, cmd.Process.Pid, err)
+		close(p.exited)
+	}()
+	log.Infof("[plugin] started plugin %s pid %d, socket %s", conf.Name, cmd.Process.Pid, socket)
+	return p, nil
+}
+
+// stop terminates the plugin, which is killed if it does not exit in time
+func (p *process) stop() {
+	select {
+	case <-p.exited:
+		return
+	default:
+	}
+	if err := p.cmd.Process.Signal(syscall.SIGTERM); nil != err {
+		_ = p.cmd.Process.Kill()
+	}
+	select {
+	case <-p.exited:
+	case <-time.After(stopTimeout):
+		_ = p.cmd.Process.Kill()
+		<-p.exited
+	}
+}
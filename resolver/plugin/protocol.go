@@ -0,0 +1,228 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+// Package plugin runs the resolvers as the separate binaries, the sidecar launches the plugin
+// binary with the unix socket in EnvPluginSocket and calls it over grpc with the json codec.
+// The plugin binary implements resolver.NamingResolver and calls Serve in its main
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+const (
+	// EnvPluginSocket the unix socket the plugin binary listens on
+	EnvPluginSocket = "POLARIS_SIDECAR_PLUGIN_SOCKET"
+
+	serviceName = "polaris.sidecar.resolver.v1.Resolver"
+	codecName   = "json"
+)
+
+// the kinds of the errors returned by the plugin
+const (
+	errorNotMine      = "not_mine"
+	errorNameNotFound = "name_not_found"
+	errorExtended     = "extended"
+	errorOther        = "other"
+)
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes the messages as json, so that the plugins need no generated code
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+// InitializeRequest the config entry of the resolver, the option is passed as it is
+type InitializeRequest struct {
+	Name      string                 `json:"name"`
+	Suffix    string                 `json:"suffix"`
+	Zones     []string               `json:"zones,omitempty"`
+	QTypes    []string               `json:"qtypes,omitempty"`
+	DnsTtl    int                    `json:"dns_ttl"`
+	Namespace string                 `json:"namespace"`
+	Option    map[string]interface{} `json:"option,omitempty"`
+}
+
+// InitializeResponse the response of Initialize
+type InitializeResponse struct {
+}
+
+// ServeDNSRequest the question to resolve, qname is the name with the search names stripped
+type ServeDNSRequest struct {
+	Name     string `json:"name"`
+	Qtype    uint16 `json:"qtype"`
+	Qclass   uint16 `json:"qclass"`
+	QName    string `json:"qname"`
+	Protocol string `json:"protocol"`
+}
+
+// ServeDNSResponse the packed dns message and the error of the resolver
+type ServeDNSResponse struct {
+	Msg   []byte `json:"msg,omitempty"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// Error the error of the resolver, the kind maps to ErrNotMine, ErrNameNotFound and ExtendedError
+type Error struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Rcode   int    `json:"rcode,omitempty"`
+	Code    uint16 `json:"code,omitempty"`
+}
+
+func (r *ServeDNSRequest) question() dns.Question {
+	return dns.Question{Name: r.Name, Qtype: r.Qtype, Qclass: r.Qclass}
+}
+
+func newInitializeRequest(c *resolver.ConfigEntry) *InitializeRequest {
+	return &InitializeRequest{
+		Name:      c.Name,
+		Suffix:    c.Suffix,
+		Zones:     c.Zones,
+		QTypes:    c.QTypes,
+		DnsTtl:    c.DnsTtl,
+		Namespace: c.Namespace,
+		Option:    c.Option,
+	}
+}
+
+func (r *InitializeRequest) entry() *resolver.ConfigEntry {
+	return &resolver.ConfigEntry{
+		Name:      r.Name,
+		Suffix:    r.Suffix,
+		Zones:     r.Zones,
+		QTypes:    r.QTypes,
+		DnsTtl:    r.DnsTtl,
+		Enable:    true,
+		Option:    r.Option,
+		Namespace: r.Namespace,
+	}
+}
+
+func encodeError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var extendedErr *resolver.ExtendedError
+	switch {
+	case errors.As(err, &extendedErr):
+		return &Error{Kind: errorExtended, Message: extendedErr.Text, Rcode: extendedErr.Rcode,
+			Code: extendedErr.Code}
+	case errors.Is(err, resolver.ErrNotMine):
+		return &Error{Kind: errorNotMine, Message: err.Error()}
+	case errors.Is(err, resolver.ErrNameNotFound):
+		return &Error{Kind: errorNameNotFound, Message: err.Error()}
+	default:
+		return &Error{Kind: errorOther, Message: err.Error()}
+	}
+}
+
+func decodeError(e *Error) error {
+	if e == nil {
+		return nil
+	}
+	switch e.Kind {
+	case errorNotMine:
+		if e.Message == resolver.ErrNotMine.Error() {
+			return resolver.ErrNotMine
+		}
+		return resolver.NotMine("%s", e.Message)
+	case errorNameNotFound:
+		if e.Message == resolver.ErrNameNotFound.Error() {
+			return resolver.ErrNameNotFound
+		}
+		return resolver.NameNotFound("%s", e.Message)
+	case errorExtended:
+		return resolver.NewExtendedError(e.Rcode, e.Code, "%s", e.Message)
+	default:
+		return errors.New(e.Message)
+	}
+}
+
+// pluginServer the service implemented by the plugin binary
+type pluginServer interface {
+	Initialize(context.Context, *InitializeRequest) (*InitializeResponse, error)
+	ServeDNS(context.Context, *ServeDNSRequest) (*ServeDNSResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*pluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Initialize",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &InitializeRequest{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(pluginServer).Initialize(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: methodInitialize}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(pluginServer).Initialize(ctx, req.(*InitializeRequest))
+				})
+			},
+		},
+		{
+			MethodName: "ServeDNS",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &ServeDNSRequest{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(pluginServer).ServeDNS(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: methodServeDNS}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(pluginServer).ServeDNS(ctx, req.(*ServeDNSRequest))
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+const (
+	methodInitialize = "/" + serviceName + "/Initialize"
+	methodServeDNS   = "/" + serviceName + "/ServeDNS"
+)
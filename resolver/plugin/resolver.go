@@ -0,0 +1,213 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	debughttp "github.com/polarismesh/polaris-sidecar/pkg/http"
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = 30 * time.Second
+	// stableDuration the plugin running longer than it resets the restart backoff
+	stableDuration = time.Minute
+)
+
+// Register registers the resolver served by the plugin binary, the name of the built-in
+// resolvers could not be taken by the plugin
+func Register(conf *Config) error {
+	if err := conf.Verify(); nil != err {
+		return err
+	}
+	if existing := resolver.NameResolver(conf.Name); existing != nil {
+		if _, ok := existing.(*pluginResolver); !ok {
+			return fmt.Errorf("plugin %s conflicts with the built-in resolver", conf.Name)
+		}
+	}
+	resolver.Register(&pluginResolver{conf: conf})
+	return nil
+}
+
+// pluginResolver the resolver served by the plugin binary, which is restarted when it exits
+type pluginResolver struct {
+	conf    *Config
+	request *InitializeRequest
+	conn    *grpc.ClientConn
+
+	lock    sync.Mutex
+	process *process
+	cancel  context.CancelFunc
+}
+
+// Name will return the name to resolver
+func (r *pluginResolver) Name() string {
+	return r.conf.Name
+}
+
+// Initialize launches the plugin and initializes the resolver of it
+func (r *pluginResolver) Initialize(c *resolver.ConfigEntry) error {
+	r.request = newInitializeRequest(c)
+	conn, err := dial(r.conf.socket())
+	if nil != err {
+		return err
+	}
+	r.conn = conn
+	if err := r.launch(context.Background()); nil != err {
+		_ = r.conn.Close()
+		return err
+	}
+	return nil
+}
+
+func dial(socket string) (*grpc.ClientConn, error) {
+	// the plugin restarted is reconnected soon
+	connectParams := grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: 100 * time.Millisecond, Multiplier: 1.6, MaxDelay: time.Second},
+		MinConnectTimeout: time.Second,
+	}
+	return grpc.Dial("unix://"+socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithConnectParams(connectParams),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)))
+}
+
+// launch starts the plugin binary and waits for it to initialize the resolver
+func (r *pluginResolver) launch(ctx context.Context) error {
+	p, err := startProcess(r.conf)
+	if nil != err {
+		return fmt.Errorf("fail to start plugin %s: %v", r.conf.Name, err)
+	}
+	r.lock.Lock()
+	r.process = p
+	r.lock.Unlock()
+	if err := r.initialize(ctx); nil != err {
+		p.stop()
+		return err
+	}
+	log.Infof("[plugin] plugin %s is initialized", r.conf.Name)
+	return nil
+}
+
+func (r *pluginResolver) initialize(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.conf.startTimeout())
+	defer cancel()
+	resp := &InitializeResponse{}
+	if err := r.conn.Invoke(ctx, methodInitialize, r.request, resp, grpc.WaitForReady(true)); nil != err {
+		return fmt.Errorf("fail to initialize plugin %s: %v", r.conf.Name, status.Convert(err).Message())
+	}
+	return nil
+}
+
+// Start supervises the plugin, which is restarted with backoff when it exits
+func (r *pluginResolver) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	r.lock.Lock()
+	r.cancel = cancel
+	r.lock.Unlock()
+	go r.supervise(ctx)
+}
+
+func (r *pluginResolver) supervise(ctx context.Context) {
+	restartBackoff := minRestartBackoff
+	for {
+		r.lock.Lock()
+		p := r.process
+		r.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.exited:
+		}
+		if time.Since(p.startTime) > stableDuration {
+			restartBackoff = minRestartBackoff
+		}
+		log.Errorf("[plugin] plugin %s exited, restart in %s", r.conf.Name, restartBackoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartBackoff):
+		}
+		if restartBackoff *= 2; restartBackoff > maxRestartBackoff {
+			restartBackoff = maxRestartBackoff
+		}
+		if err := r.launch(ctx); nil != err {
+			log.Errorf("[plugin] fail to restart plugin %s, err: %v", r.conf.Name, err)
+		}
+	}
+}
+
+// Destroy terminates the plugin
+func (r *pluginResolver) Destroy() {
+	r.lock.Lock()
+	p, cancel := r.process, r.cancel
+	r.lock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if p != nil {
+		p.stop()
+	}
+	if r.conn != nil {
+		_ = r.conn.Close()
+	}
+}
+
+// ServeDNS resolves the question by the plugin, the plugin not answering in time or not running
+// is answered with SERVFAIL, instead of stalling the query
+func (r *pluginResolver) ServeDNS(ctx context.Context, question dns.Question, qname string) (*dns.Msg, error) {
+	req := &ServeDNSRequest{Name: question.Name, Qtype: question.Qtype, Qclass: question.Qclass, QName: qname}
+	if protocol, ok := ctx.Value(resolver.ContextProtocol).(string); ok {
+		req.Protocol = protocol
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.conf.timeout())
+	defer cancel()
+	resp := &ServeDNSResponse{}
+	if err := r.conn.Invoke(ctx, methodServeDNS, req, resp); nil != err {
+		st := status.Convert(err)
+		if st.Code() == codes.DeadlineExceeded {
+			return nil, resolver.NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNoReachableAuthority,
+				"plugin %s timed out", r.conf.Name).Wrap(err)
+		}
+		return nil, resolver.NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNoReachableAuthority,
+			"plugin %s unavailable", r.conf.Name).Wrap(err)
+	}
+	msg, err := unpack(resp.Msg)
+	if nil != err {
+		return nil, fmt.Errorf("fail to unpack response of plugin %s: %v", r.conf.Name, err)
+	}
+	return msg, decodeError(resp.Error)
+}
+
+// Debugger the plugin has no debug handler
+func (r *pluginResolver) Debugger() []debughttp.DebugHandler {
+	return nil
+}
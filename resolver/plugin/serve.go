@@ -0,0 +1,122 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+
+	"github.com/polarismesh/polaris-sidecar/resolver"
+)
+
+// Serve serves the resolver on the unix socket passed by the sidecar, it is called in the main of
+// the plugin binary and returns after the sidecar terminates the plugin
+func Serve(r resolver.NamingResolver) error {
+	socket := os.Getenv(EnvPluginSocket)
+	if len(socket) == 0 {
+		return fmt.Errorf("%s is not set, the plugin should be launched by polaris-sidecar", EnvPluginSocket)
+	}
+	_ = os.Remove(socket)
+	ln, err := net.Listen("unix", socket)
+	if nil != err {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	return serve(ctx, ln, r)
+}
+
+func serve(ctx context.Context, ln net.Listener, r resolver.NamingResolver) error {
+	svc := &pluginService{resolver: r, ctx: ctx}
+	svr := grpc.NewServer()
+	svr.RegisterService(&serviceDesc, svc)
+	go func() {
+		<-ctx.Done()
+		svr.GracefulStop()
+	}()
+	err := svr.Serve(ln)
+	svc.destroy()
+	return err
+}
+
+// pluginService serves the resolver of the plugin binary
+type pluginService struct {
+	resolver resolver.NamingResolver
+	ctx      context.Context
+
+	lock        sync.Mutex
+	initialized bool
+}
+
+// Initialize initializes and starts the resolver, the sidecar initializes each process once
+func (s *pluginService) Initialize(_ context.Context, req *InitializeRequest) (*InitializeResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.initialized {
+		return nil, errors.New("resolver is already initialized")
+	}
+	if err := s.resolver.Initialize(req.entry()); nil != err {
+		return nil, err
+	}
+	s.resolver.Start(s.ctx)
+	s.initialized = true
+	return &InitializeResponse{}, nil
+}
+
+// ServeDNS resolves the question, the errors of the resolver are returned in the response
+func (s *pluginService) ServeDNS(ctx context.Context, req *ServeDNSRequest) (*ServeDNSResponse, error) {
+	ctx = context.WithValue(ctx, resolver.ContextProtocol, req.Protocol)
+	msg, err := s.resolver.ServeDNS(ctx, req.question(), req.QName)
+	resp := &ServeDNSResponse{Error: encodeError(err)}
+	if msg != nil {
+		packed, packErr := msg.Pack()
+		if nil != packErr {
+			return nil, fmt.Errorf("fail to pack response of %s: %v", req.Name, packErr)
+		}
+		resp.Msg = packed
+	}
+	return resp, nil
+}
+
+func (s *pluginService) destroy() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.initialized {
+		s.resolver.Destroy()
+	}
+}
+
+func unpack(packed []byte) (*dns.Msg, error) {
+	if len(packed) == 0 {
+		return nil, nil
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(packed); nil != err {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,261 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultSlip = 2
+	// clientIdleTimeout the per client limiters idle longer than it are released
+	clientIdleTimeout = time.Minute
+)
+
+// ProtectionConfig rate limits and access control of the dns listeners
+type ProtectionConfig struct {
+	// AllowCIDRs the client networks allowed to query, all clients are allowed when empty
+	AllowCIDRs []string `yaml:"allow_cidrs"`
+	// ClientQPS queries per second allowed for each client ip, 0 means unlimited
+	ClientQPS float64 `yaml:"client_qps"`
+	// ClientBurst burst of the queries for each client ip, default to ClientQPS
+	ClientBurst int `yaml:"client_burst"`
+	// GlobalQPS queries per second allowed for all the clients, 0 means unlimited
+	GlobalQPS float64 `yaml:"global_qps"`
+	// GlobalBurst burst of the queries for all the clients, default to GlobalQPS
+	GlobalBurst int `yaml:"global_burst"`
+	// Slip one of every Slip rate limited udp queries is answered with a truncated response,
+	// so that the legitimate clients could retry over tcp, the others are dropped.
+	// 0 drops all the rate limited udp queries, 1 truncates all of them
+	Slip int `yaml:"slip"`
+	// MaxConcurrentRecurse the recursive queries in flight, 0 means unlimited
+	MaxConcurrentRecurse int `yaml:"max_concurrent_recurse"`
+	// MaxTCPConnections the tcp connections accepted at the same time, 0 means unlimited
+	MaxTCPConnections int `yaml:"max_tcp_connections"`
+}
+
+// DefaultProtectionConfig returns the protection config which limits nothing
+func DefaultProtectionConfig() *ProtectionConfig {
+	return &ProtectionConfig{Slip: defaultSlip}
+}
+
+// limitAction what to do with the query of the client
+type limitAction int
+
+const (
+	// limitAccept serves the query
+	limitAccept limitAction = iota
+	// limitDeny the client is not allowed to query
+	limitDeny
+	// limitRefuse answers REFUSED to the rate limited query
+	limitRefuse
+	// limitTruncate answers an empty truncated response to the rate limited query
+	limitTruncate
+	// limitDrop drops the rate limited query without answer
+	limitDrop
+)
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// guard applies the protection config to the queries, it is shared by the udp and tcp handlers
+type guard struct {
+	allowNets   []*net.IPNet
+	clientLimit rate.Limit
+	clientBurst int
+	global      *rate.Limiter
+	slip        int
+	slipCount   uint64
+	recurseSem  chan struct{}
+
+	lock      sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+// Verify checks the limits and the allowed cidrs
+func (c *ProtectionConfig) Verify() error {
+	_, err := newGuard(c)
+	return err
+}
+
+func newGuard(conf *ProtectionConfig) (*guard, error) {
+	if conf == nil {
+		conf = DefaultProtectionConfig()
+	}
+	if conf.ClientQPS < 0 || conf.GlobalQPS < 0 || conf.ClientBurst < 0 || conf.GlobalBurst < 0 {
+		return nil, fmt.Errorf("protection qps and burst should greater or equals to 0")
+	}
+	if conf.Slip < 0 || conf.MaxConcurrentRecurse < 0 || conf.MaxTCPConnections < 0 {
+		return nil, fmt.Errorf("protection slip and max values should greater or equals to 0")
+	}
+	g := &guard{
+		slip:      conf.Slip,
+		clients:   make(map[string]*clientLimiter),
+		lastSweep: time.Now(),
+	}
+	for _, cidr := range conf.AllowCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if nil != err {
+			// a single address is allowed as well
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid protection allow cidr %s, err: %v", cidr, err)
+			}
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		}
+		g.allowNets = append(g.allowNets, ipNet)
+	}
+	if conf.ClientQPS > 0 {
+		g.clientLimit = rate.Limit(conf.ClientQPS)
+		g.clientBurst = burstOf(conf.ClientQPS, conf.ClientBurst)
+	}
+	if conf.GlobalQPS > 0 {
+		g.global = rate.NewLimiter(rate.Limit(conf.GlobalQPS), burstOf(conf.GlobalQPS, conf.GlobalBurst))
+	}
+	if conf.MaxConcurrentRecurse > 0 {
+		g.recurseSem = make(chan struct{}, conf.MaxConcurrentRecurse)
+	}
+	return g, nil
+}
+
+func burstOf(qps float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	if qps < 1 {
+		return 1
+	}
+	return int(qps)
+}
+
+// check returns the action for the query of the client
+func (g *guard) check(addr net.Addr, protocol string) limitAction {
+	ip := addrIP(addr)
+	if !g.allowed(ip) {
+		return limitDeny
+	}
+	if g.allowQuery(ip) {
+		return limitAccept
+	}
+	if protocol != "udp" {
+		return limitRefuse
+	}
+	switch g.slip {
+	case 0:
+		return limitDrop
+	case 1:
+		return limitTruncate
+	}
+	if atomic.AddUint64(&g.slipCount, 1)%uint64(g.slip) == 0 {
+		return limitTruncate
+	}
+	return limitDrop
+}
+
+func (g *guard) allowed(ip net.IP) bool {
+	if len(g.allowNets) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range g.allowNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *guard) allowQuery(ip net.IP) bool {
+	if g.clientLimit > 0 && ip != nil && !g.clientLimiter(ip.String()).Allow() {
+		return false
+	}
+	if g.global != nil && !g.global.Allow() {
+		return false
+	}
+	return true
+}
+
+func (g *guard) clientLimiter(key string) *rate.Limiter {
+	now := time.Now()
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if now.Sub(g.lastSweep) > clientIdleTimeout {
+		for k, c := range g.clients {
+			if now.Sub(c.lastSeen) > clientIdleTimeout {
+				delete(g.clients, k)
+			}
+		}
+		g.lastSweep = now
+	}
+	c, ok := g.clients[key]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(g.clientLimit, g.clientBurst)}
+		g.clients[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// acquireRecurse takes a slot of the concurrent recursive queries, returns false when all are in use
+func (g *guard) acquireRecurse() bool {
+	if g.recurseSem == nil {
+		return true
+	}
+	select {
+	case g.recurseSem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseRecurse returns the slot taken by acquireRecurse
+func (g *guard) releaseRecurse() {
+	if g.recurseSem == nil {
+		return
+	}
+	<-g.recurseSem
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if nil != err {
+		return nil
+	}
+	return net.ParseIP(host)
+}
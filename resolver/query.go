@@ -0,0 +1,103 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/polarismesh/polaris-sidecar/version"
+)
+
+const (
+	// anyHinfoTtl ttl of the RFC 8482 synthesized HINFO answer
+	anyHinfoTtl = 3600
+	// chaosTtl ttl of the CHAOS class answers
+	chaosTtl = 0
+)
+
+// validateRequest checks the request before it is served, returns the error answered
+// to the client when the request should not be served by the resolvers
+func validateRequest(req *dns.Msg) *ExtendedError {
+	if req.Opcode != dns.OpcodeQuery {
+		return NewExtendedError(dns.RcodeNotImplemented, dns.ExtendedErrorCodeNotSupported,
+			"opcode %s not supported", dns.OpcodeToString[req.Opcode])
+	}
+	// RFC 9619, a query contains exactly one question
+	if len(req.Question) != 1 {
+		return NewExtendedError(dns.RcodeFormatError, dns.ExtendedErrorCodeInvalidData,
+			"query should contain exactly one question")
+	}
+	if opt := req.IsEdns0(); opt != nil && opt.Version() != 0 {
+		return NewExtendedError(dns.RcodeBadVers, dns.ExtendedErrorCodeNotSupported,
+			"edns version %d not supported", opt.Version())
+	}
+	question := req.Question[0]
+	if _, ok := dns.IsDomainName(question.Name); !ok || !dns.IsFqdn(question.Name) {
+		return NewExtendedError(dns.RcodeFormatError, dns.ExtendedErrorCodeInvalidData, "invalid question name")
+	}
+	switch question.Qclass {
+	case dns.ClassINET, dns.ClassCHAOS:
+	default:
+		return NewExtendedError(dns.RcodeNotImplemented, dns.ExtendedErrorCodeNotSupported,
+			"class %s not supported", dns.Class(question.Qclass).String())
+	}
+	switch question.Qtype {
+	case dns.TypeAXFR, dns.TypeIXFR:
+		return NewExtendedError(dns.RcodeRefused, dns.ExtendedErrorCodeNotSupported, "zone transfer not supported")
+	case dns.TypeOPT, dns.TypeTSIG, dns.TypeTKEY, dns.TypeNone:
+		return NewExtendedError(dns.RcodeFormatError, dns.ExtendedErrorCodeInvalidData,
+			"qtype %s not allowed in question", dns.Type(question.Qtype).String())
+	}
+	return nil
+}
+
+// chaosAnswer answers the CHAOS class server identification queries,
+// returns nil when the name is not supported
+func chaosAnswer(question dns.Question) []dns.RR {
+	if question.Qtype != dns.TypeTXT && question.Qtype != dns.TypeANY {
+		return nil
+	}
+	var txt string
+	switch strings.ToLower(question.Name) {
+	case "version.bind.", "version.server.":
+		txt = "polaris-sidecar " + version.Get()
+	case "hostname.bind.", "id.server.":
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil
+		}
+		txt = hostname
+	default:
+		return nil
+	}
+	return []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS, Ttl: chaosTtl},
+		Txt: []string{txt},
+	}}
+}
+
+// anyAnswer builds the RFC 8482 minimal response to the ANY query
+func anyAnswer(question dns.Question) []dns.RR {
+	return []dns.RR{&dns.HINFO{
+		Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeHINFO, Class: dns.ClassINET, Ttl: anyHinfoTtl},
+		Cpu: "RFC8482",
+	}}
+}
@@ -0,0 +1,89 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const defaultResolveTimeoutMs = 2000
+
+// ResolveConfig how the queries are resolved by the resolvers
+type ResolveConfig struct {
+	// TimeoutMs the deadline of the query across all the resolvers and the recursion, the query not
+	// answered in time is answered SERVFAIL. It should be less than the dns timeout of the clients, 5s of glibc by default
+	TimeoutMs int `yaml:"timeout_ms"`
+	// Parallel queries the resolvers matching the name at the same time instead of one by one,
+	// the answer of the resolver first in order is still taken
+	Parallel bool `yaml:"parallel"`
+}
+
+// DefaultResolveConfig returns the default resolve config
+func DefaultResolveConfig() *ResolveConfig {
+	return &ResolveConfig{TimeoutMs: defaultResolveTimeoutMs}
+}
+
+// Verify checks the resolve config
+func (c *ResolveConfig) Verify() error {
+	if c.TimeoutMs <= 0 {
+		return fmt.Errorf("resolve.timeout_ms should greater than 0")
+	}
+	return nil
+}
+
+func (c *ResolveConfig) timeout() time.Duration {
+	return time.Duration(c.TimeoutMs) * time.Millisecond
+}
+
+// resolveResult the response and the error of a resolver
+type resolveResult struct {
+	resp *dns.Msg
+	err  error
+}
+
+// serve calls the resolver, the resolver not respecting the deadline of the context is
+// left running in the background, so that it could not stall the query
+func serve(ctx context.Context, rt *route, question dns.Question, qname string) <-chan *resolveResult {
+	results := make(chan *resolveResult, 1)
+	go func() {
+		resp, err := rt.resolver.ServeDNS(ctx, question, qname)
+		results <- &resolveResult{resp: resp, err: err}
+	}()
+	return results
+}
+
+// wait returns the result of the resolver, or the timeout error when the deadline is exceeded
+func wait(ctx context.Context, rt *route, results <-chan *resolveResult) *resolveResult {
+	select {
+	case result := <-results:
+		return result
+	case <-ctx.Done():
+	}
+	// prefer the result arriving together with the deadline
+	select {
+	case result := <-results:
+		return result
+	default:
+	}
+	return &resolveResult{err: NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNoReachableAuthority,
+		"resolver %s timed out", rt.resolver.Name()).Wrap(ctx.Err())}
+}
@@ -0,0 +1,125 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// delayed answers after the delay, ignoring the deadline like a blocking sdk call
+func delayed(delay time.Duration, resp func(question dns.Question) (*dns.Msg, error)) func(
+	question dns.Question) (*dns.Msg, error) {
+	return func(question dns.Question) (*dns.Msg, error) {
+		time.Sleep(delay)
+		return resp(question)
+	}
+}
+
+func Test_dnsServer_resolveDeadline(t *testing.T) {
+	slow := &testResolver{name: "slow", resp: delayed(time.Second, answerA("10.0.0.1"))}
+	routes, err := buildRoutes([]*ConfigEntry{{Name: "slow", Suffix: ".", Enable: true}}, []NamingResolver{slow})
+	assert.NoError(t, err)
+	d := buildDNSServer("udp", routes, nil, time.Second, nil, false)
+	d.resolveTimeout = 50 * time.Millisecond
+
+	req := new(dns.Msg)
+	req.SetQuestion("foo.", dns.TypeA)
+	req.SetEdns0(1232, false)
+	w := &testResponseWriter{}
+	start := time.Now()
+	d.ServeDNS(w, req)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, dns.RcodeServerFailure, w.msg.Rcode)
+	ede := w.msg.IsEdns0().Option[0].(*dns.EDNS0_EDE)
+	assert.Equal(t, dns.ExtendedErrorCodeNoReachableAuthority, ede.InfoCode)
+	assert.Equal(t, "resolver slow timed out", ede.ExtraText)
+}
+
+func Test_dnsServer_resolveParallel(t *testing.T) {
+	var calls int32
+	counted := func(resp func(question dns.Question) (*dns.Msg, error)) func(question dns.Question) (*dns.Msg, error) {
+		return func(question dns.Question) (*dns.Msg, error) {
+			atomic.AddInt32(&calls, 1)
+			return resp(question)
+		}
+	}
+	mesh := &testResolver{name: "mesh", resp: counted(delayed(100*time.Millisecond, answerErr(ErrNotMine)))}
+	cluster := &testResolver{name: "cluster", resp: counted(delayed(100*time.Millisecond, answerA("10.0.0.2")))}
+	root := &testResolver{name: "root", resp: counted(answerA("10.0.0.1"))}
+	entries := []*ConfigEntry{
+		{Name: "mesh", Suffix: ".", Enable: true},
+		{Name: "cluster", Suffix: ".", Enable: true},
+		{Name: "root", Suffix: ".", Enable: true},
+	}
+	routes, err := buildRoutes(entries, []NamingResolver{mesh, cluster, root})
+	assert.NoError(t, err)
+	d := buildDNSServer("udp", routes, nil, time.Second, nil, false)
+	d.resolveTimeout = time.Second
+	d.parallel = true
+
+	// the resolvers are called at the same time, the answer first in order is taken
+	start := time.Now()
+	rt, resp, err := d.resolve(context.Background(), dns.Question{Name: "foo.", Qtype: dns.TypeA,
+		Qclass: dns.ClassINET}, "foo.", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster", rt.resolver.Name())
+	assert.Equal(t, "10.0.0.2", resp.Answer[0].(*dns.A).A.String())
+	assert.Less(t, time.Since(start), 180*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// the sequential mode stops at the first answer
+	atomic.StoreInt32(&calls, 0)
+	d.parallel = false
+	rt, _, err = d.resolve(context.Background(), dns.Question{Name: "foo.", Qtype: dns.TypeA,
+		Qclass: dns.ClassINET}, "foo.", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster", rt.resolver.Name())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func Test_dnsServer_recurseDeadline(t *testing.T) {
+	// the recursors never answer
+	var recursors []string
+	for i := 0; i < 2; i++ {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer conn.Close()
+		recursors = append(recursors, conn.LocalAddr().String())
+	}
+	d := buildDNSServer("udp", nil, nil, time.Second, recursors, true)
+	d.resolveTimeout = 100 * time.Millisecond
+
+	req := new(dns.Msg)
+	req.SetQuestion("foo.", dns.TypeA)
+	req.SetEdns0(1232, false)
+	w := &testResponseWriter{}
+	start := time.Now()
+	d.ServeDNS(w, req)
+	// the deadline of the query covers the recursors as well
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, dns.RcodeServerFailure, w.msg.Rcode)
+	ede := w.msg.IsEdns0().Option[0].(*dns.EDNS0_EDE)
+	assert.Equal(t, dns.ExtendedErrorCodeNoReachableAuthority, ede.InfoCode)
+}
@@ -19,6 +19,8 @@ package resolver
 
 import (
 	"context"
+	"errors"
+	"sort"
 
 	"github.com/miekg/dns"
 	debughttp "github.com/polarismesh/polaris-sidecar/pkg/http"
@@ -29,14 +31,23 @@ const (
 	PluginNameDnsAgent = "dnsagent"
 	// PluginNameMeshProxy mesh-proxy plugin identity
 	PluginNameMeshProxy = "meshproxy"
+	// PluginNameKubernetes kubernetes plugin identity
+	PluginNameKubernetes = "kubernetes"
 )
 
 type ResolverConfig struct {
 	BindLocalhost bool
 	BindIP        string
 	BindPort      uint32
-	Recurse       *RecurseConfig
-	Resolvers     []*ConfigEntry
+	// Listeners the dns listeners, a listener of BindIP and BindPort is used when empty
+	Listeners []*ListenerConfig
+	// ResolvConfPath the resolv.conf holding the upstream nameservers and search names
+	ResolvConfPath string
+	Recurse        *RecurseConfig
+	Protection     *ProtectionConfig
+	Listen         *ListenConfig
+	Resolve        *ResolveConfig
+	Resolvers      []*ConfigEntry
 }
 
 // RecurseConfig recursor name resolve config
@@ -44,18 +55,35 @@ type RecurseConfig struct {
 	Enable      bool     `yaml:"enable"`
 	TimeoutSec  int      `yaml:"timeoutSec"`
 	NameServers []string `yaml:"name_servers"`
+	// SearchNames the search names stripped from the queries, read from the resolv.conf if empty
+	SearchNames []string `yaml:"search_names"`
+	// ResolvConfWatchIntervalSec the interval to check the resolv.conf for the upstream changes
+	ResolvConfWatchIntervalSec int           `yaml:"resolv_conf_watch_interval_sec"`
+	DNSSEC                     *DNSSECConfig `yaml:"dnssec"`
 }
 
 // ConfigEntry: resolver plugin config entry
 type ConfigEntry struct {
-	Name      string                 `yaml:"name"`
-	Suffix    string                 `yaml:"suffix"`
+	Name   string `yaml:"name"`
+	Suffix string `yaml:"suffix"`
+	// Zones the zones owned by the resolver, the query is routed to the resolver with the
+	// longest matching zone, default to the suffix
+	Zones []string `yaml:"zones"`
+	// QTypes the query types owned by the resolver, empty means all types
+	QTypes    []string               `yaml:"qtypes"`
 	DnsTtl    int                    `yaml:"dns_ttl"`
 	Enable    bool                   `yaml:"enable"`
 	Option    map[string]interface{} `yaml:"option"`
 	Namespace string                 `yaml:"-"`
 }
 
+var (
+	// ErrNotMine the name is not owned by the resolver, the query is passed to the next route
+	ErrNotMine = errors.New("name not owned by resolver")
+	// ErrNameNotFound the resolver owns the name but it does not exist, the query is answered NXDOMAIN
+	ErrNameNotFound = errors.New("name not found")
+)
+
 // NamingResolver resolver interface
 type NamingResolver interface {
 	// Name will return the name to resolver
@@ -66,8 +94,11 @@ type NamingResolver interface {
 	Start(context.Context)
 	// Destroy will destroy the resolver on shutdown
 	Destroy()
-	// ServeDNS is like dns.Handler except ServeDNS may return an response or nil
-	ServeDNS(context.Context, dns.Question, string) *dns.Msg
+	// ServeDNS is like dns.Handler except ServeDNS returns the response, ErrNotMine when the
+	// name is not owned by the resolver, ErrNameNotFound on an authoritative miss,
+	// or any other error when the resolve fails. A response returned with an error is answered
+	// to the client with the extended dns error of the error attached, e.g. the stale answer
+	ServeDNS(context.Context, dns.Question, string) (*dns.Msg, error)
 	// Debugger
 	Debugger() []debughttp.DebugHandler
 }
@@ -79,6 +110,16 @@ func Register(namingResolver NamingResolver) {
 	resolvers[namingResolver.Name()] = namingResolver
 }
 
+// ResolverNames returns the names of the registered resolvers in order
+func ResolverNames() []string {
+	names := make([]string, 0, len(resolvers))
+	for name := range resolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // NameResolver get the resolver by name
 func NameResolver(name string) NamingResolver {
 	return resolvers[name]
@@ -0,0 +1,98 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// route binds a resolver to one of the zones and the query types it owns
+type route struct {
+	zone     string
+	qtypes   map[uint16]struct{}
+	resolver NamingResolver
+}
+
+// accept checks whether the query type is owned by the route
+func (r *route) accept(qtype uint16) bool {
+	if len(r.qtypes) == 0 {
+		return true
+	}
+	_, ok := r.qtypes[qtype]
+	return ok
+}
+
+// match checks whether the name is under the zone of the route
+func (r *route) match(name string) bool {
+	if r.zone == Quota {
+		return true
+	}
+	name = strings.ToLower(dns.Fqdn(name))
+	return name == r.zone || strings.HasSuffix(name, Quota+r.zone)
+}
+
+// buildRoutes builds the routes for the resolvers, ordered by the zone length,
+// the routes with the same zone keep the order of the config entries
+func buildRoutes(entries []*ConfigEntry, handlers []NamingResolver) ([]*route, error) {
+	named := make(map[string]NamingResolver, len(handlers))
+	for _, handler := range handlers {
+		named[handler.Name()] = handler
+	}
+	var routes []*route
+	for _, entry := range entries {
+		handler, ok := named[entry.Name]
+		if !ok || !entry.Enable {
+			continue
+		}
+		qtypes := make(map[uint16]struct{}, len(entry.QTypes))
+		for _, qtype := range entry.QTypes {
+			value, ok := dns.StringToType[strings.ToUpper(qtype)]
+			if !ok {
+				return nil, fmt.Errorf("resolver %s config unknown qtype %s", entry.Name, qtype)
+			}
+			qtypes[value] = struct{}{}
+		}
+		for _, zone := range entryZones(entry) {
+			routes = append(routes, &route{zone: zone, qtypes: qtypes, resolver: handler})
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return dns.CountLabel(routes[i].zone) > dns.CountLabel(routes[j].zone)
+	})
+	return routes, nil
+}
+
+func entryZones(entry *ConfigEntry) []string {
+	zones := entry.Zones
+	if len(zones) == 0 {
+		zones = []string{entry.Suffix}
+	}
+	ret := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		zone = strings.ToLower(strings.TrimSpace(zone))
+		if len(zone) == 0 {
+			zone = Quota
+		}
+		ret = append(ret, dns.Fqdn(zone))
+	}
+	return ret
+}
@@ -19,14 +19,16 @@ package resolver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+
 	debughttp "github.com/polarismesh/polaris-sidecar/pkg/http"
 	"github.com/polarismesh/polaris-sidecar/pkg/log"
 )
@@ -43,28 +45,19 @@ func IsFile(path string) bool {
 	return !s.IsDir()
 }
 
-func parseResolvConf(bindLocalhost bool) ([]string, []string) {
-	if !IsFile(etcResolvConfPath) {
+func parseResolvConf(path string, bindLocalhost bool) ([]string, []string) {
+	if !IsFile(path) {
 		return nil, nil
 	}
-	dnsConfig, err := dns.ClientConfigFromFile(etcResolvConfPath)
+	content, err := os.ReadFile(path)
 	if err != nil {
-		log.Errorf("[agent] failed to load /etc/resolv.conf: %v", err)
+		log.Errorf("[agent] failed to load %s: %v", path, err)
 		return nil, nil
 	}
-	var searchNames []string
-	var nameservers []string
-	if dnsConfig != nil {
-		for _, search := range dnsConfig.Search {
-			searchNames = append(searchNames, search+".")
-		}
-
-		for _, server := range dnsConfig.Servers {
-			if server == "127.0.0.1" && bindLocalhost {
-				continue
-			}
-			nameservers = append(nameservers, server)
-		}
+	nameservers, searchNames, err := parseResolvConfContent(content, bindLocalhost)
+	if err != nil {
+		log.Errorf("[agent] failed to load %s: %v", path, err)
+		return nil, nil
 	}
 	return nameservers, searchNames
 }
@@ -93,47 +86,137 @@ func NewServers(conf *ResolverConfig) (*Server, error) {
 		resolvers = append(resolvers, handler)
 	}
 
-	nameservers, searchNames := parseResolvConf(conf.BindLocalhost)
-	log.Infof("[agent] finished to parse /etc/resolv.conf, nameservers %s, search %s", nameservers, searchNames)
-	if len(conf.Recurse.NameServers) == 0 {
-		conf.Recurse.NameServers = nameservers
-	}
-	recurseAddresses := make([]string, 0, len(conf.Recurse.NameServers))
-	for _, nameserver := range conf.Recurse.NameServers {
-		recurseAddresses = append(recurseAddresses, fmt.Sprintf("%s:53", nameserver))
-	}
-	udpServer := &dns.Server{
-		Addr: conf.BindIP + ":" + strconv.FormatUint(uint64(conf.BindPort), 10), Net: "udp",
-		Handler: buildDNSServer(
-			"udp",
-			resolvers,
-			searchNames,
-			time.Duration(conf.Recurse.TimeoutSec)*time.Second,
-			recurseAddresses,
-			conf.Recurse.Enable,
-		),
-	}
-	tcpServer := &dns.Server{
-		Addr: conf.BindIP + ":" + strconv.FormatUint(uint64(conf.BindPort), 10), Net: "tcp",
-		Handler: buildDNSServer(
-			"tcp",
-			resolvers,
-			searchNames,
-			time.Duration(conf.Recurse.TimeoutSec)*time.Second,
-			recurseAddresses,
-			conf.Recurse.Enable,
-		),
+	destroy := func() {
+		for _, initHandler := range resolvers {
+			initHandler.Destroy()
+		}
+	}
+	listeners := conf.Listeners
+	if len(listeners) == 0 {
+		listeners = []*ListenerConfig{{Name: "default", Bind: conf.BindIP, Port: int(conf.BindPort)}}
+	}
+	protection := conf.Protection
+	if protection == nil {
+		protection = DefaultProtectionConfig()
+	}
+	listen := conf.Listen
+	if listen == nil {
+		listen = DefaultListenConfig()
+	}
+	resolve := conf.Resolve
+	if resolve == nil {
+		resolve = DefaultResolveConfig()
+	}
+	queryGuard, err := newGuard(protection)
+	if err == nil {
+		err = listen.Verify()
+	}
+	if err == nil {
+		err = resolve.Verify()
+	}
+	if err == nil {
+		err = VerifyListeners(listeners, conf.Resolvers)
+	}
+	if err != nil {
+		destroy()
+		return nil, err
+	}
+
+	resolvConfPath := conf.ResolvConfPath
+	if len(resolvConfPath) == 0 {
+		resolvConfPath = etcResolvConfPath
+	}
+	nameservers, searchNames := parseResolvConf(resolvConfPath, conf.BindLocalhost)
+	log.Infof("[agent] finished to parse %s, nameservers %s, search %s", resolvConfPath, nameservers, searchNames)
+	holder := &upstreamHolder{}
+	resolvConf := newResolvConfWatcher(resolvConfPath, conf.BindLocalhost, conf.Recurse, holder)
+	resolvConf.init(nameservers, searchNames)
+	recurseTimeout := time.Duration(conf.Recurse.TimeoutSec) * time.Second
+	var validator *dnssecValidator
+	if conf.Recurse.Enable && conf.Recurse.DNSSEC != nil && conf.Recurse.DNSSEC.Enable {
+		recursor := buildDNSServer("udp", nil, nil, recurseTimeout, nil, true)
+		recursor.upstream = holder
+		if validator, err = newDNSSECValidator(conf.Recurse.DNSSEC, recursor.exchange); err != nil {
+			destroy()
+			return nil, err
+		}
+		log.Infof("[agent] dnssec validation of the recursion is enabled")
+	}
+
+	var dnsSvrs []*dns.Server
+	var handlers []*listenerHandler
+	for _, listener := range listeners {
+		routes, err := buildRoutes(listenerEntries(listener, conf.Resolvers), resolvers)
+		if err != nil {
+			destroy()
+			return nil, err
+		}
+		var udpHandler, tcpHandler dns.Handler
+		// inspected the handler used by the dry-run lookup of the admin api
+		var inspected *dnsServer
+		for _, protocol := range []string{protocolUDP, protocolTCP} {
+			if !listener.serves(protocol) {
+				continue
+			}
+			handler := buildDNSServer(protocol, routes, nil, recurseTimeout, nil, conf.Recurse.Enable)
+			handler.upstream = holder
+			handler.validator = validator
+			handler.guard = queryGuard
+			handler.maxUDPSize = uint16(listen.MaxUDPSize)
+			handler.resolveTimeout = resolve.timeout()
+			handler.parallel = resolve.Parallel
+			if inspected == nil {
+				inspected = handler
+			}
+			if protocol == protocolUDP {
+				udpHandler = handler
+			} else {
+				tcpHandler = handler
+			}
+		}
+		handlers = append(handlers, &listenerHandler{name: listener.Name, address: listener.Address(),
+			handler: inspected})
+		log.Infof("[agent] dns listener %s on %s, protocols %v, resolvers %v",
+			listener.Name, listener.Address(), listener.Protocols, listener.Resolvers)
+		dnsSvrs = append(dnsSvrs, newDNSServers(listener.Address(), listen, udpHandler, tcpHandler)...)
 	}
 
 	return &Server{
-		dnsSvrs:   []*dns.Server{udpServer, tcpServer},
-		resolvers: resolvers,
+		dnsSvrs:           dnsSvrs,
+		resolvers:         resolvers,
+		listen:            listen,
+		maxTCPConnections: protection.MaxTCPConnections,
+		resolvConf:        resolvConf,
+		handlers:          handlers,
+		validator:         validator,
 	}, nil
 }
 
 type Server struct {
-	dnsSvrs   []*dns.Server
-	resolvers []NamingResolver
+	dnsSvrs           []*dns.Server
+	resolvers         []NamingResolver
+	listen            *ListenConfig
+	maxTCPConnections int
+	resolvConf        *resolvConfWatcher
+	// handlers the handler of each listener, used by the admin api
+	handlers  []*listenerHandler
+	validator *dnssecValidator
+}
+
+// MetricsCollector is implemented by the resolvers exposing the metrics
+type MetricsCollector interface {
+	Collectors() []prometheus.Collector
+}
+
+// Collectors returns the metrics of the resolvers, which are served by the metric server
+func (svr *Server) Collectors() []prometheus.Collector {
+	var collectors []prometheus.Collector
+	for _, handler := range svr.resolvers {
+		if collector, ok := handler.(MetricsCollector); ok {
+			collectors = append(collectors, collector.Collectors()...)
+		}
+	}
+	return collectors
 }
 
 func (svr *Server) Run(ctx context.Context) <-chan error {
@@ -141,16 +224,33 @@ func (svr *Server) Run(ctx context.Context) <-chan error {
 		handler.Start(ctx)
 		log.Infof("[agent] success to start resolver %s", handler.Name())
 	}
+	if svr.resolvConf.needed() {
+		go svr.resolvConf.run(ctx)
+	}
 	errChan := make(chan error)
 	for i := range svr.dnsSvrs {
 		go func(dnsSvr *dns.Server) {
 			log.Infof("[agent] success to start dns server %s %s", dnsSvr.Addr, dnsSvr.Net)
-			errChan <- dnsSvr.ListenAndServe()
+			errChan <- svr.serve(dnsSvr)
 		}(svr.dnsSvrs[i])
 	}
 	return errChan
 }
 
+// serve listens and serves the dns server, the tcp connections are capped by maxTCPConnections
+func (svr *Server) serve(dnsSvr *dns.Server) error {
+	var err error
+	if dnsSvr.Net == "tcp" {
+		dnsSvr.Listener, err = listenTCP(dnsSvr, svr.listen, svr.maxTCPConnections)
+	} else {
+		dnsSvr.PacketConn, err = listenUDP(dnsSvr, svr.listen)
+	}
+	if nil != err {
+		return err
+	}
+	return dnsSvr.ActivateAndServe()
+}
+
 func (svr *Server) Debugger() []debughttp.DebugHandler {
 	ret := make([]debughttp.DebugHandler, 0, 8)
 	for i := range svr.resolvers {
@@ -159,6 +259,40 @@ func (svr *Server) Debugger() []debughttp.DebugHandler {
 	return ret
 }
 
+// UpdateUpstreams replaces the recursion nameservers and search names set in config,
+// the ones of the resolv.conf are used when empty
+func (svr *Server) UpdateUpstreams(nameservers []string, searchNames []string) {
+	svr.resolvConf.override(nameservers, searchNames)
+}
+
+// UpdateOptions applies the changed options of the running resolvers which support it, the entries
+// of the resolvers not running are ignored
+func (svr *Server) UpdateOptions(entries []*ConfigEntry) error {
+	var errs []string
+	for _, entry := range entries {
+		for _, handler := range svr.resolvers {
+			if handler.Name() != entry.Name {
+				continue
+			}
+			updater, ok := handler.(OptionsUpdater)
+			if !ok {
+				continue
+			}
+			options, err := ParseOptions(handler, entry.Option)
+			if err == nil {
+				err = updater.UpdateOptions(options)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("resolver %s: %v", entry.Name, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 func (svr *Server) Destroy() error {
 	for _, handler := range svr.resolvers {
 		handler.Destroy()
@@ -167,39 +301,47 @@ func (svr *Server) Destroy() error {
 }
 
 func buildDNSServer(protocol string,
-	resolvers []NamingResolver,
+	routes []*route,
 	searchNames []string,
 	recursorTimeout time.Duration,
 	recursors []string,
 	recurseEnable bool) *dnsServer {
 	return &dnsServer{
 		protocol:        protocol,
-		resolvers:       resolvers,
-		searchNames:     searchNames,
+		routes:          routes,
+		upstream:        newUpstreamHolder(recursors, searchNames),
 		recursorTimeout: recursorTimeout,
-		recursors:       recursors,
 		recurseEnable:   recurseEnable,
+		maxUDPSize:      defaultMaxUDPSize,
 	}
 }
 
 type dnsServer struct {
-	protocol        string
-	resolvers       []NamingResolver
-	searchNames     []string
+	protocol string
+	routes   []*route
+	// upstream the recursors and the search names, swapped when the resolv.conf changes
+	upstream        *upstreamHolder
 	recursorTimeout time.Duration
-	recursors       []string
 	recurseEnable   bool
+	validator       *dnssecValidator
+	guard           *guard
+	// maxUDPSize the udp payload size advertised in EDNS
+	maxUDPSize uint16
+	// resolveTimeout the deadline of the query across the resolvers, 0 means no deadline
+	resolveTimeout time.Duration
+	parallel       bool
 }
 
 func (d *dnsServer) Preprocess(qname string) string {
-	if len(d.searchNames) == 0 {
+	searchNames := d.upstream.load().searchNames
+	if len(searchNames) == 0 {
 		return qname
 	}
 
 	var matched bool
 
 	for {
-		for _, searchName := range d.searchNames {
+		for _, searchName := range searchNames {
 			if strings.HasSuffix(qname, searchName) {
 				matched = true
 				qname = qname[:len(qname)-len(searchName)]
@@ -215,28 +357,35 @@ func (d *dnsServer) Preprocess(qname string) string {
 	return qname
 }
 
-func (d *dnsServer) sendDnsCode(w dns.ResponseWriter, r *dns.Msg, code int) {
+// sendDnsError answers the rcode and the extended dns error of the error,
+// the rcode is SERVFAIL if the error is not an ExtendedError
+func (d *dnsServer) sendDnsError(w dns.ResponseWriter, r *dns.Msg, err error) {
+	extendedErr := toExtendedError(err, dns.RcodeServerFailure)
 	msg := &dns.Msg{}
 	msg.SetReply(r)
 	msg.RecursionDesired = true
 	msg.RecursionAvailable = true
-	msg.Rcode = code
-	msg.Truncate(size(d.protocol, r))
+	msg.Rcode = extendedErr.Rcode
+	msg.Truncate(size(d.protocol, r, d.maxUDPSize))
 	if edns := r.IsEdns0(); edns != nil {
-		setEDNS(r, msg, true)
+		setEDNS(r, msg, true, d.maxUDPSize)
 	}
-	err := w.WriteMsg(msg)
-	if nil != err {
+	setExtendedError(msg, extendedErr)
+	if err := w.WriteMsg(msg); nil != err {
 		log.Errorf("[agent] fail to write dns response message, err: %v", err)
 	}
 }
 
-func (d *dnsServer) sendDnsResponse(w dns.ResponseWriter, r *dns.Msg, msg *dns.Msg) {
+func (d *dnsServer) sendDnsResponse(w dns.ResponseWriter, r *dns.Msg, msg *dns.Msg, extendedErr *ExtendedError) {
+	// SetReply resets the rcode, keep the one answered by the resolver
+	rcode := msg.Rcode
 	msg.SetReply(r)
-	msg.Truncate(size(d.protocol, r))
+	msg.Rcode = rcode
+	msg.Truncate(size(d.protocol, r, d.maxUDPSize))
 	if edns := r.IsEdns0(); edns != nil {
-		setEDNS(r, msg, true)
+		setEDNS(r, msg, true, d.maxUDPSize)
 	}
+	setExtendedError(msg, extendedErr)
 	err := w.WriteMsg(msg)
 	if nil != err {
 		log.Errorf("[agent] fail to write dns response message, err: %v", err)
@@ -245,29 +394,166 @@ func (d *dnsServer) sendDnsResponse(w dns.ResponseWriter, r *dns.Msg, msg *dns.M
 
 // ServeDNS handler callback
 func (d *dnsServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
-	// questions length is 0, send refused
-	if len(req.Question) == 0 {
-		d.sendDnsCode(w, req, dns.RcodeRefused)
+	// never answer a response, it may loop between the servers
+	if req.Response {
+		return
+	}
+	if d.guard != nil && !d.protect(w, req) {
+		return
+	}
+	if err := validateRequest(req); err != nil {
+		log.Debugf("[agent] invalid request %v, err: %v", req, err)
+		d.sendDnsError(w, req, err)
+		return
 	}
-	// questions type we only accept
 	question := req.Question[0]
+	if question.Qclass == dns.ClassCHAOS {
+		d.serveChaos(w, req, question)
+		return
+	}
+	if question.Qtype == dns.TypeANY {
+		resp := &dns.Msg{}
+		resp.Answer = anyAnswer(question)
+		d.sendDnsResponse(w, req, resp, nil)
+		return
+	}
 	qname := d.Preprocess(question.Name)
 	log.Infof("[agent] input question name %s, after Preprocess name %s", question.Name, qname)
-	ctx := context.WithValue(context.Background(), ContextProtocol, d.protocol)
-	var resp *dns.Msg
-	for _, handler := range d.resolvers {
-		resp = handler.ServeDNS(ctx, question, qname)
-		if nil != resp {
-			log.Infof("[agent] request %v, response for %s is %v", req, question.Name, resp)
-			d.sendDnsResponse(w, req, resp)
-			return
+	ctx, cancel := d.queryContext(context.WithValue(context.Background(), ContextProtocol, d.protocol))
+	defer cancel()
+	rt, resp, err := d.resolve(ctx, question, qname, nil)
+	if rt == nil {
+		d.handleRecurse(ctx, w, req, err)
+		return
+	}
+	switch {
+	case resp != nil && err != nil:
+		// the resolver answers with a degraded response, such as the stale answer
+		log.Warnf("[agent] resolver %s answers %s with degraded response, reason: %v",
+			rt.resolver.Name(), question.Name, err)
+		d.sendDnsResponse(w, req, resp, toExtendedError(err, resp.Rcode))
+	case errors.Is(err, ErrNameNotFound):
+		log.Infof("[agent] name %s not found by resolver %s, reason: %v", question.Name, rt.resolver.Name(), err)
+		resp = &dns.Msg{}
+		resp.Authoritative = true
+		resp.Rcode = dns.RcodeNameError
+		var extendedErr *ExtendedError
+		if err != ErrNameNotFound {
+			extendedErr = toExtendedError(err, dns.RcodeNameError)
+		}
+		d.sendDnsResponse(w, req, resp, extendedErr)
+	case err != nil:
+		log.Errorf("[agent] resolver %s fail to resolve %s, err: %v", rt.resolver.Name(), question.Name, err)
+		d.sendDnsError(w, req, err)
+	default:
+		log.Infof("[agent] request %v, response for %s from %s is %v", req, question.Name, rt.resolver.Name(), resp)
+		d.sendDnsResponse(w, req, resp, nil)
+	}
+}
+
+// queryContext returns the context bounded by the resolve timeout, which is shared by the resolvers
+// and the recursion of the query
+func (d *dnsServer) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.resolveTimeout > 0 {
+		return context.WithTimeout(ctx, d.resolveTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// resolve routes the question to the resolvers in order, returns the route answering the name
+// with the response and the error of its resolver. The route is nil when no resolver answers
+// the name, the error then keeps the reason. visit is called with every resolver consulted.
+// The resolvers share the deadline of the query context, and are called at the same time in parallel mode
+func (d *dnsServer) resolve(ctx context.Context, question dns.Question, qname string,
+	visit func(rt *route, resp *dns.Msg, err error)) (*route, *dns.Msg, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// the resolvers left behind in parallel mode are cancelled as well
+	defer cancel()
+	var routes []*route
+	for _, rt := range d.routes {
+		if rt.accept(question.Qtype) && (rt.match(question.Name) || rt.match(qname)) {
+			routes = append(routes, rt)
+		}
+	}
+	pending := make([]<-chan *resolveResult, len(routes))
+	if d.parallel {
+		for i, rt := range routes {
+			pending[i] = serve(ctx, rt, question, qname)
+		}
+	}
+	var missErr error
+	for i, rt := range routes {
+		var result *resolveResult
+		switch {
+		case pending[i] != nil:
+			result = wait(ctx, rt, pending[i])
+		case d.resolveTimeout > 0:
+			result = wait(ctx, rt, serve(ctx, rt, question, qname))
+		default:
+			result = &resolveResult{}
+			result.resp, result.err = rt.resolver.ServeDNS(ctx, question, qname)
+		}
+		resp, err := result.resp, result.err
+		if visit != nil {
+			visit(rt, resp, err)
+		}
+		if resp == nil && (err == nil || errors.Is(err, ErrNotMine)) {
+			if err != nil && err != ErrNotMine {
+				missErr = err
+			}
+			continue
+		}
+		return rt, resp, err
+	}
+	return nil, nil, missErr
+}
+
+// protect applies the allow-list and the rate limits to the query, returns false when
+// the query should not be served
+func (d *dnsServer) protect(w dns.ResponseWriter, req *dns.Msg) bool {
+	switch d.guard.check(w.RemoteAddr(), d.protocol) {
+	case limitDeny:
+		log.Debugf("[agent] client %s not allowed to query", w.RemoteAddr())
+		d.sendDnsError(w, req, NewExtendedError(dns.RcodeRefused, dns.ExtendedErrorCodeProhibited,
+			"client not allowed"))
+		return false
+	case limitRefuse:
+		log.Debugf("[agent] query from client %s is rate limited", w.RemoteAddr())
+		d.sendDnsError(w, req, NewExtendedError(dns.RcodeRefused, dns.ExtendedErrorCodeOther, "rate limited"))
+		return false
+	case limitTruncate:
+		log.Debugf("[agent] query from client %s is rate limited, answer truncated", w.RemoteAddr())
+		msg := &dns.Msg{}
+		msg.SetReply(req)
+		msg.Truncated = true
+		if err := w.WriteMsg(msg); nil != err {
+			log.Errorf("[agent] fail to write dns response message, err: %v", err)
 		}
+		return false
+	case limitDrop:
+		log.Debugf("[agent] query from client %s is rate limited, dropped", w.RemoteAddr())
+		return false
+	}
+	return true
+}
+
+// serveChaos answers the CHAOS class queries such as version.bind and id.server
+func (d *dnsServer) serveChaos(w dns.ResponseWriter, req *dns.Msg, question dns.Question) {
+	answers := chaosAnswer(question)
+	if len(answers) == 0 {
+		d.sendDnsError(w, req, NewExtendedError(dns.RcodeRefused, dns.ExtendedErrorCodeNotSupported,
+			"chaos query %s not supported", question.Name))
+		return
 	}
-	d.handleRecurse(w, req)
+	resp := &dns.Msg{}
+	resp.Authoritative = true
+	resp.Answer = answers
+	d.sendDnsResponse(w, req, resp, nil)
 }
 
-// handleRecurse is used to handle recursive DNS queries
-func (d *dnsServer) handleRecurse(resp dns.ResponseWriter, req *dns.Msg) {
+// handleRecurse is used to handle recursive DNS queries, missErr is the reason why the
+// name is not answered by the resolvers. The recursors share the deadline of the query context
+func (d *dnsServer) handleRecurse(ctx context.Context, resp dns.ResponseWriter, req *dns.Msg, missErr error) {
 	q := req.Question[0]
 	network := "udp"
 	defer func(s time.Time) {
@@ -280,48 +566,192 @@ func (d *dnsServer) handleRecurse(resp dns.ResponseWriter, req *dns.Msg) {
 	if _, ok := resp.RemoteAddr().(*net.TCPAddr); ok {
 		network = "tcp"
 	}
-	if d.recurseEnable {
-		// Recursively resolve
-		c := &dns.Client{Net: network, Timeout: d.recursorTimeout}
-		var r *dns.Msg
-		var rtt time.Duration
+	if !d.recurseEnable {
+		reason := "no resolver answers the name"
+		if missErr != nil {
+			reason = missErr.Error()
+		}
+		d.sendDnsError(resp, req, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNotAuthoritative,
+			"%s, recursion disabled", reason))
+		return
+	}
+	if d.guard != nil {
+		if !d.guard.acquireRecurse() {
+			d.sendDnsError(resp, req, NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeOther,
+				"too many concurrent recursive queries"))
+			return
+		}
+		defer d.guard.releaseRecurse()
+	}
+	// Recursively resolve
+	c := &dns.Client{Net: network, Timeout: d.recursorTimeout}
+	forward := d.forwardRequest(req)
+	var r *dns.Msg
+	var rtt time.Duration
+	var err error
+	var timeouts int
+	var lastErr error
+	recursors := d.upstream.load().recursors
+	for _, recursor := range recursors {
+		if ctx.Err() != nil {
+			break
+		}
+		r, rtt, err = c.ExchangeContext(ctx, forward, recursor)
+		// Check if the response is valid and has the desired Response code
+		if r != nil && (r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError) {
+			log.Warnf("[agent] recurse failed for question, question: %s, rtt: %s, recursor: %s, rcode: %s",
+				q.String(), rtt, recursor, dns.RcodeToString[r.Rcode])
+			lastErr = fmt.Errorf("recursor %s answered %s", recursor, dns.RcodeToString[r.Rcode])
+			// If we still have recursors to forward the query to,
+			// we move forward onto the next one else the loop ends
+			continue
+		} else if err == nil || (r != nil && r.Truncated) {
+			// Forward the response
+			log.Debugf("[agent] recurse succeeded for question, question: %s, rtt: %s, recursor: %s",
+				q.String(), rtt, recursor)
+			if err := d.finishRecurse(ctx, req, r); err != nil {
+				log.Errorf("[agent] dnssec validation failed for question, question: %s, recursor: %s, err: %v",
+					q.String(), recursor, err)
+				d.sendDnsError(resp, req, err)
+				return
+			}
+			// the answer sized for the forwarded request may exceed the buffer of the client
+			r.Truncate(size(d.protocol, req, d.maxUDPSize))
+			if err := resp.WriteMsg(r); err != nil {
+				log.Warnf("failed to respond, error: %v", err)
+			}
+			return
+		}
+		log.Errorf("[agent] recurse failed, error: %v", err)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			timeouts++
+		}
+		lastErr = err
+	}
+
+	// If all resolvers fail, return a SERVFAIL message
+	log.Errorf(
+		"[agent] all resolvers failed for question from client, question: %s, client: %s, client_network: %s",
+		q.String(), resp.RemoteAddr().String(), resp.RemoteAddr().Network())
+	var recurseErr *ExtendedError
+	switch {
+	case len(recursors) == 0:
+		recurseErr = NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNoReachableAuthority,
+			"no recursor configured")
+	case timeouts == len(recursors):
+		recurseErr = NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNoReachableAuthority,
+			"all recursors timed out")
+	case ctx.Err() != nil:
+		recurseErr = NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNoReachableAuthority,
+			"recursion timed out, last error: %v", lastErr)
+	default:
+		recurseErr = NewExtendedError(dns.RcodeServerFailure, dns.ExtendedErrorCodeNetworkError,
+			"all recursors failed, last error: %v", lastErr)
+	}
+	d.sendDnsError(resp, req, recurseErr)
+}
+
+// forwardRequest returns the request forwarded to the recursors, the DO bit is set
+// to receive the signatures when the answers are validated
+func (d *dnsServer) forwardRequest(req *dns.Msg) *dns.Msg {
+	if d.validator == nil {
+		return req
+	}
+	forward := req.Copy()
+	if opt := forward.IsEdns0(); opt != nil {
+		opt.SetDo()
+	} else {
+		forward.SetEdns0(dns.DefaultMsgSize, true)
+	}
+	return forward
+}
+
+// finishRecurse validates the answer of the recursors, and applies the DO, CD and AD
+// semantics of the client request to the answer. The OPT record added by forwardRequest
+// is removed when the client sent none
+func (d *dnsServer) finishRecurse(ctx context.Context, req *dns.Msg, resp *dns.Msg) error {
+	clientOpt := req.IsEdns0()
+	clientDo := clientOpt != nil && clientOpt.Do()
+	if d.validator == nil {
+		// AD is only set for the clients which understand it, RFC 6840 section 5.7
+		if !clientDo && !req.AuthenticatedData {
+			resp.AuthenticatedData = false
+		}
+		return nil
+	}
+	secure := false
+	// the truncated answer is incomplete to validate, it is passed on for the client to retry over tcp
+	if !req.CheckingDisabled && !resp.Truncated {
 		var err error
-		for _, recursor := range d.recursors {
-			r, rtt, err = c.Exchange(req, recursor)
-			// Check if the response is valid and has the desired Response code
-			if r != nil && (r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError) {
-				log.Warnf("[agent] recurse failed for question, question: %s, rtt: %s, recursor: %s, rcode: %s",
-					q.String(), rtt, recursor, dns.RcodeToString[r.Rcode])
-				// If we still have recursors to forward the query to,
-				// we move forward onto the next one else the loop ends
-				continue
-			} else if err == nil || (r != nil && r.Truncated) {
-				// Forward the response
-				log.Debugf("[agent] recurse succeeded for question, question: %s, rtt: %s, recursor: %s",
-					q.String(), rtt, recursor)
-				if err := resp.WriteMsg(r); err != nil {
-					log.Warnf("failed to respond, error: %v", err)
+		if secure, err = d.validator.validate(ctx, resp); err != nil {
+			return err
+		}
+	}
+	resp.AuthenticatedData = secure && (clientDo || req.AuthenticatedData)
+	if !clientDo {
+		qtype := req.Question[0].Qtype
+		filter := func(records []dns.RR) []dns.RR {
+			ret := records[:0]
+			for _, rr := range records {
+				if isDNSSECRecord(rr) && rr.Header().Rrtype != qtype {
+					continue
 				}
-				return
+				ret = append(ret, rr)
 			}
-			log.Errorf("[agent] recurse failed, error: %v", err)
+			return ret
 		}
+		resp.Answer = filter(resp.Answer)
+		resp.Ns = filter(resp.Ns)
+		resp.Extra = filter(resp.Extra)
+	}
+	if clientOpt == nil {
+		extra := resp.Extra[:0]
+		for _, rr := range resp.Extra {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				extra = append(extra, rr)
+			}
+		}
+		resp.Extra = extra
+	} else if opt := resp.IsEdns0(); opt != nil {
+		opt.SetDo(clientDo)
+	}
+	return nil
+}
 
-		// If all resolvers fail, return a SERVFAIL message
-		log.Errorf(
-			"[agent] all resolvers failed for question from client, question: %s, client: %s, client_network: %s",
-			q.String(), resp.RemoteAddr().String(), resp.RemoteAddr().Network())
+// exchange sends the request to the recursors in order, and switches to tcp
+// when the answer is truncated
+func (d *dnsServer) exchange(ctx context.Context, req *dns.Msg) (*dns.Msg, error) {
+	var lastErr error = errors.New("no recursor available")
+	for _, recursor := range d.upstream.load().recursors {
+		c := &dns.Client{Net: "udp", Timeout: d.recursorTimeout}
+		r, _, err := c.ExchangeContext(ctx, req, recursor)
+		if err == nil && r.Truncated {
+			c.Net = "tcp"
+			r, _, err = c.ExchangeContext(ctx, req, recursor)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+			lastErr = fmt.Errorf("recursor %s answers %s", recursor, dns.RcodeToString[r.Rcode])
+			continue
+		}
+		return r, nil
 	}
-	d.sendDnsCode(resp, req, dns.RcodeServerFailure)
+	return nil, lastErr
 }
 
-// Size returns if buffer size *advertised* in the requests OPT record.
+// Size returns if buffer size *advertised* in the requests OPT record, which is capped by maxUDPSize.
 // Or when the request was over TCP, we return the maximum allowed size of 64K.
-func size(proto string, r *dns.Msg) int {
+func size(proto string, r *dns.Msg, maxUDPSize uint16) int {
 	size := uint16(0)
 	if o := r.IsEdns0(); o != nil {
 		size = o.UDPSize()
 	}
+	if size > maxUDPSize {
+		size = maxUDPSize
+	}
 
 	// normalize size
 	size = ednsSize(proto, size)
@@ -359,7 +789,7 @@ func ednsSubnetForRequest(req *dns.Msg) *dns.EDNS0_SUBNET {
 // setEDNS is used to set the responses EDNS size headers and
 // possibly the ECS headers as well if they were present in the
 // original request
-func setEDNS(request *dns.Msg, response *dns.Msg, ecsGlobal bool) {
+func setEDNS(request *dns.Msg, response *dns.Msg, ecsGlobal bool, udpSize uint16) {
 	edns := request.IsEdns0()
 	if edns == nil {
 		return
@@ -370,7 +800,12 @@ func setEDNS(request *dns.Msg, response *dns.Msg, ecsGlobal bool) {
 	ednsResp := new(dns.OPT)
 	ednsResp.Hdr.Name = "."
 	ednsResp.Hdr.Rrtype = dns.TypeOPT
-	ednsResp.SetUDPSize(edns.UDPSize())
+	// advertise the payload size of the sidecar, RFC 6891 section 6.2.5
+	ednsResp.SetUDPSize(udpSize)
+	// keep the DNSSEC OK bit of the request, RFC 3225
+	if edns.Do() {
+		ednsResp.SetDo()
+	}
 
 	// Setup the ECS option if present
 	if subnet := ednsSubnetForRequest(request); subnet != nil {
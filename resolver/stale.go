@@ -0,0 +1,198 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const staleSnapshotVersion = 1
+
+// StaleCache keeps the last good answer of each question, which is served as the RFC 8767
+// stale answer when the resolver fails to lookup the name
+type StaleCache struct {
+	maxAge   time.Duration
+	staleTtl uint32
+
+	lock    sync.RWMutex
+	entries map[string]*staleEntry
+}
+
+type staleEntry struct {
+	Name     string    `json:"name"`
+	Qtype    uint16    `json:"qtype"`
+	Msg      []byte    `json:"msg"`
+	StoredAt time.Time `json:"stored_at"`
+}
+
+type staleSnapshot struct {
+	Version   int           `json:"version"`
+	Timestamp time.Time     `json:"timestamp"`
+	Entries   []*staleEntry `json:"entries"`
+}
+
+// NewStaleCache creates the stale cache, the answers older than maxAge are not served,
+// the stale answers are served with the staleTtl
+func NewStaleCache(maxAge time.Duration, staleTtl uint32) *StaleCache {
+	return &StaleCache{
+		maxAge:   maxAge,
+		staleTtl: staleTtl,
+		entries:  make(map[string]*staleEntry),
+	}
+}
+
+func staleKey(name string, qtype uint16) string {
+	return strings.ToLower(name) + "/" + dns.Type(qtype).String()
+}
+
+// Store keeps the answer of the question
+func (c *StaleCache) Store(question dns.Question, msg *dns.Msg) {
+	packed, err := msg.Pack()
+	if nil != err {
+		return
+	}
+	entry := &staleEntry{Name: question.Name, Qtype: question.Qtype, Msg: packed, StoredAt: time.Now()}
+	c.lock.Lock()
+	c.entries[staleKey(question.Name, question.Qtype)] = entry
+	c.lock.Unlock()
+}
+
+// Load returns the stale answer of the question, the ttl of the records is set to the stale ttl
+func (c *StaleCache) Load(question dns.Question) (*dns.Msg, bool) {
+	c.lock.RLock()
+	entry, ok := c.entries[staleKey(question.Name, question.Qtype)]
+	c.lock.RUnlock()
+	if !ok || time.Since(entry.StoredAt) > c.maxAge {
+		return nil, false
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(entry.Msg); nil != err {
+		return nil, false
+	}
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			if rr.Header().Ttl > c.staleTtl {
+				rr.Header().Ttl = c.staleTtl
+			}
+		}
+	}
+	return msg, true
+}
+
+// Prune removes the answers older than the max age
+func (c *StaleCache) Prune() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, entry := range c.entries {
+		if time.Since(entry.StoredAt) > c.maxAge {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Flush removes all the answers, returns the count of the removed answers
+func (c *StaleCache) Flush() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	count := len(c.entries)
+	c.entries = make(map[string]*staleEntry)
+	return count
+}
+
+// Len returns the count of the answers
+func (c *StaleCache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.entries)
+}
+
+// Save writes the answers to the snapshot file, the file is replaced atomically
+func (c *StaleCache) Save(path string) error {
+	snapshot := &staleSnapshot{Version: staleSnapshotVersion, Timestamp: time.Now()}
+	c.lock.RLock()
+	for _, entry := range c.entries {
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+	c.lock.RUnlock()
+	data, err := json.Marshal(snapshot)
+	if nil != err {
+		return err
+	}
+	return WriteFileAtomic(path, data)
+}
+
+// Restore loads the answers from the snapshot file, the answers older than the max age are skipped
+func (c *StaleCache) Restore(path string) error {
+	data, err := os.ReadFile(path)
+	if nil != err {
+		return err
+	}
+	snapshot := &staleSnapshot{}
+	if err := json.Unmarshal(data, snapshot); nil != err {
+		return fmt.Errorf("fail to parse stale snapshot %s, err: %v", path, err)
+	}
+	if snapshot.Version != staleSnapshotVersion {
+		return fmt.Errorf("unsupported stale snapshot version %d", snapshot.Version)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, entry := range snapshot.Entries {
+		if time.Since(entry.StoredAt) > c.maxAge {
+			continue
+		}
+		key := staleKey(entry.Name, entry.Qtype)
+		if exist, ok := c.entries[key]; ok && exist.StoredAt.After(entry.StoredAt) {
+			continue
+		}
+		c.entries[key] = entry
+	}
+	return nil
+}
+
+// WriteFileAtomic writes the data to a temporary file and renames it to the path,
+// so that the readers never see a partial file
+func WriteFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); nil != err {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if nil != err {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); nil != err {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); nil != err {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); nil != err {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,57 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleCache(t *testing.T) {
+	question := dns.Question{Name: "foo.default.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	msg := &dns.Msg{}
+	rr, err := dns.NewRR("foo.default. 300 IN A 10.0.0.1")
+	assert.NoError(t, err)
+	msg.Answer = []dns.RR{rr}
+
+	cache := NewStaleCache(time.Hour, 30)
+	_, ok := cache.Load(question)
+	assert.False(t, ok)
+	cache.Store(question, msg)
+
+	question.Name = "FOO.default."
+	stale, ok := cache.Load(question)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(30), stale.Answer[0].Header().Ttl)
+	assert.Equal(t, uint32(300), msg.Answer[0].Header().Ttl)
+
+	path := filepath.Join(t.TempDir(), "stale", "snapshot.json")
+	assert.NoError(t, cache.Save(path))
+	restored := NewStaleCache(time.Hour, 30)
+	assert.NoError(t, restored.Restore(path))
+	_, ok = restored.Load(question)
+	assert.True(t, ok)
+
+	expired := NewStaleCache(-time.Second, 30)
+	assert.NoError(t, expired.Restore(path))
+	assert.Equal(t, 0, expired.Len())
+}
@@ -0,0 +1,201 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/pkg/watch"
+)
+
+const defaultResolvConfWatchInterval = 5 * time.Second
+
+// upstreams the recursors and the search names, shared by the dns servers and
+// swapped as a whole when the resolv.conf changes
+type upstreams struct {
+	recursors   []string
+	searchNames []string
+}
+
+// upstreamHolder holds the current upstreams
+type upstreamHolder struct {
+	value atomic.Value
+}
+
+func newUpstreamHolder(recursors []string, searchNames []string) *upstreamHolder {
+	h := &upstreamHolder{}
+	h.store(&upstreams{recursors: recursors, searchNames: searchNames})
+	return h
+}
+
+func (h *upstreamHolder) load() *upstreams {
+	return h.value.Load().(*upstreams)
+}
+
+func (h *upstreamHolder) store(u *upstreams) {
+	h.value.Store(u)
+}
+
+// parseResolvConfContent returns the nameservers and the search names of the resolv.conf content,
+// the loopback nameserver is skipped when the sidecar listens on it
+func parseResolvConfContent(content []byte, bindLocalhost bool) ([]string, []string, error) {
+	dnsConfig, err := dns.ClientConfigFromReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, err
+	}
+	var searchNames []string
+	var nameservers []string
+	for _, search := range dnsConfig.Search {
+		searchNames = append(searchNames, dns.Fqdn(search))
+	}
+	for _, server := range dnsConfig.Servers {
+		if server == "127.0.0.1" && bindLocalhost {
+			continue
+		}
+		nameservers = append(nameservers, server)
+	}
+	return nameservers, searchNames, nil
+}
+
+func recursorAddresses(nameservers []string) []string {
+	addresses := make([]string, 0, len(nameservers))
+	for _, nameserver := range nameservers {
+		addresses = append(addresses, fmt.Sprintf("%s:53", nameserver))
+	}
+	return addresses
+}
+
+// resolvConfWatcher watches the resolv.conf and swaps the upstreams of the running dns servers,
+// the nameservers and the search names set in config take precedence over the file
+type resolvConfWatcher struct {
+	path          string
+	bindLocalhost bool
+	holder        *upstreamHolder
+	watcher       *watch.FileWatcher
+
+	lock        sync.Mutex
+	nameservers []string
+	searchNames []string
+	// fileNameservers and fileSearchNames the last ones read from the resolv.conf
+	fileNameservers []string
+	fileSearchNames []string
+	watching        bool
+}
+
+func newResolvConfWatcher(path string, bindLocalhost bool, recurse *RecurseConfig,
+	holder *upstreamHolder) *resolvConfWatcher {
+	interval := defaultResolvConfWatchInterval
+	if recurse.ResolvConfWatchIntervalSec > 0 {
+		interval = time.Duration(recurse.ResolvConfWatchIntervalSec) * time.Second
+	}
+	return &resolvConfWatcher{
+		path:          path,
+		bindLocalhost: bindLocalhost,
+		nameservers:   recurse.NameServers,
+		searchNames:   recurse.SearchNames,
+		holder:        holder,
+		watcher:       watch.NewFileWatcher(path, interval),
+	}
+}
+
+// needed returns false when both the nameservers and the search names are set in config
+func (w *resolvConfWatcher) needed() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return len(w.nameservers) == 0 || len(w.searchNames) == 0
+}
+
+// init stores the upstreams read from the resolv.conf on startup
+func (w *resolvConfWatcher) init(nameservers []string, searchNames []string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.fileNameservers, w.fileSearchNames = nameservers, searchNames
+	w.holder.store(w.upstreams(nameservers, searchNames))
+}
+
+// override replaces the nameservers and the search names set in config, the ones of the
+// resolv.conf are used again when they are cleared
+func (w *resolvConfWatcher) override(nameservers []string, searchNames []string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.nameservers, w.searchNames = nameservers, searchNames
+	if !w.watching {
+		// the resolv.conf is not watched when all the upstreams were set in config
+		w.fileNameservers, w.fileSearchNames = parseResolvConf(w.path, w.bindLocalhost)
+	}
+	w.swap(w.upstreams(w.fileNameservers, w.fileSearchNames), "config")
+}
+
+// swap stores the next upstreams if they are changed
+func (w *resolvConfWatcher) swap(next *upstreams, source string) {
+	current := w.holder.load()
+	if reflect.DeepEqual(current, next) {
+		return
+	}
+	w.holder.store(next)
+	log.Infof("[agent] upstreams changed by %s, recursors %v -> %v, search %v -> %v", source,
+		current.recursors, next.recursors, current.searchNames, next.searchNames)
+}
+
+// upstreams merges the upstreams read from the resolv.conf with the ones set in config
+func (w *resolvConfWatcher) upstreams(nameservers []string, searchNames []string) *upstreams {
+	if len(w.nameservers) > 0 {
+		nameservers = w.nameservers
+	}
+	if len(w.searchNames) > 0 {
+		searchNames = make([]string, 0, len(w.searchNames))
+		for _, searchName := range w.searchNames {
+			searchNames = append(searchNames, dns.Fqdn(searchName))
+		}
+	}
+	return &upstreams{recursors: recursorAddresses(nameservers), searchNames: searchNames}
+}
+
+// reload parses the new content of the resolv.conf, the current upstreams are kept
+// if the content is invalid or the file is removed
+func (w *resolvConfWatcher) reload(content []byte) {
+	if len(content) == 0 {
+		log.Warnf("[agent] %s is removed or empty, keep the current upstreams", w.path)
+		return
+	}
+	nameservers, searchNames, err := parseResolvConfContent(content, w.bindLocalhost)
+	if err != nil {
+		log.Errorf("[agent] fail to parse %s, keep the current upstreams, err: %v", w.path, err)
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.fileNameservers, w.fileSearchNames = nameservers, searchNames
+	w.swap(w.upstreams(nameservers, searchNames), w.path)
+}
+
+func (w *resolvConfWatcher) run(ctx context.Context) {
+	w.lock.Lock()
+	w.watching = true
+	w.lock.Unlock()
+	w.watcher.Watch(ctx, w.reload)
+}
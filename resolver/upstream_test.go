@@ -0,0 +1,82 @@
+/**
+ * Tencent is pleased to support the open source community by making Polaris available.
+ *
+ * Copyright (C) 2019 THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * Licensed under the BSD 3-Clause License (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * https://opensource.org/licenses/BSD-3-Clause
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resolvConfWatcher_reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.NoError(t, os.WriteFile(path, []byte("nameserver 10.0.0.1\nsearch svc.cluster.local\n"), 0644))
+
+	holder := &upstreamHolder{}
+	w := newResolvConfWatcher(path, true, &RecurseConfig{}, holder)
+	nameservers, searchNames := parseResolvConf(path, true)
+	w.init(nameservers, searchNames)
+	d := buildDNSServer("udp", nil, nil, 0, nil, true)
+	d.upstream = holder
+	assert.Equal(t, []string{"10.0.0.1:53"}, d.upstream.load().recursors)
+	assert.Equal(t, "polaris.", d.Preprocess("polaris.svc.cluster.local."))
+
+	// the loopback nameserver of the sidecar is skipped
+	w.reload([]byte("nameserver 127.0.0.1\nnameserver 10.0.0.2\nsearch cluster.local\n"))
+	assert.Equal(t, []string{"10.0.0.2:53"}, d.upstream.load().recursors)
+	assert.Equal(t, "polaris.svc.", d.Preprocess("polaris.svc.cluster.local."))
+
+	// the removed file keeps the current upstreams
+	w.reload(nil)
+	assert.Equal(t, []string{"10.0.0.2:53"}, d.upstream.load().recursors)
+
+	// the config takes precedence over the file
+	w = newResolvConfWatcher(path, true, &RecurseConfig{NameServers: []string{"8.8.8.8"}}, holder)
+	w.reload([]byte("nameserver 10.0.0.3\nsearch svc.cluster.local\n"))
+	assert.Equal(t, []string{"8.8.8.8:53"}, d.upstream.load().recursors)
+	assert.Equal(t, "polaris.", d.Preprocess("polaris.svc.cluster.local."))
+	assert.True(t, w.needed())
+
+	w = newResolvConfWatcher(path, true, &RecurseConfig{NameServers: []string{"8.8.8.8"},
+		SearchNames: []string{"cluster.local"}}, holder)
+	assert.False(t, w.needed())
+}
+
+func Test_resolvConfWatcher_override(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.NoError(t, os.WriteFile(path, []byte("nameserver 10.0.0.1\nsearch svc.cluster.local\n"), 0644))
+
+	holder := &upstreamHolder{}
+	w := newResolvConfWatcher(path, true, &RecurseConfig{NameServers: []string{"8.8.8.8"},
+		SearchNames: []string{"cluster.local"}}, holder)
+	w.init(parseResolvConf(path, true))
+	assert.Equal(t, []string{"8.8.8.8:53"}, holder.load().recursors)
+
+	// the file not watched is read again when the config no longer sets the upstreams
+	assert.NoError(t, os.WriteFile(path, []byte("nameserver 10.0.0.2\nsearch svc.cluster.local\n"), 0644))
+	w.override(nil, []string{"cluster.local"})
+	assert.Equal(t, []string{"10.0.0.2:53"}, holder.load().recursors)
+	assert.Equal(t, []string{"cluster.local."}, holder.load().searchNames)
+	assert.True(t, w.needed())
+
+	w.override([]string{"1.1.1.1"}, nil)
+	assert.Equal(t, []string{"1.1.1.1:53"}, holder.load().recursors)
+	assert.Equal(t, []string{"svc.cluster.local."}, holder.load().searchNames)
+}
@@ -2,13 +2,16 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"google.golang.org/grpc"
 
 	"github.com/polarismesh/polaris-sidecar/pkg/log"
+	"github.com/polarismesh/polaris-sidecar/security/mtls/certificate"
 	"github.com/polarismesh/polaris-sidecar/security/mtls/certificate/caclient"
 	"github.com/polarismesh/polaris-sidecar/security/mtls/certificate/manager"
 	"github.com/polarismesh/polaris-sidecar/security/mtls/rotator"
@@ -22,8 +25,14 @@ type Agent struct {
 	client      manager.CSRClient
 	certManager manager.Manager
 	rotator     *rotator.Rotator
+
+	lock   sync.RWMutex
+	bundle *certificate.Bundle
 }
 
+// ErrNoCertificate the certificate is not issued yet
+var ErrNoCertificate = errors.New("certificate not issued yet")
+
 const defaultCAPath = "/etc/polaris-sidecar/certs/rootca.pem"
 
 func New(opt Option) (*Agent, error) {
@@ -71,6 +80,20 @@ func (a *Agent) Run(ctx context.Context) error {
 			return err
 		}
 		a.sds.UpdateSecrets(ctx, *bundle)
+		a.lock.Lock()
+		a.bundle = bundle
+		a.lock.Unlock()
 		return nil
 	})
 }
+
+// Certificate returns the details of the current workload certificate
+func (a *Agent) Certificate() (*certificate.CertInfo, error) {
+	a.lock.RLock()
+	bundle := a.bundle
+	a.lock.RUnlock()
+	if bundle == nil {
+		return nil, ErrNoCertificate
+	}
+	return bundle.Info()
+}
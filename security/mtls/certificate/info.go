@@ -0,0 +1,77 @@
+package certificate
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"time"
+)
+
+// Info the public details of the certificate, the private key is never included
+type Info struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	SerialNo    string    `json:"serial_number"`
+	URIs        []string  `json:"uris,omitempty"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"sha256_fingerprint"`
+}
+
+// CertInfo the details of the workload certificate and the root ca
+type CertInfo struct {
+	Leaf   *Info   `json:"leaf"`
+	Chain  []*Info `json:"chain,omitempty"`
+	RootCA []*Info `json:"root_ca,omitempty"`
+}
+
+// Info parses the certificates of the bundle
+func (b *Bundle) Info() (*CertInfo, error) {
+	chain, err := parseInfos(b.CertChain)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate in the chain")
+	}
+	roots, err := parseInfos(b.ROOTCA)
+	if err != nil {
+		return nil, err
+	}
+	return &CertInfo{Leaf: chain[0], Chain: chain[1:], RootCA: roots}, nil
+}
+
+func parseInfos(data []byte) ([]*Info, error) {
+	var infos []*Info
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return infos, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint := sha256.Sum256(cert.Raw)
+		info := &Info{
+			Subject:     cert.Subject.String(),
+			Issuer:      cert.Issuer.String(),
+			SerialNo:    cert.SerialNumber.String(),
+			DNSNames:    cert.DNSNames,
+			NotBefore:   cert.NotBefore,
+			NotAfter:    cert.NotAfter,
+			Fingerprint: hex.EncodeToString(fingerprint[:]),
+		}
+		for _, uri := range cert.URIs {
+			info.URIs = append(info.URIs, uri.String())
+		}
+		infos = append(infos, info)
+	}
+}